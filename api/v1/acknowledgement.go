@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrNoMatchingDataFound = errors.New("No matching data found")
+	ErrQueryTooLarge       = errors.New("Query too large")
+	ErrUnauthorized        = errors.New("Unauthorized")
+	ErrRateLimited         = errors.New("Rate limited")
+)
+
+// AcknowledgementMarketDocument is returned by entsoe instead of the requested document when a query can't be answered
+type AcknowledgementMarketDocument struct {
+	XMLName xml.Name `xml:"Acknowledgement_MarketDocument"`
+	ID      string   `xml:"mRID"`
+	Reasons []Reason `xml:"Reason"`
+}
+
+type Reason struct {
+	Code ReasonCode `xml:"code"`
+	Text string     `xml:"text"`
+}
+
+type ReasonCode string
+
+const (
+	ReasonCodeUnknown ReasonCode = ""
+	// ReasonCodeDataNotYetAvailable is used by entsoe when the requested data hasn't been published yet
+	ReasonCodeDataNotYetAvailable ReasonCode = "B08"
+	// ReasonCodeOther is used by entsoe for all other rejected queries, including queries without data or that are too large; the text tells them apart
+	ReasonCodeOther ReasonCode = "999"
+)
+
+// AcknowledgementError carries the reason entsoe rejected a query for; it matches the sentinel errors with errors.Is
+type AcknowledgementError struct {
+	StatusCode int
+	ReasonCode ReasonCode
+	ReasonText string
+}
+
+// ParseAcknowledgement returns the error in body if it's an acknowledgement document, or false if it's another document
+func ParseAcknowledgement(statusCode int, body []byte) (*AcknowledgementError, bool) {
+
+	var document AcknowledgementMarketDocument
+	err := xml.Unmarshal(body, &document)
+	if err != nil || len(document.Reasons) == 0 {
+		return nil, false
+	}
+
+	return &AcknowledgementError{
+		StatusCode: statusCode,
+		ReasonCode: document.Reasons[0].Code,
+		ReasonText: strings.TrimSpace(document.Reasons[0].Text),
+	}, true
+}
+
+func (e *AcknowledgementError) Error() string {
+	return fmt.Sprintf("Request returned status code %v with reason %v: %v", e.StatusCode, e.ReasonCode, e.ReasonText)
+}
+
+// Is classifies the reason into one of the sentinel errors, by reason code or status code and otherwise by reason text
+func (e *AcknowledgementError) Is(target error) bool {
+	return target != nil && target == e.getSentinel()
+}
+
+func (e *AcknowledgementError) getSentinel() error {
+
+	switch {
+	case e.ReasonCode == ReasonCodeDataNotYetAvailable:
+		return ErrNoMatchingDataFound
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+
+	text := strings.ToLower(e.ReasonText)
+
+	switch {
+	case strings.Contains(text, "security token") || strings.Contains(text, "unauthorized"):
+		return ErrUnauthorized
+	case strings.Contains(text, "max allowed requests") || strings.Contains(text, "too many requests"):
+		return ErrRateLimited
+	case strings.Contains(text, "no matching data found"):
+		return ErrNoMatchingDataFound
+	case strings.Contains(text, "exceeds") || strings.Contains(text, "too large") || strings.Contains(text, "too many"):
+		return ErrQueryTooLarge
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestParseAcknowledgement(t *testing.T) {
+	t.Run("ReturnsReasonCodeAndText", func(t *testing.T) {
+		xmlDocument := `<?xml version="1.0" encoding="UTF-8"?>
+<Acknowledgement_MarketDocument xmlns="urn:iec62325.351:tc57wg16:451-1:acknowledgementdocument:7:0">
+	<mRID>ee5b6d34-3a56-4e3d-a4b8-5e5d0b4c1d2f</mRID>
+	<createdDateTime>2021-03-11T17:42:45Z</createdDateTime>
+	<Reason>
+		<code>999</code>
+		<text>No matching data found for Data item ACTUAL_TOTAL_LOAD [6.1.A] (10YNL----------L) and interval 2020-03-18T00:00:00.000Z/2020-03-19T00:00:00.000Z.</text>
+	</Reason>
+</Acknowledgement_MarketDocument>`
+
+		// act
+		err, ok := ParseAcknowledgement(http.StatusOK, []byte(xmlDocument))
+
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusOK, err.StatusCode)
+		assert.Equal(t, ReasonCodeOther, err.ReasonCode)
+		assert.Equal(t, "No matching data found for Data item ACTUAL_TOTAL_LOAD [6.1.A] (10YNL----------L) and interval 2020-03-18T00:00:00.000Z/2020-03-19T00:00:00.000Z.", err.ReasonText)
+	})
+
+	t.Run("ReturnsFalseForOtherDocuments", func(t *testing.T) {
+		xmlDocument := `<?xml version="1.0" encoding="UTF-8"?>
+<GL_MarketDocument xmlns="urn:iec62325.351:tc57wg16:451-6:generationloaddocument:3:0">
+	<type>A75</type>
+</GL_MarketDocument>`
+
+		// act
+		_, ok := ParseAcknowledgement(http.StatusOK, []byte(xmlDocument))
+
+		assert.False(t, ok)
+	})
+}
+
+func TestAcknowledgementErrorIs(t *testing.T) {
+	t.Run("MatchesSentinelErrorForReason", func(t *testing.T) {
+
+		testCases := []struct {
+			statusCode int
+			reasonText string
+			expected   error
+		}{
+			{http.StatusOK, "No matching data found for Data item ACTUAL_TOTAL_LOAD [6.1.A]", ErrNoMatchingDataFound},
+			{http.StatusBadRequest, "The amount of requested data exceeds allowed limit. Requested 400 documents but only 200 are allowed.", ErrQueryTooLarge},
+			{http.StatusBadRequest, "Max allowed requests per minute from each unique IP is up to 400 only.", ErrRateLimited},
+			{http.StatusTooManyRequests, "", ErrRateLimited},
+			{http.StatusUnauthorized, "", ErrUnauthorized},
+			{http.StatusBadRequest, "Missing or invalid security token", ErrUnauthorized},
+		}
+
+		for _, tc := range testCases {
+
+			// act
+			err := &AcknowledgementError{StatusCode: tc.statusCode, ReasonCode: ReasonCodeOther, ReasonText: tc.reasonText}
+
+			assert.True(t, errors.Is(err, tc.expected), tc.reasonText)
+		}
+	})
+
+	t.Run("MatchesSentinelErrorForReasonCodeBeforeReasonText", func(t *testing.T) {
+
+		// act
+		err := &AcknowledgementError{StatusCode: http.StatusOK, ReasonCode: ReasonCodeDataNotYetAvailable, ReasonText: "Too many documents are not yet available"}
+
+		assert.True(t, errors.Is(err, ErrNoMatchingDataFound))
+		assert.False(t, errors.Is(err, ErrQueryTooLarge))
+		assert.False(t, errors.Is(err, ErrRateLimited))
+	})
+
+	t.Run("MatchesSentinelErrorForStatusCodeBeforeReasonText", func(t *testing.T) {
+
+		// act
+		err := &AcknowledgementError{StatusCode: http.StatusUnauthorized, ReasonCode: ReasonCodeOther, ReasonText: "No matching data found"}
+
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+		assert.False(t, errors.Is(err, ErrNoMatchingDataFound))
+	})
+
+	t.Run("MatchesNoSentinelErrorForUnknownReason", func(t *testing.T) {
+
+		// act
+		err := &AcknowledgementError{StatusCode: http.StatusBadRequest, ReasonCode: ReasonCodeOther, ReasonText: "Mandatory parameter DocumentType is missing"}
+
+		assert.False(t, errors.Is(err, ErrNoMatchingDataFound))
+		assert.False(t, errors.Is(err, ErrQueryTooLarge))
+		assert.False(t, errors.Is(err, ErrRateLimited))
+		assert.False(t, errors.Is(err, ErrUnauthorized))
+	})
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"time"
+)
+
+type BalanceMeasurement struct {
+	ID                string
+	Source            string
+	Area              string
+	Country           string
+	Resolution        string
+	ExchangeWithAreas []string
+	Samples           []*Sample
+	NetImport         float64
+	MeasuredAtTime    time.Time
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"time"
+)
+
+type CapacityMeasurement struct {
+	ID             string
+	Source         string
+	Area           string
+	Country        string
+	Resolution     string
+	Samples        []*Sample
+	MeasuredAtTime time.Time
+}
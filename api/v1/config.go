@@ -5,18 +5,30 @@ import (
 )
 
 type Config struct {
-	Areas []*AreaConfig `yaml:"areas"`
+	Areas             []*AreaConfig            `yaml:"areas"`
+	ConsumptionMix    *ConsumptionMixConfig    `yaml:"consumptionMix"`
+	InstalledCapacity *InstalledCapacityConfig `yaml:"installedCapacity"`
 }
 
 type AreaConfig struct {
-	Area              Area              `yaml:"area"`
-	Country           CountryCode       `yaml:"country"`
-	Source            Source            `yaml:"source"`
-	ResolutionMinutes int               `yaml:"resolutionMinutes"`
-	StartYearsAgo     int               `yaml:"startYearsAgo"`
-	StartMonthsAgo    int               `yaml:"startMonthsAgo"`
-	StartDaysAgo      int               `yaml:"startDaysAgo"`
-	Exchanges         []*ExchangeConfig `yaml:"exchanges"`
+	Area    Area        `yaml:"area"`
+	Country CountryCode `yaml:"country"`
+	Source  Source      `yaml:"source"`
+	// ResolutionMinutes is the resolution measurements are stored at; entsoe periods at another resolution are resampled to it
+	ResolutionMinutes int                       `yaml:"resolutionMinutes"`
+	StartYearsAgo     int                       `yaml:"startYearsAgo"`
+	StartMonthsAgo    int                       `yaml:"startMonthsAgo"`
+	StartDaysAgo      int                       `yaml:"startDaysAgo"`
+	Exchanges         []*ExchangeConfig         `yaml:"exchanges"`
+	EmissionFactors   map[string]EmissionFactor `yaml:"emissionFactors"`
+	Forecasts         []ForecastType            `yaml:"forecasts"`
+	PriceArea         Area                      `yaml:"priceArea"`
+	// GapLookbackHours enables re-fetching time slots with missing or partial generation samples for this many hours
+	GapLookbackHours int `yaml:"gapLookbackHours"`
+	// RereadWindowHours re-fetches generation for this many hours on every run, to store corrections as new revisions
+	RereadWindowHours int `yaml:"rereadWindowHours"`
+	// ExpectedProductionTypes are the psr types every time slot should have; if empty those in the response are expected
+	ExpectedProductionTypes []PsrType `yaml:"expectedProductionTypes"`
 }
 
 type ExchangeConfig struct {
@@ -26,10 +38,47 @@ type ExchangeConfig struct {
 	ResolutionMinutes int         `yaml:"resolutionMinutes"`
 }
 
+// ConsumptionMixConfig controls tracing generation through the exchanges between all configured areas
+type ConsumptionMixConfig struct {
+	Enable            bool `yaml:"enable"`
+	ResolutionMinutes int  `yaml:"resolutionMinutes"`
+	StartYearsAgo     int  `yaml:"startYearsAgo"`
+	StartMonthsAgo    int  `yaml:"startMonthsAgo"`
+	StartDaysAgo      int  `yaml:"startDaysAgo"`
+}
+
+// InstalledCapacityConfig controls the low-frequency retrieval of installed generation capacity for all configured areas
+type InstalledCapacityConfig struct {
+	Enable            bool `yaml:"enable"`
+	CheckIntervalDays int  `yaml:"checkIntervalDays"`
+	StartYearsAgo     int  `yaml:"startYearsAgo"`
+	// Refresh re-fetches the current year on every check, instead of only the years that haven't been stored yet, and
+	// stores it again if its values changed
+	Refresh bool `yaml:"refresh"`
+}
+
 func (c *Config) SetDefaults() {
 	for _, a := range c.Areas {
 		a.SetDefaults()
 	}
+	if c.ConsumptionMix != nil {
+		c.ConsumptionMix.SetDefaults()
+	}
+	if c.InstalledCapacity != nil {
+		c.InstalledCapacity.SetDefaults()
+	}
+}
+
+func (ic *InstalledCapacityConfig) SetDefaults() {
+	if ic.CheckIntervalDays == 0 {
+		ic.CheckIntervalDays = 7
+	}
+}
+
+func (cc *ConsumptionMixConfig) SetDefaults() {
+	if cc.ResolutionMinutes == 0 {
+		cc.ResolutionMinutes = 60
+	}
 }
 
 func (ac *AreaConfig) SetDefaults() {
@@ -53,6 +102,31 @@ func (ec *ExchangeConfig) SetDefaults() {
 	}
 }
 
+// GetBalanceResolutionMinutes returns the finest resolution of all exchanges, to compute the balance at
+func (ac *AreaConfig) GetBalanceResolutionMinutes() (resolutionMinutes int) {
+	for _, e := range ac.Exchanges {
+		if resolutionMinutes == 0 || e.ResolutionMinutes < resolutionMinutes {
+			resolutionMinutes = e.ResolutionMinutes
+		}
+	}
+
+	return
+}
+
+// GetEmissionFactor returns the emission factor for the psr type or energy type, preferring overrides from config
+func (ac *AreaConfig) GetEmissionFactor(energyType EnergyType, psrType PsrType) EmissionFactor {
+	if psrType != PsrTypeUnknown {
+		if emissionFactor, ok := ac.EmissionFactors[string(psrType)]; ok {
+			return emissionFactor
+		}
+	}
+	if emissionFactor, ok := ac.EmissionFactors[string(energyType)]; ok {
+		return emissionFactor
+	}
+
+	return energyType.GetDefaultEmissionFactor()
+}
+
 func (c *Config) Validate() (valid bool, errors []error, warnings []string) {
 	if len(c.Areas) == 0 {
 		errors = append(errors, fmt.Errorf("No areas have been configured, set at least one area"))
@@ -62,6 +136,16 @@ func (c *Config) Validate() (valid bool, errors []error, warnings []string) {
 		errors = append(errors, e...)
 		warnings = append(warnings, w...)
 	}
+	if c.ConsumptionMix != nil {
+		e, w := c.ConsumptionMix.validate()
+		errors = append(errors, e...)
+		warnings = append(warnings, w...)
+	}
+	if c.InstalledCapacity != nil {
+		e, w := c.InstalledCapacity.validate()
+		errors = append(errors, e...)
+		warnings = append(warnings, w...)
+	}
 
 	return len(errors) == 0, errors, warnings
 }
@@ -73,9 +157,33 @@ func (ac *AreaConfig) validate() (errors []error, warnings []string) {
 	if ac.Country == CountryCodeUnknown {
 		errors = append(errors, fmt.Errorf("Country for area is unknown, set with `country: NL`"))
 	}
-	if ac.ResolutionMinutes == 0 {
+	if ac.ResolutionMinutes <= 0 {
 		errors = append(errors, fmt.Errorf("Resolution for area is unknown, set with `resolutionMinutes: 15`"))
 	}
+	for key, ef := range ac.EmissionFactors {
+		if !EnergyType(key).IsKnown() && !PsrType(key).IsKnown() {
+			warnings = append(warnings, fmt.Sprintf("Emission factor %v is not a known energy type or psr type and will not be used", key))
+		}
+		if ef.Lifecycle < 0 || ef.Direct < 0 {
+			errors = append(errors, fmt.Errorf("Emission factor %v is negative, set with `lifecycle: 490` and `direct: 370`", key))
+		}
+	}
+	if ac.GapLookbackHours < 0 {
+		errors = append(errors, fmt.Errorf("Gap lookback for area is invalid, set with `gapLookbackHours: 48`"))
+	}
+	if ac.RereadWindowHours < 0 {
+		errors = append(errors, fmt.Errorf("Re-read window for area is invalid, set with `rereadWindowHours: 72`"))
+	}
+	for _, p := range ac.ExpectedProductionTypes {
+		if !p.IsKnown() {
+			errors = append(errors, fmt.Errorf("Expected production type %v for area is unknown, set with `expectedProductionTypes: [B14, B16]`", p))
+		}
+	}
+	for _, f := range ac.Forecasts {
+		if f != ForecastTypeWindAndSolar && f != ForecastTypeGeneration && f != ForecastTypeLoad {
+			errors = append(errors, fmt.Errorf("Forecast %v for area is unknown, set with `forecasts: [WindAndSolar, Generation, Load]`", f))
+		}
+	}
 	for _, e := range ac.Exchanges {
 		er, w := e.validate()
 		errors = append(errors, er...)
@@ -92,13 +200,32 @@ func (ec *ExchangeConfig) validate() (errors []error, warnings []string) {
 	if ec.Country == CountryCodeUnknown {
 		errors = append(errors, fmt.Errorf("Country for area is unknown, set with `country: NL`"))
 	}
-	if ec.ResolutionMinutes == 0 {
+	if ec.ResolutionMinutes <= 0 {
 		errors = append(errors, fmt.Errorf("Resolution for area is unknown, set with `resolutionMinutes: 15`"))
 	}
 
 	return errors, warnings
 }
 
+func (cc *ConsumptionMixConfig) validate() (errors []error, warnings []string) {
+	if cc.ResolutionMinutes <= 0 {
+		errors = append(errors, fmt.Errorf("Resolution for consumption mix is invalid, set with `resolutionMinutes: 60`"))
+	}
+
+	return errors, warnings
+}
+
+func (ic *InstalledCapacityConfig) validate() (errors []error, warnings []string) {
+	if ic.CheckIntervalDays <= 0 {
+		errors = append(errors, fmt.Errorf("Check interval for installed capacity is invalid, set with `checkIntervalDays: 7`"))
+	}
+	if ic.StartYearsAgo < 0 {
+		errors = append(errors, fmt.Errorf("Start for installed capacity is invalid, set with `startYearsAgo: 0`"))
+	}
+
+	return errors, warnings
+}
+
 type Source string
 
 const (
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"time"
+)
+
+type ConsumptionMeasurement struct {
+	ID                    string
+	Source                string
+	Area                  string
+	Country               string
+	Resolution            string
+	Samples               []*Sample
+	CarbonIntensity       float64
+	DirectCarbonIntensity float64
+	MeasuredAtTime        time.Time
+}
@@ -0,0 +1,13 @@
+package api
+
+// CursorPolicy determines which cursor to resume from when the state and the latest time slot stored in the sink disagree
+type CursorPolicy string
+
+const (
+	CursorPolicyUnknown  CursorPolicy = ""
+	CursorPolicyNone     CursorPolicy = "none"
+	CursorPolicyState    CursorPolicy = "state"
+	CursorPolicySink     CursorPolicy = "sink"
+	CursorPolicyEarliest CursorPolicy = "earliest"
+	CursorPolicyLatest   CursorPolicy = "latest"
+)
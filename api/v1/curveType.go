@@ -0,0 +1,72 @@
+package api
+
+// CurveType tells how the points of a period are laid out over its positions
+type CurveType string
+
+const (
+	// CurveTypeUnknown is treated as a sequential fixed size block, which entsoe uses when it's not specified
+	CurveTypeUnknown CurveType = ""
+	// CurveTypeSequentialFixedSizeBlock has a point for every position, a position without point is missing
+	CurveTypeSequentialFixedSizeBlock CurveType = "A01"
+	// CurveTypeVariableSizedBlock omits points that are equal to the previous one, each point lasts until the next one
+	CurveTypeVariableSizedBlock CurveType = "A03"
+)
+
+// ExpandPeriod returns the points of the period at the index of their position, starting at position 1; positions
+// without a point are nil, unless the curve type repeats the previous point for them. The number of positions follows
+// from the time interval and resolution, or from the highest position if the resolution can't be parsed.
+func ExpandPeriod(period TimeSeriePeriod, curveType CurveType) []*TimeSeriePoint {
+
+	nrOfPositions := period.GetNrOfPositions()
+	if nrOfPositions < 0 {
+		nrOfPositions = 0
+		for _, p := range period.Points {
+			if p.Position > nrOfPositions {
+				nrOfPositions = p.Position
+			}
+		}
+	}
+
+	points := make([]*TimeSeriePoint, nrOfPositions)
+	for i := range period.Points {
+		if period.Points[i].Position < 1 || period.Points[i].Position > nrOfPositions {
+			continue
+		}
+		point := period.Points[i]
+		points[point.Position-1] = &point
+	}
+
+	if curveType == CurveTypeVariableSizedBlock {
+		for i := 1; i < len(points); i++ {
+			if points[i] == nil && points[i-1] != nil {
+				point := *points[i-1]
+				point.Position = i + 1
+				points[i] = &point
+			}
+		}
+	}
+
+	return points
+}
+
+// GetNrOfPositions returns the number of points that fit in the time interval at the resolution, or -1 if the resolution
+// can't be parsed
+func (p TimeSeriePeriod) GetNrOfPositions() int {
+
+	if duration, ok := p.Resolution.GetDuration(); ok {
+		return int(p.TimeInterval.End.Sub(p.TimeInterval.Start) / duration)
+	}
+
+	// months and years vary in length, so step through them
+	nrOfPositions := 0
+	for {
+		end, ok := p.Resolution.AddTo(p.TimeInterval.Start, nrOfPositions+1)
+		if !ok {
+			return -1
+		}
+		if end.After(p.TimeInterval.End) {
+			return nrOfPositions
+		}
+		nrOfPositions++
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestExpandPeriod(t *testing.T) {
+
+	start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+	hourInterval := TimeInterval{Start: start, End: start.Add(time.Hour)}
+
+	testCases := []struct {
+		name       string
+		period     TimeSeriePeriod
+		curveType  CurveType
+		quantities []float64
+		missing    []int
+	}{
+		{
+			name:       "ReturnsAllPointsOfCompleteFixedSizeBlocks",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 1, Quantity: 1}, {Position: 2, Quantity: 2}, {Position: 3, Quantity: 3}, {Position: 4, Quantity: 4}}},
+			curveType:  CurveTypeSequentialFixedSizeBlock,
+			quantities: []float64{1, 2, 3, 4},
+		},
+		{
+			name:       "LeavesGapsInFixedSizeBlocksMissing",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 1, Quantity: 1}, {Position: 3, Quantity: 3}}},
+			curveType:  CurveTypeSequentialFixedSizeBlock,
+			quantities: []float64{1, 0, 3, 0},
+			missing:    []int{1, 3},
+		},
+		{
+			name:       "TreatsUnknownCurveTypeAsFixedSizeBlocks",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 2, Quantity: 2}}},
+			curveType:  CurveTypeUnknown,
+			quantities: []float64{0, 2, 0, 0},
+			missing:    []int{0, 2, 3},
+		},
+		{
+			name:       "RepeatsPreviousPointForGapsInVariableSizedBlocks",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 1, Quantity: 1}, {Position: 3, Quantity: 3}}},
+			curveType:  CurveTypeVariableSizedBlock,
+			quantities: []float64{1, 1, 3, 3},
+		},
+		{
+			name:       "LeavesPositionsBeforeFirstVariableSizedBlockMissing",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 3, Quantity: 3}}},
+			curveType:  CurveTypeVariableSizedBlock,
+			quantities: []float64{0, 0, 3, 3},
+			missing:    []int{0, 1},
+		},
+		{
+			name:       "OrdersPointsByPosition",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 4, Quantity: 4}, {Position: 2, Quantity: 2}, {Position: 1, Quantity: 1}}},
+			curveType:  CurveTypeVariableSizedBlock,
+			quantities: []float64{1, 2, 2, 4},
+		},
+		{
+			name:       "IgnoresPositionsOutsideInterval",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: ResolutionPT60M, Points: []TimeSeriePoint{{Position: 0, Quantity: 0}, {Position: 1, Quantity: 1}, {Position: 2, Quantity: 2}}},
+			curveType:  CurveTypeSequentialFixedSizeBlock,
+			quantities: []float64{1},
+		},
+		{
+			name:       "StepsThroughMonthsOfVaryingLength",
+			period:     TimeSeriePeriod{TimeInterval: TimeInterval{Start: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)}, Resolution: ResolutionP1M, Points: []TimeSeriePoint{{Position: 1, Quantity: 1}, {Position: 2, Quantity: 2}, {Position: 3, Quantity: 3}}},
+			curveType:  CurveTypeSequentialFixedSizeBlock,
+			quantities: []float64{1, 2, 3},
+		},
+		{
+			name:       "UsesHighestPositionForUnparseableResolution",
+			period:     TimeSeriePeriod{TimeInterval: hourInterval, Resolution: Resolution("15 minutes"), Points: []TimeSeriePoint{{Position: 1, Quantity: 1}, {Position: 2, Quantity: 2}}},
+			curveType:  CurveTypeSequentialFixedSizeBlock,
+			quantities: []float64{1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			points := ExpandPeriod(tc.period, tc.curveType)
+
+			assert.Equal(t, len(tc.quantities), len(points))
+			missing := []int{}
+			for i, p := range points {
+				if p == nil {
+					missing = append(missing, i)
+					continue
+				}
+				assert.Equal(t, i+1, p.Position)
+				assert.Equal(t, tc.quantities[i], p.Quantity)
+			}
+			if tc.missing == nil {
+				tc.missing = []int{}
+			}
+			assert.Equal(t, tc.missing, missing)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+// EmissionFactor holds the emissions for generating electricity in gCO2eq/kWh, both over the lifecycle of a plant and
+// for operating it
+type EmissionFactor struct {
+	Lifecycle float64 `yaml:"lifecycle"`
+	Direct    float64 `yaml:"direct"`
+}
+
+// GetDefaultEmissionFactor returns the median lifecycle emissions from IPCC AR5 (2014) annex III; the direct emissions
+// only count the combustion of fossil fuels
+func (e EnergyType) GetDefaultEmissionFactor() EmissionFactor {
+	switch e {
+	case EnergyTypeCoal:
+		return EmissionFactor{Lifecycle: 820, Direct: 760}
+	case EnergyTypeGas:
+		return EmissionFactor{Lifecycle: 490, Direct: 370}
+	case EnergyTypeOil:
+		return EmissionFactor{Lifecycle: 650, Direct: 600}
+	case EnergyTypeBiomass:
+		return EmissionFactor{Lifecycle: 230, Direct: 0}
+	case EnergyTypeNuclear:
+		return EmissionFactor{Lifecycle: 12, Direct: 0}
+	case EnergyTypeWaste:
+		return EmissionFactor{Lifecycle: 700, Direct: 330}
+	case EnergyTypeGeothermal:
+		return EmissionFactor{Lifecycle: 38, Direct: 0}
+	case EnergyTypeHydro:
+		return EmissionFactor{Lifecycle: 24, Direct: 0}
+	case EnergyTypeSolar:
+		return EmissionFactor{Lifecycle: 45, Direct: 0}
+	case EnergyTypeWindOffshore:
+		return EmissionFactor{Lifecycle: 12, Direct: 0}
+	case EnergyTypeWindOnshore:
+		return EmissionFactor{Lifecycle: 11, Direct: 0}
+	case EnergyTypeOtherRenewable:
+		return EmissionFactor{Lifecycle: 30, Direct: 0}
+	}
+
+	return EmissionFactor{Lifecycle: 700, Direct: 500}
+}
+
+// GetCarbonIntensity returns the emission factors of all samples in the given direction, weighted by their value
+func GetCarbonIntensity(samples []*Sample, sampleDirection SampleDirection) (lifecycle, direct float64) {
+	total := 0.0
+	for _, s := range samples {
+		if s.SampleDirection != sampleDirection || s.Value <= 0 {
+			continue
+		}
+		total += s.Value
+		lifecycle += s.Value * s.CarbonIntensity
+		direct += s.Value * s.DirectCarbonIntensity
+	}
+
+	if total == 0 {
+		return 0, 0
+	}
+
+	return lifecycle / total, direct / total
+}
@@ -31,3 +31,23 @@ func (e EnergyType) IsRenewable() bool {
 
 	return false
 }
+
+func (e EnergyType) IsKnown() bool {
+	switch e {
+	case EnergyTypeUnknown,
+		EnergyTypeCoal,
+		EnergyTypeGas,
+		EnergyTypeOil,
+		EnergyTypeBiomass,
+		EnergyTypeNuclear,
+		EnergyTypeWaste,
+		EnergyTypeGeothermal,
+		EnergyTypeHydro,
+		EnergyTypeSolar,
+		EnergyTypeWindOffshore,
+		EnergyTypeWindOnshore,
+		EnergyTypeOtherRenewable:
+		return true
+	}
+	return false
+}
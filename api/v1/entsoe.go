@@ -7,10 +7,11 @@ import (
 )
 
 type GetAggregatedGenerationPerTypeResponse struct {
-	DocumentType DocumentType                    `xml:"type"`
-	ProcessType  ProcessType                     `xml:"process.processType"`
-	TimePeriod   TimeInterval                    `xml:"time_Period.timeInterval"`
-	TimeSeries   []AggregatedGenerationTimeSerie `xml:"TimeSeries"`
+	DocumentType    DocumentType                    `xml:"type"`
+	CreatedDateTime time.Time                       `xml:"createdDateTime"`
+	ProcessType     ProcessType                     `xml:"process.processType"`
+	TimePeriod      TimeInterval                    `xml:"time_Period.timeInterval"`
+	TimeSeries      []AggregatedGenerationTimeSerie `xml:"TimeSeries"`
 }
 
 type TimeInterval struct {
@@ -23,21 +24,37 @@ type AggregatedGenerationTimeSerie struct {
 	InBiddingZone          Area            `xml:"inBiddingZone_Domain.mRID"`
 	OutBiddingZone         Area            `xml:"outBiddingZone_Domain.mRID"`
 	QuanityMeasurementUnit MeasurementUnit `xml:"quantity_Measure_Unit.name"`
+	CurveType              CurveType       `xml:"curveType"`
 	MktPsrType             struct {
 		PsrType PsrType `xml:"psrType"`
 	} `xml:"MktPSRType"`
-	Period TimeSeriePeriod `xml:"Period"`
+	Periods TimeSeriePeriods `xml:"Period"`
 }
 
+// TimeSeriePeriods holds all periods of a time serie, long intervals and interruptions are published as several periods
+type TimeSeriePeriods []TimeSeriePeriod
+
 type TimeSeriePeriod struct {
 	TimeInterval TimeInterval     `xml:"timeInterval"`
 	Resolution   Resolution       `xml:"resolution"`
 	Points       []TimeSeriePoint `xml:"Point"`
 }
 
+// Find returns the period containing the time
+func (p TimeSeriePeriods) Find(t time.Time) (period TimeSeriePeriod, ok bool) {
+	for _, period := range p {
+		if !period.TimeInterval.Start.After(t) && period.TimeInterval.End.After(t) {
+			return period, true
+		}
+	}
+
+	return period, false
+}
+
 type TimeSeriePoint struct {
-	Position int     `xml:"position"`
-	Quantity float64 `xml:"quantity"`
+	Position    int     `xml:"position"`
+	Quantity    float64 `xml:"quantity"`
+	PriceAmount float64 `xml:"price.amount"`
 }
 
 type GetPhysicalCrossBorderFlowResponse struct {
@@ -46,13 +63,86 @@ type GetPhysicalCrossBorderFlowResponse struct {
 }
 
 type PhysicalFlowTimeSerie struct {
-	ID                     int             `xml:"mRID"`
-	InDomain               Area            `xml:"in_Domain.mRID"`
-	OutDomain              Area            `xml:"out_Domain.mRID"`
-	QuanityMeasurementUnit MeasurementUnit `xml:"quantity_Measure_Unit.name"`
-	Period                 TimeSeriePeriod `xml:"Period"`
+	ID                     int              `xml:"mRID"`
+	InDomain               Area             `xml:"in_Domain.mRID"`
+	OutDomain              Area             `xml:"out_Domain.mRID"`
+	QuanityMeasurementUnit MeasurementUnit  `xml:"quantity_Measure_Unit.name"`
+	CurveType              CurveType        `xml:"curveType"`
+	Periods                TimeSeriePeriods `xml:"Period"`
+}
+
+type GetActualTotalLoadResponse struct {
+	DocumentType    DocumentType    `xml:"type"`
+	CreatedDateTime time.Time       `xml:"createdDateTime"`
+	ProcessType     ProcessType     `xml:"process.processType"`
+	TimePeriod      TimeInterval    `xml:"time_Period.timeInterval"`
+	TimeSeries      []LoadTimeSerie `xml:"TimeSeries"`
+}
+
+type LoadTimeSerie struct {
+	ID                     int              `xml:"mRID"`
+	OutBiddingZone         Area             `xml:"outBiddingZone_Domain.mRID"`
+	QuanityMeasurementUnit MeasurementUnit  `xml:"quantity_Measure_Unit.name"`
+	CurveType              CurveType        `xml:"curveType"`
+	Periods                TimeSeriePeriods `xml:"Period"`
 }
 
+type GetDayAheadPricesResponse struct {
+	DocumentType    DocumentType     `xml:"type"`
+	CreatedDateTime time.Time        `xml:"createdDateTime"`
+	TimePeriod      TimeInterval     `xml:"period.timeInterval"`
+	TimeSeries      []PriceTimeSerie `xml:"TimeSeries"`
+}
+
+type PriceTimeSerie struct {
+	ID                   int              `xml:"mRID"`
+	InDomain             Area             `xml:"in_Domain.mRID"`
+	OutDomain            Area             `xml:"out_Domain.mRID"`
+	Currency             Currency         `xml:"currency_Unit.name"`
+	PriceMeasurementUnit MeasurementUnit  `xml:"price_Measure_Unit.name"`
+	CurveType            CurveType        `xml:"curveType"`
+	Periods              TimeSeriePeriods `xml:"Period"`
+}
+
+type GetInstalledGenerationCapacityAggregatedResponse struct {
+	DocumentType    DocumentType                    `xml:"type"`
+	CreatedDateTime time.Time                       `xml:"createdDateTime"`
+	ProcessType     ProcessType                     `xml:"process.processType"`
+	TimePeriod      TimeInterval                    `xml:"time_Period.timeInterval"`
+	TimeSeries      []AggregatedGenerationTimeSerie `xml:"TimeSeries"`
+}
+
+// Document is implemented by all responses, so the documents answering a single query can be merged into one; unmarshalling
+// another document into a response appends its time series, after which the time period has to be extended
+type Document interface {
+	GetTimePeriod() *TimeInterval
+}
+
+func (r *GetAggregatedGenerationPerTypeResponse) GetTimePeriod() *TimeInterval {
+	return &r.TimePeriod
+}
+
+func (r *GetPhysicalCrossBorderFlowResponse) GetTimePeriod() *TimeInterval {
+	return &r.TimePeriod
+}
+
+func (r *GetActualTotalLoadResponse) GetTimePeriod() *TimeInterval {
+	return &r.TimePeriod
+}
+
+func (r *GetDayAheadPricesResponse) GetTimePeriod() *TimeInterval {
+	return &r.TimePeriod
+}
+
+func (r *GetInstalledGenerationCapacityAggregatedResponse) GetTimePeriod() *TimeInterval {
+	return &r.TimePeriod
+}
+
+// forecasts are returned in the same documents as the actual values
+type GetWindAndSolarForecastResponse = GetAggregatedGenerationPerTypeResponse
+type GetGenerationForecastResponse = GetAggregatedGenerationPerTypeResponse
+type GetLoadForecastResponse = GetActualTotalLoadResponse
+
 const timeIntervalLayout = "2006-01-02T15:04Z"
 
 func (t *TimeInterval) FormatAsParameter() string {
@@ -60,6 +150,19 @@ func (t *TimeInterval) FormatAsParameter() string {
 
 }
 
+// Extend widens the interval to also span other
+func (t *TimeInterval) Extend(other TimeInterval) {
+	if other.Start.IsZero() && other.End.IsZero() {
+		return
+	}
+	if t.Start.IsZero() || other.Start.Before(t.Start) {
+		t.Start = other.Start
+	}
+	if other.End.After(t.End) {
+		t.End = other.End
+	}
+}
+
 func (t *TimeInterval) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 	v := struct {
@@ -85,20 +188,23 @@ func (t *TimeInterval) UnmarshalXML(d *xml.Decoder, start xml.StartElement) erro
 type Area string
 
 const (
-	AreaUnknown      Area = ""
-	AreaBelgium      Area = "10YBE----------2"
-	AreaDenmark      Area = "10YDK-1--------W"
-	AreaGermany      Area = "10Y1001A1001A83F"
-	AreaGreatBritain Area = "10YGB----------A"
-	AreaNetherlands  Area = "10YNL----------L"
-	AreaNorway       Area = "10YNO-0--------C"
+	AreaUnknown           Area = ""
+	AreaBelgium           Area = "10YBE----------2"
+	AreaDenmark           Area = "10YDK-1--------W"
+	AreaGermany           Area = "10Y1001A1001A83F"
+	AreaGermanyLuxembourg Area = "10Y1001A1001A82H"
+	AreaGreatBritain      Area = "10YGB----------A"
+	AreaNetherlands       Area = "10YNL----------L"
+	AreaNorway            Area = "10YNO-0--------C"
 )
 
 type ProcessType string
 
 const (
-	ProcessTypeUnknown  ProcessType = ""
-	ProcessTypeRealised ProcessType = "A16"
+	ProcessTypeUnknown   ProcessType = ""
+	ProcessTypeDayAhead  ProcessType = "A01"
+	ProcessTypeRealised  ProcessType = "A16"
+	ProcessTypeYearAhead ProcessType = "A33"
 )
 
 type DocumentType string
@@ -106,15 +212,27 @@ type DocumentType string
 const (
 	DocumentTypeUnknown                    DocumentType = ""
 	DocumentTypeAggregatedEnergyDataReport DocumentType = "A11"
+	DocumentTypePriceDocument              DocumentType = "A44"
 	DocumentTypeSystemTotalLoad            DocumentType = "A65"
+	DocumentTypeInstalledGenerationPerType DocumentType = "A68"
+	DocumentTypeWindAndSolarForecast       DocumentType = "A69"
+	DocumentTypeGenerationForecast         DocumentType = "A71"
 	DocumentTypeActualGenerationPerType    DocumentType = "A75"
 )
 
 type MeasurementUnit string
 
 const (
-	MeasurementUnitUnknown  MeasurementUnit = ""
-	MeasurementUnitMegaWatt MeasurementUnit = "MAW"
+	MeasurementUnitUnknown      MeasurementUnit = ""
+	MeasurementUnitMegaWatt     MeasurementUnit = "MAW"
+	MeasurementUnitMegaWattHour MeasurementUnit = "MWH"
+)
+
+type Currency string
+
+const (
+	CurrencyUnknown Currency = ""
+	CurrencyEuro    Currency = "EUR"
 )
 
 type PsrType string
@@ -150,10 +268,6 @@ const (
 	PsrTypeTransformer          PsrType = "B24"
 )
 
-type Resolution string
-
-const (
-	ResolutionUnknown Resolution = ""
-	ResolutionPT15M   Resolution = "PT15M"
-	ResolutionPT60M   Resolution = "PT60M"
-)
+func (p PsrType) IsKnown() bool {
+	return len(p) == 3 && (p[0] == 'A' || p[0] == 'B')
+}
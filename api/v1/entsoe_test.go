@@ -162,24 +162,24 @@ func TestUnmarshal(t *testing.T) {
 		assert.Equal(t, AreaNetherlands, response.TimeSeries[0].InBiddingZone)
 		assert.Equal(t, MeasurementUnitMegaWatt, response.TimeSeries[0].QuanityMeasurementUnit)
 		assert.Equal(t, PsrTypeWindOffshore, response.TimeSeries[0].MktPsrType.PsrType)
-		assert.Equal(t, time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC), response.TimeSeries[0].Period.TimeInterval.Start)
-		assert.Equal(t, time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC), response.TimeSeries[0].Period.TimeInterval.End)
-		assert.Equal(t, 2, len(response.TimeSeries[0].Period.Points))
-		assert.Equal(t, 1, response.TimeSeries[0].Period.Points[0].Position)
-		assert.Equal(t, 739.0, response.TimeSeries[0].Period.Points[0].Quantity)
-		assert.Equal(t, 2, response.TimeSeries[0].Period.Points[1].Position)
-		assert.Equal(t, 750.0, response.TimeSeries[0].Period.Points[1].Quantity)
+		assert.Equal(t, time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC), response.TimeSeries[0].Periods[0].TimeInterval.Start)
+		assert.Equal(t, time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC), response.TimeSeries[0].Periods[0].TimeInterval.End)
+		assert.Equal(t, 2, len(response.TimeSeries[0].Periods[0].Points))
+		assert.Equal(t, 1, response.TimeSeries[0].Periods[0].Points[0].Position)
+		assert.Equal(t, 739.0, response.TimeSeries[0].Periods[0].Points[0].Quantity)
+		assert.Equal(t, 2, response.TimeSeries[0].Periods[0].Points[1].Position)
+		assert.Equal(t, 750.0, response.TimeSeries[0].Periods[0].Points[1].Quantity)
 
 		assert.Equal(t, AreaNetherlands, response.TimeSeries[1].OutBiddingZone)
 		assert.Equal(t, MeasurementUnitMegaWatt, response.TimeSeries[1].QuanityMeasurementUnit)
 		assert.Equal(t, PsrTypeFossilGas, response.TimeSeries[1].MktPsrType.PsrType)
-		assert.Equal(t, time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC), response.TimeSeries[1].Period.TimeInterval.Start)
-		assert.Equal(t, time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC), response.TimeSeries[1].Period.TimeInterval.End)
-		assert.Equal(t, 2, len(response.TimeSeries[1].Period.Points))
-		assert.Equal(t, 1, response.TimeSeries[1].Period.Points[0].Position)
-		assert.Equal(t, 1554.0, response.TimeSeries[1].Period.Points[0].Quantity)
-		assert.Equal(t, 2, response.TimeSeries[1].Period.Points[1].Position)
-		assert.Equal(t, 1581.0, response.TimeSeries[1].Period.Points[1].Quantity)
+		assert.Equal(t, time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC), response.TimeSeries[1].Periods[0].TimeInterval.Start)
+		assert.Equal(t, time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC), response.TimeSeries[1].Periods[0].TimeInterval.End)
+		assert.Equal(t, 2, len(response.TimeSeries[1].Periods[0].Points))
+		assert.Equal(t, 1, response.TimeSeries[1].Periods[0].Points[0].Position)
+		assert.Equal(t, 1554.0, response.TimeSeries[1].Periods[0].Points[0].Quantity)
+		assert.Equal(t, 2, response.TimeSeries[1].Periods[0].Points[1].Position)
+		assert.Equal(t, 1581.0, response.TimeSeries[1].Periods[0].Points[1].Quantity)
 	})
 
 	t.Run("ReadsA75Response", func(t *testing.T) {
@@ -193,9 +193,10 @@ func TestUnmarshal(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, 39, len(response.TimeSeries))
 		assert.Equal(t, 5, response.TimeSeries[4].ID)
-		assert.Equal(t, ResolutionPT15M, response.TimeSeries[4].Period.Resolution)
-		assert.Equal(t, 92, len(response.TimeSeries[4].Period.Points))
-		assert.Equal(t, 5046.0, response.TimeSeries[4].Period.Points[0].Quantity)
+		assert.Equal(t, CurveTypeSequentialFixedSizeBlock, response.TimeSeries[4].CurveType)
+		assert.Equal(t, ResolutionPT15M, response.TimeSeries[4].Periods[0].Resolution)
+		assert.Equal(t, 92, len(response.TimeSeries[4].Periods[0].Points))
+		assert.Equal(t, 5046.0, response.TimeSeries[4].Periods[0].Points[0].Quantity)
 	})
 
 	t.Run("ReadsA11Response", func(t *testing.T) {
@@ -209,8 +210,153 @@ func TestUnmarshal(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(response.TimeSeries))
 		assert.Equal(t, 1, response.TimeSeries[0].ID)
-		assert.Equal(t, ResolutionPT60M, response.TimeSeries[0].Period.Resolution)
-		assert.Equal(t, 14, len(response.TimeSeries[0].Period.Points))
-		assert.Equal(t, 701.0, response.TimeSeries[0].Period.Points[0].Quantity)
+		assert.Equal(t, ResolutionPT60M, response.TimeSeries[0].Periods[0].Resolution)
+		assert.Equal(t, 14, len(response.TimeSeries[0].Periods[0].Points))
+		assert.Equal(t, 701.0, response.TimeSeries[0].Periods[0].Points[0].Quantity)
+	})
+
+	t.Run("ReadsA44Response", func(t *testing.T) {
+
+		testResponse, _ := ioutil.ReadFile("A44-response.xml")
+		var response GetDayAheadPricesResponse
+
+		// act
+		err := xml.Unmarshal([]byte(testResponse), &response)
+
+		assert.Nil(t, err)
+		assert.Equal(t, DocumentTypePriceDocument, response.DocumentType)
+		assert.Equal(t, time.Date(2021, 3, 11, 23, 0, 0, 0, time.UTC), response.TimePeriod.Start)
+		assert.Equal(t, 1, len(response.TimeSeries))
+		assert.Equal(t, AreaNetherlands, response.TimeSeries[0].InDomain)
+		assert.Equal(t, CurrencyEuro, response.TimeSeries[0].Currency)
+		assert.Equal(t, MeasurementUnitMegaWattHour, response.TimeSeries[0].PriceMeasurementUnit)
+		assert.Equal(t, ResolutionPT60M, response.TimeSeries[0].Periods[0].Resolution)
+		assert.Equal(t, 24, len(response.TimeSeries[0].Periods[0].Points))
+		assert.Equal(t, 48.2, response.TimeSeries[0].Periods[0].Points[0].PriceAmount)
+	})
+
+	t.Run("ReadsA65Response", func(t *testing.T) {
+
+		testResponse, _ := ioutil.ReadFile("A65-response.xml")
+		var response GetActualTotalLoadResponse
+
+		// act
+		err := xml.Unmarshal([]byte(testResponse), &response)
+
+		assert.Nil(t, err)
+		assert.Equal(t, DocumentTypeSystemTotalLoad, response.DocumentType)
+		assert.Equal(t, ProcessTypeRealised, response.ProcessType)
+		assert.Equal(t, 1, len(response.TimeSeries))
+		assert.Equal(t, AreaNetherlands, response.TimeSeries[0].OutBiddingZone)
+		assert.Equal(t, MeasurementUnitMegaWatt, response.TimeSeries[0].QuanityMeasurementUnit)
+		assert.Equal(t, ResolutionPT15M, response.TimeSeries[0].Periods[0].Resolution)
+		assert.Equal(t, 96, len(response.TimeSeries[0].Periods[0].Points))
+		assert.Equal(t, 10517.0, response.TimeSeries[0].Periods[0].Points[0].Quantity)
+	})
+
+	t.Run("ReadsA68Response", func(t *testing.T) {
+
+		testResponse, _ := ioutil.ReadFile("A68-response.xml")
+		var response GetInstalledGenerationCapacityAggregatedResponse
+
+		// act
+		err := xml.Unmarshal([]byte(testResponse), &response)
+
+		assert.Nil(t, err)
+		assert.Equal(t, DocumentTypeInstalledGenerationPerType, response.DocumentType)
+		assert.Equal(t, ProcessTypeYearAhead, response.ProcessType)
+		assert.Equal(t, 10, len(response.TimeSeries))
+		assert.Equal(t, PsrTypeBiomass, response.TimeSeries[0].MktPsrType.PsrType)
+		assert.Equal(t, ResolutionP1Y, response.TimeSeries[0].Periods[0].Resolution)
+		assert.Equal(t, 1, len(response.TimeSeries[0].Periods[0].Points))
+		assert.Equal(t, 494.0, response.TimeSeries[0].Periods[0].Points[0].Quantity)
+	})
+	t.Run("ReadsAllPeriodsOfTimeSerie", func(t *testing.T) {
+		xmlDocument := `
+<?xml version="1.0" encoding="UTF-8"?>
+<GL_MarketDocument xmlns="urn:iec62325.351:tc57wg16:451-6:generationloaddocument:3:0">
+	<TimeSeries>
+		<mRID>1</mRID>
+		<MktPSRType>
+			<psrType>B16</psrType>
+		</MktPSRType>
+		<Period>
+			<timeInterval>
+				<start>2021-03-11T07:00Z</start>
+				<end>2021-03-11T07:30Z</end>
+			</timeInterval>
+			<resolution>PT15M</resolution>
+			<Point>
+				<position>1</position>
+				<quantity>10</quantity>
+			</Point>
+			<Point>
+				<position>2</position>
+				<quantity>20</quantity>
+			</Point>
+		</Period>
+		<Period>
+			<timeInterval>
+				<start>2021-03-11T08:00Z</start>
+				<end>2021-03-11T08:15Z</end>
+			</timeInterval>
+			<resolution>PT15M</resolution>
+			<Point>
+				<position>1</position>
+				<quantity>30</quantity>
+			</Point>
+		</Period>
+	</TimeSeries>
+</GL_MarketDocument>`
+
+		var response GetAggregatedGenerationPerTypeResponse
+
+		// act
+		err := xml.Unmarshal([]byte(xmlDocument), &response)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(response.TimeSeries))
+		assert.Equal(t, 2, len(response.TimeSeries[0].Periods))
+		assert.Equal(t, time.Date(2021, 3, 11, 8, 0, 0, 0, time.UTC), response.TimeSeries[0].Periods[1].TimeInterval.Start)
+		assert.Equal(t, 30.0, response.TimeSeries[0].Periods[1].Points[0].Quantity)
+	})
+}
+
+func TestTimeSeriePeriodsFind(t *testing.T) {
+
+	periods := TimeSeriePeriods{
+		{TimeInterval: TimeInterval{Start: time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC)}},
+		{TimeInterval: TimeInterval{Start: time.Date(2021, 3, 11, 8, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 11, 8, 15, 0, 0, time.UTC)}},
+	}
+
+	t.Run("ReturnsPeriodContainingTime", func(t *testing.T) {
+
+		// act
+		period, ok := periods.Find(time.Date(2021, 3, 11, 8, 0, 0, 0, time.UTC))
+
+		assert.True(t, ok)
+		assert.Equal(t, periods[1], period)
+	})
+
+	t.Run("ReturnsFalseBetweenPeriods", func(t *testing.T) {
+
+		// act
+		_, ok := periods.Find(time.Date(2021, 3, 11, 7, 30, 0, 0, time.UTC))
+
+		assert.False(t, ok)
+	})
+}
+
+func TestTimeIntervalExtend(t *testing.T) {
+	t.Run("SpansBothIntervals", func(t *testing.T) {
+
+		timeInterval := TimeInterval{}
+
+		// act
+		timeInterval.Extend(TimeInterval{Start: time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 13, 0, 0, 0, 0, time.UTC)})
+		timeInterval.Extend(TimeInterval{Start: time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)})
+		timeInterval.Extend(TimeInterval{})
+
+		assert.Equal(t, TimeInterval{Start: time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 3, 13, 0, 0, 0, 0, time.UTC)}, timeInterval)
 	})
 }
@@ -5,10 +5,13 @@ import (
 )
 
 type ExchangeMeasurement struct {
-	ID               string
-	Source           string
-	Area             string
-	ExchangeWithArea string
-	Samples          []*Sample
-	MeasuredAtTime   time.Time
+	ID                  string
+	Source              string
+	Area                string
+	ExchangeWithArea    string
+	Samples             []*Sample
+	MeasuredAtTime      time.Time
+	Country             string
+	ExchangeWithCountry string
+	Resolution          string
 }
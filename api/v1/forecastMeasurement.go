@@ -0,0 +1,20 @@
+package api
+
+import (
+	"time"
+)
+
+type ForecastMeasurement struct {
+	ID           string
+	Source       string
+	Area         string
+	Country      string
+	Resolution   string
+	ForecastType ForecastType
+	Samples      []*Sample
+	// IssuedAtTime is the creation time of the forecast document; its time series don't carry an issue time of their own
+	IssuedAtTime    time.Time
+	ForecastForTime time.Time
+	// FetchedAtTime is when the exporter retrieved the forecast
+	FetchedAtTime time.Time
+}
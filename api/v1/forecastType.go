@@ -0,0 +1,10 @@
+package api
+
+type ForecastType string
+
+const (
+	ForecastTypeUnknown      ForecastType = ""
+	ForecastTypeWindAndSolar ForecastType = "WindAndSolar"
+	ForecastTypeGeneration   ForecastType = "Generation"
+	ForecastTypeLoad         ForecastType = "Load"
+)
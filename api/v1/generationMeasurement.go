@@ -5,11 +5,16 @@ import (
 )
 
 type GenerationMeasurement struct {
-	ID             string
-	Source         string
-	Area           string
-	Country        string
-	Resolution     string
-	Samples        []*Sample
-	MeasuredAtTime time.Time
+	ID                    string
+	Source                string
+	Area                  string
+	Country               string
+	Resolution            string
+	Samples               []*Sample
+	MeasuredAtTime        time.Time
+	CarbonIntensity       float64
+	DirectCarbonIntensity float64
+	// RevisionNumber is increased each time entsoe publishes corrected values for the time slot
+	RevisionNumber int
+	FetchedAtTime  time.Time
 }
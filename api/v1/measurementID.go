@@ -0,0 +1,21 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// namespace for deriving measurement ids, changing it changes all ids
+	measurementIDNamespace = uuid.MustParse("6a1f3c2e-8d4b-4f6e-9b7a-2c5d8e0f1a3b")
+)
+
+// NewMeasurementID returns an id derived from the stream, source, area and time slot of a measurement plus any keys
+// needed to tell it apart, so storing the same measurement again results in the same id
+func NewMeasurementID(stream MeasurementStream, source, area string, timeSlotStartTime time.Time, keys ...string) string {
+	name := strings.Join(append([]string{string(stream), source, area, timeSlotStartTime.UTC().Format(time.RFC3339)}, keys...), "|")
+
+	return uuid.NewSHA1(measurementIDNamespace, []byte(name)).String()
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestNewMeasurementID(t *testing.T) {
+	t.Run("ReturnsSameIDForSameMeasurement", func(t *testing.T) {
+
+		timeSlotStartTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+
+		// act
+		id := NewMeasurementID(MeasurementStreamGeneration, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime)
+
+		assert.Equal(t, NewMeasurementID(MeasurementStreamGeneration, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime), id)
+		assert.Equal(t, 36, len(id))
+	})
+
+	t.Run("ReturnsSameIDForSameTimeInOtherLocation", func(t *testing.T) {
+
+		timeSlotStartTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+
+		// act
+		id := NewMeasurementID(MeasurementStreamGeneration, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime.In(time.FixedZone("CET", 3600)))
+
+		assert.Equal(t, NewMeasurementID(MeasurementStreamGeneration, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime), id)
+	})
+
+	t.Run("ReturnsDifferentIDsForDifferentStreamsAreasTimeSlotsOrKeys", func(t *testing.T) {
+
+		timeSlotStartTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		id := NewMeasurementID(MeasurementStreamExchange, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime, string(AreaBelgium))
+
+		// act
+		ids := []string{
+			NewMeasurementID(MeasurementStreamBalance, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime, string(AreaBelgium)),
+			NewMeasurementID(MeasurementStreamExchange, string(SourceEntsoe), string(AreaGermany), timeSlotStartTime, string(AreaBelgium)),
+			NewMeasurementID(MeasurementStreamExchange, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime.Add(15*time.Minute), string(AreaBelgium)),
+			NewMeasurementID(MeasurementStreamExchange, string(SourceEntsoe), string(AreaNetherlands), timeSlotStartTime, string(AreaGermany)),
+		}
+
+		for _, other := range ids {
+			assert.NotEqual(t, id, other)
+		}
+	})
+}
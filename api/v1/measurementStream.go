@@ -0,0 +1,15 @@
+package api
+
+type MeasurementStream string
+
+const (
+	MeasurementStreamUnknown     MeasurementStream = ""
+	MeasurementStreamGeneration  MeasurementStream = "Generation"
+	MeasurementStreamExchange    MeasurementStream = "Exchange"
+	MeasurementStreamBalance     MeasurementStream = "Balance"
+	MeasurementStreamConsumption MeasurementStream = "Consumption"
+	MeasurementStreamLoad        MeasurementStream = "Load"
+	MeasurementStreamForecast    MeasurementStream = "Forecast"
+	MeasurementStreamPrice       MeasurementStream = "Price"
+	MeasurementStreamCapacity    MeasurementStream = "Capacity"
+)
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"time"
+)
+
+// MixSummary holds values derived from a generation measurement, for consumers that don't want to aggregate samples themselves
+type MixSummary struct {
+	Source                string
+	Area                  string
+	Country               string
+	Resolution            string
+	TotalGeneration       float64
+	RenewableGeneration   float64
+	RenewableShare        float64
+	CarbonIntensity       float64
+	DirectCarbonIntensity float64
+	MeasuredAtTime        time.Time
+}
+
+// NewMixSummary returns the renewable share and carbon intensity of the generation in a measurement
+func NewMixSummary(measurement GenerationMeasurement) MixSummary {
+	summary := MixSummary{
+		Source:                measurement.Source,
+		Area:                  measurement.Area,
+		Country:               measurement.Country,
+		Resolution:            measurement.Resolution,
+		CarbonIntensity:       measurement.CarbonIntensity,
+		DirectCarbonIntensity: measurement.DirectCarbonIntensity,
+		MeasuredAtTime:        measurement.MeasuredAtTime,
+	}
+
+	for _, s := range measurement.Samples {
+		if s == nil || s.SampleDirection != SampleDirectionIn || s.Value <= 0 {
+			continue
+		}
+		summary.TotalGeneration += s.Value
+		if s.IsRenewable {
+			summary.RenewableGeneration += s.Value
+		}
+	}
+
+	if summary.TotalGeneration > 0 {
+		summary.RenewableShare = summary.RenewableGeneration / summary.TotalGeneration
+	}
+
+	return summary
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestNewMixSummary(t *testing.T) {
+	t.Run("ReturnsRenewableShareOfGeneration", func(t *testing.T) {
+
+		measurement := GenerationMeasurement{
+			Area:            string(AreaNetherlands),
+			CarbonIntensity: 300,
+			Samples: []*Sample{
+				{IsRenewable: true, SampleDirection: SampleDirectionIn, Value: 250},
+				{IsRenewable: false, SampleDirection: SampleDirectionIn, Value: 750},
+				{IsRenewable: true, SampleDirection: SampleDirectionOut, Value: 500},
+			},
+		}
+
+		// act
+		summary := NewMixSummary(measurement)
+
+		assert.Equal(t, 1000.0, summary.TotalGeneration)
+		assert.Equal(t, 250.0, summary.RenewableGeneration)
+		assert.Equal(t, 0.25, summary.RenewableShare)
+		assert.Equal(t, 300.0, summary.CarbonIntensity)
+	})
+
+	t.Run("ReturnsZeroRenewableShareWithoutGeneration", func(t *testing.T) {
+
+		// act
+		summary := NewMixSummary(GenerationMeasurement{})
+
+		assert.Equal(t, 0.0, summary.RenewableShare)
+	})
+}
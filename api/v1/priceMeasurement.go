@@ -0,0 +1,16 @@
+package api
+
+import (
+	"time"
+)
+
+type PriceMeasurement struct {
+	ID                   string
+	Source               string
+	Area                 string
+	Country              string
+	Resolution           string
+	Currency             string
+	PricePerMegaWattHour float64
+	MeasuredAtTime       time.Time
+}
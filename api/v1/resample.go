@@ -0,0 +1,41 @@
+package api
+
+import (
+	"time"
+)
+
+// GetPointForTimeSlot returns the point of the period for a time slot of the given length, resampling when the resolution
+// of the period differs: the points within a longer time slot are averaged, which suits power as well as prices, and the
+// point containing a shorter time slot is repeated. It returns false if the period doesn't cover the time slot completely.
+func GetPointForTimeSlot(period TimeSeriePeriod, curveType CurveType, timeSlotStartTime time.Time, timeSlotDuration time.Duration) (point TimeSeriePoint, ok bool) {
+
+	resolution, ok := period.Resolution.GetDuration()
+	if !ok || timeSlotDuration <= 0 || timeSlotStartTime.Before(period.TimeInterval.Start) {
+		return point, false
+	}
+
+	points := ExpandPeriod(period, curveType)
+
+	first := int(timeSlotStartTime.Sub(period.TimeInterval.Start) / resolution)
+	last := first
+	if resolution < timeSlotDuration {
+		last = int((timeSlotStartTime.Add(timeSlotDuration).Sub(period.TimeInterval.Start) - 1) / resolution)
+	}
+	if last >= len(points) {
+		return point, false
+	}
+
+	for i := first; i <= last; i++ {
+		if points[i] == nil {
+			return TimeSeriePoint{}, false
+		}
+		point.Quantity += points[i].Quantity
+		point.PriceAmount += points[i].PriceAmount
+	}
+	nrOfPoints := float64(last - first + 1)
+	point.Position = points[first].Position
+	point.Quantity /= nrOfPoints
+	point.PriceAmount /= nrOfPoints
+
+	return point, true
+}
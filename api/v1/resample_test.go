@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestGetPointForTimeSlot(t *testing.T) {
+
+	start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+	quarterHourPeriod := TimeSeriePeriod{TimeInterval: TimeInterval{Start: start, End: start.Add(time.Hour)}, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 1, Quantity: 10}, {Position: 2, Quantity: 20}, {Position: 3, Quantity: 30}, {Position: 4, Quantity: 40}}}
+	hourPeriod := TimeSeriePeriod{TimeInterval: TimeInterval{Start: start, End: start.Add(2 * time.Hour)}, Resolution: ResolutionPT60M, Points: []TimeSeriePoint{{Position: 1, Quantity: 100, PriceAmount: 50}, {Position: 2, Quantity: 200, PriceAmount: 60}}}
+
+	testCases := []struct {
+		name              string
+		period            TimeSeriePeriod
+		timeSlotStartTime time.Time
+		timeSlotDuration  time.Duration
+		ok                bool
+		quantity          float64
+		priceAmount       float64
+	}{
+		{
+			name:              "TakesPointAtSameResolution",
+			period:            quarterHourPeriod,
+			timeSlotStartTime: start.Add(30 * time.Minute),
+			timeSlotDuration:  15 * time.Minute,
+			ok:                true,
+			quantity:          30,
+		},
+		{
+			name:              "AveragesPointsForLongerTimeSlot",
+			period:            quarterHourPeriod,
+			timeSlotStartTime: start,
+			timeSlotDuration:  time.Hour,
+			ok:                true,
+			quantity:          25,
+		},
+		{
+			name:              "ReturnsFalseIfPointForLongerTimeSlotIsMissing",
+			period:            TimeSeriePeriod{TimeInterval: quarterHourPeriod.TimeInterval, Resolution: ResolutionPT15M, Points: []TimeSeriePoint{{Position: 1, Quantity: 10}, {Position: 2, Quantity: 20}, {Position: 4, Quantity: 40}}},
+			timeSlotStartTime: start,
+			timeSlotDuration:  time.Hour,
+			ok:                false,
+		},
+		{
+			name:              "RepeatsPointForShorterTimeSlot",
+			period:            hourPeriod,
+			timeSlotStartTime: start.Add(75 * time.Minute),
+			timeSlotDuration:  15 * time.Minute,
+			ok:                true,
+			quantity:          200,
+			priceAmount:       60,
+		},
+		{
+			name:              "ReturnsFalseForTimeSlotAfterPeriod",
+			period:            hourPeriod,
+			timeSlotStartTime: start.Add(2 * time.Hour),
+			timeSlotDuration:  15 * time.Minute,
+			ok:                false,
+		},
+		{
+			name:              "ReturnsFalseForTimeSlotBeforePeriod",
+			period:            hourPeriod,
+			timeSlotStartTime: start.Add(-15 * time.Minute),
+			timeSlotDuration:  15 * time.Minute,
+			ok:                false,
+		},
+		{
+			name:              "ReturnsFalseForResolutionOfVaryingLength",
+			period:            TimeSeriePeriod{TimeInterval: TimeInterval{Start: start, End: start.AddDate(1, 0, 0)}, Resolution: ResolutionP1Y, Points: []TimeSeriePoint{{Position: 1, Quantity: 494}}},
+			timeSlotStartTime: start,
+			timeSlotDuration:  time.Hour,
+			ok:                false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+
+			// act
+			point, ok := GetPointForTimeSlot(tc.period, CurveTypeSequentialFixedSizeBlock, tc.timeSlotStartTime, tc.timeSlotDuration)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.quantity, point.Quantity)
+			assert.Equal(t, tc.priceAmount, point.PriceAmount)
+		})
+	}
+}
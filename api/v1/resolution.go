@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Resolution is the iso-8601 duration of a single point in a period, like PT15M or P1Y
+type Resolution string
+
+const (
+	ResolutionUnknown Resolution = ""
+	ResolutionPT15M   Resolution = "PT15M"
+	ResolutionPT30M   Resolution = "PT30M"
+	ResolutionPT60M   Resolution = "PT60M"
+	ResolutionP1D     Resolution = "P1D"
+	ResolutionP7D     Resolution = "P7D"
+	ResolutionP1M     Resolution = "P1M"
+	ResolutionP1Y     Resolution = "P1Y"
+)
+
+var resolutionRegexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// NewResolution returns the resolution for a number of minutes, in the notation entsoe uses
+func NewResolution(minutes int) Resolution {
+	return Resolution(fmt.Sprintf("PT%vM", minutes))
+}
+
+// Parse splits the iso-8601 duration into calendar years and months, which vary in length, and a fixed duration for
+// the other units; all times are in utc, so days are taken as 24 hours
+func (r Resolution) Parse() (years, months int, duration time.Duration, err error) {
+
+	matches := resolutionRegexp.FindStringSubmatch(string(r))
+	if matches == nil || r == "P" || r[len(r)-1] == 'T' {
+		return 0, 0, 0, fmt.Errorf("Resolution %q is not an iso-8601 duration", r)
+	}
+
+	values := make([]int, len(matches))
+	for i, m := range matches[1:] {
+		if m == "" {
+			continue
+		}
+		values[i+1], err = strconv.Atoi(m)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("Resolution %q is not an iso-8601 duration: %w", r, err)
+		}
+	}
+
+	years, months = values[1], values[2]
+	duration = time.Duration(values[3])*7*24*time.Hour +
+		time.Duration(values[4])*24*time.Hour +
+		time.Duration(values[5])*time.Hour +
+		time.Duration(values[6])*time.Minute +
+		time.Duration(values[7])*time.Second
+
+	if years == 0 && months == 0 && duration == 0 {
+		return 0, 0, 0, fmt.Errorf("Resolution %q has no length", r)
+	}
+
+	return years, months, duration, nil
+}
+
+// GetDuration returns the length of a single point, or false if it's unknown or varies in length like P1M and P1Y
+func (r Resolution) GetDuration() (time.Duration, bool) {
+	years, months, duration, err := r.Parse()
+	if err != nil || years != 0 || months != 0 {
+		return 0, false
+	}
+
+	return duration, true
+}
+
+// GetMinutes returns the length of a single point in minutes if it's fixed and 0 otherwise
+func (r Resolution) GetMinutes() int {
+	duration, ok := r.GetDuration()
+	if !ok {
+		return 0
+	}
+
+	return int(duration.Minutes())
+}
+
+// AddTo returns the start of the nth point after t, taking the varying length of months and years into account
+func (r Resolution) AddTo(t time.Time, n int) (time.Time, bool) {
+	years, months, duration, err := r.Parse()
+	if err != nil {
+		return t, false
+	}
+
+	return t.AddDate(n*years, n*months, 0).Add(time.Duration(n) * duration), true
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestResolutionParse(t *testing.T) {
+	t.Run("ReturnsCalendarAndFixedParts", func(t *testing.T) {
+
+		testCases := []struct {
+			resolution Resolution
+			years      int
+			months     int
+			duration   time.Duration
+		}{
+			{ResolutionPT15M, 0, 0, 15 * time.Minute},
+			{ResolutionPT30M, 0, 0, 30 * time.Minute},
+			{ResolutionPT60M, 0, 0, time.Hour},
+			{Resolution("PT1H"), 0, 0, time.Hour},
+			{Resolution("PT1H30M"), 0, 0, 90 * time.Minute},
+			{ResolutionP1D, 0, 0, 24 * time.Hour},
+			{ResolutionP7D, 0, 0, 7 * 24 * time.Hour},
+			{Resolution("P1W"), 0, 0, 7 * 24 * time.Hour},
+			{ResolutionP1M, 0, 1, 0},
+			{ResolutionP1Y, 1, 0, 0},
+		}
+
+		for _, tc := range testCases {
+
+			// act
+			years, months, duration, err := tc.resolution.Parse()
+
+			assert.Nil(t, err, string(tc.resolution))
+			assert.Equal(t, tc.years, years, string(tc.resolution))
+			assert.Equal(t, tc.months, months, string(tc.resolution))
+			assert.Equal(t, tc.duration, duration, string(tc.resolution))
+		}
+	})
+
+	t.Run("ReturnsErrorForInvalidDuration", func(t *testing.T) {
+
+		for _, resolution := range []Resolution{ResolutionUnknown, "P", "PT", "P1DT", "PT0M", "15M", "PT15X"} {
+
+			// act
+			_, _, _, err := resolution.Parse()
+
+			assert.NotNil(t, err, string(resolution))
+		}
+	})
+}
+
+func TestResolutionGetDuration(t *testing.T) {
+	t.Run("ReturnsDurationForFixedLength", func(t *testing.T) {
+
+		// act
+		duration, ok := Resolution("PT1H").GetDuration()
+
+		assert.True(t, ok)
+		assert.Equal(t, time.Hour, duration)
+	})
+
+	t.Run("ReturnsFalseForVaryingLength", func(t *testing.T) {
+
+		// act
+		_, ok := ResolutionP1M.GetDuration()
+
+		assert.False(t, ok)
+	})
+}
+
+func TestResolutionAddTo(t *testing.T) {
+	t.Run("AddsMonthsOfVaryingLength", func(t *testing.T) {
+
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		// act
+		end, ok := ResolutionP1M.AddTo(start, 2)
+
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), end)
+	})
+
+	t.Run("AddsFixedDuration", func(t *testing.T) {
+
+		start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+
+		// act
+		end, ok := ResolutionPT15M.AddTo(start, 3)
+
+		assert.True(t, ok)
+		assert.Equal(t, start.Add(45*time.Minute), end)
+	})
+}
@@ -0,0 +1,12 @@
+package api
+
+import (
+	"time"
+)
+
+// Revision identifies the values last written for a time slot, to detect corrections published afterwards
+type Revision struct {
+	MeasuredAtTime time.Time
+	RevisionNumber int
+	Checksum       string
+}
@@ -1,11 +1,13 @@
 package api
 
 type Sample struct {
-	EnergyType         EnergyType
-	OriginalEnergyType string
-	IsRenewable        bool
-	MetricType         MetricType
-	SampleDirection    SampleDirection
-	SampleUnit         SampleUnit
-	Value              float64
+	EnergyType            EnergyType
+	OriginalEnergyType    string
+	IsRenewable           bool
+	MetricType            MetricType
+	SampleDirection       SampleDirection
+	SampleUnit            SampleUnit
+	Value                 float64
+	CarbonIntensity       float64
+	DirectCarbonIntensity float64
 }
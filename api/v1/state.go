@@ -5,5 +5,17 @@ import (
 )
 
 type State struct {
-	LastRetrievedGenerationTime map[Area]time.Time
+	LastRetrievedGenerationTime  map[Area]time.Time
+	LastRetrievedExchangeTime    map[Area]map[Area]time.Time
+	LastRetrievedBalanceTime     map[Area]time.Time
+	LastRetrievedLoadTime        map[Area]time.Time
+	LastRetrievedForecastTime    map[Area]map[ForecastType]time.Time
+	LastRetrievedPriceTime       map[Area]time.Time
+	LastRetrievedConsumptionTime time.Time
+	LastRetrievedCapacityTime    map[Area]time.Time
+	LastCheckedCapacityTime      map[Area]time.Time
+	// LastRetrievedCapacityChecksum holds a hash of the values of the last stored year, to only store a refresh that changed
+	LastRetrievedCapacityChecksum map[Area]string
+	GenerationGaps                map[Area][]time.Time
+	GenerationRevisions           map[Area][]Revision
 }
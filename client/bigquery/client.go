@@ -1,19 +1,32 @@
 package bigquery
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	googlebigquery "cloud.google.com/go/bigquery"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
 )
 
 var (
 	ErrIncorrectTypeMeasurement = errors.New("Type of measurement is incorrect")
 )
 
+const (
+	// stay below the limits for streaming inserts, see https://cloud.google.com/bigquery/quotas#streaming_inserts
+	maxRowsPerInsert    = 500
+	maxBytesPerInsert   = 9 * 1024 * 1024
+	maxRetriesPerInsert = 3
+)
+
 // Client is the interface for connecting to bigquery
 type Client interface {
 	CheckIfDatasetExists() (exists bool)
@@ -22,11 +35,20 @@ type Client interface {
 	UpdateTableSchema(typeForSchema interface{}) (err error)
 	DeleteTable() (err error)
 	InsertMeasurement(measurement interface{}) (err error)
+	InsertMeasurements(measurements interface{}) (err error)
 	InitBigqueryTable() (err error)
+	GetMaxTimes(timeColumn string, keyColumns ...string) (maxTimes []MaxTime, err error)
+	Close() (err error)
+}
+
+// MaxTime holds the latest time stored for a combination of values of the key columns
+type MaxTime struct {
+	Keys []string
+	Time time.Time
 }
 
 // NewClient returns new bigquery.Client
-func NewClient(projectID string, enable bool, dataset, table string, typeForSchema interface{}, partitionField string) (Client, error) {
+func NewClient(projectID string, enable bool, dataset, table string, typeForSchema interface{}, partitionField string, upsert bool) (Client, error) {
 
 	ctx := context.Background()
 
@@ -43,6 +65,7 @@ func NewClient(projectID string, enable bool, dataset, table string, typeForSche
 		table:          table,
 		typeForSchema:  typeForSchema,
 		partitionField: partitionField,
+		upsert:         upsert,
 	}, nil
 }
 
@@ -54,6 +77,7 @@ type client struct {
 	table          string
 	typeForSchema  interface{}
 	partitionField string
+	upsert         bool
 }
 
 func (c *client) CheckIfDatasetExists() (exists bool) {
@@ -148,8 +172,9 @@ func (c *client) UpdateTableSchema(typeForSchema interface{}) (err error) {
 		return err
 	}
 
+	// bigquery only allows adding nullable columns to an existing table
 	update := googlebigquery.TableMetadataToUpdate{
-		Schema: schema,
+		Schema: c.relaxAddedFields(meta.Schema, schema),
 	}
 	if _, err := tbl.Update(context.Background(), update, meta.ETag); err != nil {
 		return err
@@ -158,6 +183,32 @@ func (c *client) UpdateTableSchema(typeForSchema interface{}) (err error) {
 	return nil
 }
 
+func (c *client) relaxAddedFields(existingSchema, schema googlebigquery.Schema) googlebigquery.Schema {
+
+	if schema == nil {
+		return nil
+	}
+
+	existingFields := map[string]*googlebigquery.FieldSchema{}
+	for _, f := range existingSchema {
+		existingFields[f.Name] = f
+	}
+
+	relaxedSchema := googlebigquery.Schema{}
+	for _, f := range schema {
+		relaxedField := *f
+		if existingField, ok := existingFields[f.Name]; ok {
+			relaxedField.Schema = c.relaxAddedFields(existingField.Schema, f.Schema)
+		} else {
+			relaxedField.Required = false
+			relaxedField.Schema = c.relaxAddedFields(googlebigquery.Schema{}, f.Schema)
+		}
+		relaxedSchema = append(relaxedSchema, &relaxedField)
+	}
+
+	return relaxedSchema
+}
+
 func (c *client) DeleteTable() (err error) {
 
 	if !c.enable {
@@ -181,17 +232,276 @@ func (c *client) InsertMeasurement(measurement interface{}) (err error) {
 		return nil
 	}
 
+	if c.upsert {
+		return c.InsertMeasurements([]interface{}{measurement})
+	}
+
+	tbl := c.client.Dataset(c.dataset).Table(c.table)
+
+	u := tbl.Uploader()
+
+	if err := u.Put(context.Background(), c.toStructSavers([]interface{}{measurement})); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *client) InsertMeasurements(measurements interface{}) (err error) {
+
+	if !c.enable {
+		return nil
+	}
+
+	rows, err := c.toRows(measurements)
+	if err != nil {
+		return err
+	}
+
+	if c.upsert {
+		return c.upsertRows(rows)
+	}
+
+	chunks, err := c.chunkRows(rows, maxRowsPerInsert, maxBytesPerInsert)
+	if err != nil {
+		return err
+	}
+
 	tbl := c.client.Dataset(c.dataset).Table(c.table)
 
 	u := tbl.Uploader()
 
-	if err := u.Put(context.Background(), measurement); err != nil {
+	for _, chunk := range chunks {
+		err = c.putWithRetries(u, chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putWithRetries inserts all rows and retries only the rows that failed
+func (c *client) putWithRetries(u *googlebigquery.Uploader, rows []interface{}) (err error) {
+
+	for attempt := 0; ; attempt++ {
+		err = u.Put(context.Background(), c.toStructSavers(rows))
+		if err == nil {
+			return nil
+		}
+
+		failedRows, ok := c.getFailedRows(rows, err)
+		if !ok || attempt >= maxRetriesPerInsert {
+			return err
+		}
+
+		log.Warn().Err(err).Msgf("Inserting %v of %v rows into table %v.%v.%v failed, retrying...", len(failedRows), len(rows), c.projectID, c.dataset, c.table)
+
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+		rows = failedRows
+	}
+}
+
+// getFailedRows returns the rows reported in a PutMultiError, or false if err isn't one
+func (c *client) getFailedRows(rows []interface{}, err error) (failedRows []interface{}, ok bool) {
+
+	var multiErr googlebigquery.PutMultiError
+	if !errors.As(err, &multiErr) {
+		return nil, false
+	}
+
+	for _, rowErr := range multiErr {
+		if rowErr.RowIndex < 0 || rowErr.RowIndex >= len(rows) {
+			return nil, false
+		}
+		failedRows = append(failedRows, rows[rowErr.RowIndex])
+	}
+
+	return failedRows, len(failedRows) > 0
+}
+
+// toStructSavers sets the id of each measurement as insert id, so bigquery can deduplicate retried inserts
+func (c *client) toStructSavers(rows []interface{}) (savers []*googlebigquery.StructSaver) {
+	for _, r := range rows {
+		savers = append(savers, &googlebigquery.StructSaver{
+			Struct:   r,
+			InsertID: c.getID(r),
+		})
+	}
+
+	return savers
+}
+
+// getID returns the value of the ID field of a measurement, or an empty string if it has none
+func (c *client) getID(row interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	f := v.FieldByName("ID")
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return ""
+	}
+
+	return f.String()
+}
+
+// upsertRows loads the rows into a staging table and merges them into the table by id, so inserting the same
+// measurements again updates them instead of adding duplicates
+func (c *client) upsertRows(rows []interface{}) (err error) {
+
+	rows = c.deduplicateRows(rows)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	schema, err := googlebigquery.InferSchema(c.typeForSchema)
+	if err != nil {
 		return err
 	}
 
+	ctx := context.Background()
+
+	// create a staging table that expires by itself in case it doesn't get deleted
+	stagingTable := fmt.Sprintf("%v_staging_%v", c.table, strings.Replace(uuid.New().String(), "-", "", -1))
+	stagingTbl := c.client.Dataset(c.dataset).Table(stagingTable)
+	err = stagingTbl.Create(ctx, &googlebigquery.TableMetadata{
+		Schema:         schema,
+		ExpirationTime: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed creating staging table %v: %w", stagingTable, err)
+	}
+	defer func() {
+		if deleteErr := stagingTbl.Delete(ctx); deleteErr != nil {
+			log.Warn().Err(deleteErr).Msgf("Failed deleting staging table %v", stagingTable)
+		}
+	}()
+
+	// load the rows as newline delimited json
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, r := range rows {
+		err = encoder.Encode(r)
+		if err != nil {
+			return err
+		}
+	}
+	source := googlebigquery.NewReaderSource(&data)
+	source.SourceFormat = googlebigquery.JSON
+	source.Schema = schema
+
+	loader := stagingTbl.LoaderFrom(source)
+	loader.WriteDisposition = googlebigquery.WriteTruncate
+	err = c.runJob(ctx, loader.Run)
+	if err != nil {
+		return fmt.Errorf("Failed loading rows into staging table %v: %w", stagingTable, err)
+	}
+
+	// merge the staging table into the table
+	query := c.client.Query(c.getMergeQuery(stagingTable, schema))
+	err = c.runJob(ctx, query.Run)
+	if err != nil {
+		return fmt.Errorf("Failed merging staging table %v into table %v: %w", stagingTable, c.table, err)
+	}
+
+	log.Debug().Msgf("Upserted %v rows into table %v.%v.%v", len(rows), c.projectID, c.dataset, c.table)
+
 	return nil
 }
 
+func (c *client) runJob(ctx context.Context, run func(ctx context.Context) (*googlebigquery.Job, error)) (err error) {
+	job, err := run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	return status.Err()
+}
+
+// deduplicateRows keeps the last row for each id, because a merge fails if multiple rows match the same id
+func (c *client) deduplicateRows(rows []interface{}) (deduplicatedRows []interface{}) {
+	indexes := map[string]int{}
+	for _, r := range rows {
+		id := c.getID(r)
+		if i, ok := indexes[id]; ok && id != "" {
+			deduplicatedRows[i] = r
+			continue
+		}
+		indexes[id] = len(deduplicatedRows)
+		deduplicatedRows = append(deduplicatedRows, r)
+	}
+
+	return deduplicatedRows
+}
+
+// getMergeQuery names all columns explicitly, because columns added to an existing table are appended at the end, so they
+// can be in another order than in the staging table created from the current schema
+func (c *client) getMergeQuery(stagingTable string, schema googlebigquery.Schema) string {
+	updates := []string{}
+	columns := []string{}
+	values := []string{}
+	for _, f := range schema {
+		columns = append(columns, f.Name)
+		values = append(values, fmt.Sprintf("S.%v", f.Name))
+		if f.Name == "ID" {
+			continue
+		}
+		updates = append(updates, fmt.Sprintf("%v = S.%v", f.Name, f.Name))
+	}
+
+	return fmt.Sprintf("MERGE `%v.%v.%v` T USING `%v.%v.%v` S ON T.ID = S.ID WHEN MATCHED THEN UPDATE SET %v WHEN NOT MATCHED THEN INSERT (%v) VALUES (%v)", c.projectID, c.dataset, c.table, c.projectID, c.dataset, stagingTable, strings.Join(updates, ", "), strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// toRows converts a slice of measurements into separate rows
+func (c *client) toRows(measurements interface{}) (rows []interface{}, err error) {
+
+	v := reflect.ValueOf(measurements)
+	if v.Kind() != reflect.Slice {
+		return nil, ErrIncorrectTypeMeasurement
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		rows = append(rows, v.Index(i).Interface())
+	}
+
+	return rows, nil
+}
+
+// chunkRows splits rows into chunks that contain at most maxRows rows and approximately maxBytes bytes
+func (c *client) chunkRows(rows []interface{}, maxRows, maxBytes int) (chunks [][]interface{}, err error) {
+
+	chunk := []interface{}{}
+	chunkBytes := 0
+	for _, r := range rows {
+		// the json size of a row is a close estimate of its size in the insert request
+		data, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		rowBytes := len(data)
+
+		if len(chunk) > 0 && (len(chunk) >= maxRows || chunkBytes+rowBytes > maxBytes) {
+			chunks = append(chunks, chunk)
+			chunk = []interface{}{}
+			chunkBytes = 0
+		}
+
+		chunk = append(chunk, r)
+		chunkBytes += rowBytes
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
 func (c *client) InitBigqueryTable() (err error) {
 
 	log.Debug().Msgf("Checking if table %v.%v.%v exists...", c.projectID, c.dataset, c.table)
@@ -213,3 +523,52 @@ func (c *client) InitBigqueryTable() (err error) {
 
 	return nil
 }
+
+func (c *client) GetMaxTimes(timeColumn string, keyColumns ...string) (maxTimes []MaxTime, err error) {
+
+	if !c.enable {
+		return nil, nil
+	}
+
+	it, err := c.client.Query(c.getMaxTimesQuery(timeColumn, keyColumns)).Read(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Failed querying latest %v in table %v: %w", timeColumn, c.table, err)
+	}
+
+	for {
+		var row []googlebigquery.Value
+		err = it.Next(&row)
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the time is null if the table is empty
+		t, ok := row[len(keyColumns)].(time.Time)
+		if !ok {
+			continue
+		}
+
+		maxTime := MaxTime{Time: t}
+		for i := range keyColumns {
+			maxTime.Keys = append(maxTime.Keys, fmt.Sprint(row[i]))
+		}
+		maxTimes = append(maxTimes, maxTime)
+	}
+
+	return maxTimes, nil
+}
+
+func (c *client) getMaxTimesQuery(timeColumn string, keyColumns []string) string {
+	if len(keyColumns) == 0 {
+		return fmt.Sprintf("SELECT MAX(%v) FROM `%v.%v.%v`", timeColumn, c.projectID, c.dataset, c.table)
+	}
+
+	return fmt.Sprintf("SELECT %v, MAX(%v) FROM `%v.%v.%v` GROUP BY %v", strings.Join(keyColumns, ", "), timeColumn, c.projectID, c.dataset, c.table, strings.Join(keyColumns, ", "))
+}
+
+func (c *client) Close() (err error) {
+	return c.client.Close()
+}
@@ -0,0 +1,207 @@
+package bigquery
+
+import (
+	"fmt"
+	"testing"
+
+	googlebigquery "cloud.google.com/go/bigquery"
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToRows(t *testing.T) {
+
+	t.Run("ReturnsRowPerMeasurement", func(t *testing.T) {
+
+		client := &client{}
+		measurements := []apiv1.LoadMeasurement{{ID: "a"}, {ID: "b"}}
+
+		// act
+		rows, err := client.toRows(measurements)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(rows))
+		assert.Equal(t, "b", rows[1].(apiv1.LoadMeasurement).ID)
+	})
+
+	t.Run("ReturnsErrorIfNotASlice", func(t *testing.T) {
+
+		client := &client{}
+
+		// act
+		_, err := client.toRows(apiv1.LoadMeasurement{})
+
+		assert.Equal(t, ErrIncorrectTypeMeasurement, err)
+	})
+}
+
+func TestChunkRows(t *testing.T) {
+
+	t.Run("SplitsRowsByMaximumNumberOfRows", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{}
+		for i := 0; i < 1001; i++ {
+			rows = append(rows, apiv1.LoadMeasurement{ID: fmt.Sprint(i)})
+		}
+
+		// act
+		chunks, err := client.chunkRows(rows, 500, 1024*1024)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(chunks))
+		assert.Equal(t, 500, len(chunks[0]))
+		assert.Equal(t, 500, len(chunks[1]))
+		assert.Equal(t, 1, len(chunks[2]))
+	})
+
+	t.Run("SplitsRowsByMaximumNumberOfBytes", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{"aaaaaaaa", "bbbbbbbb", "cccccccc"}
+
+		// act
+		chunks, err := client.chunkRows(rows, 500, 25)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(chunks))
+		assert.Equal(t, 2, len(chunks[0]))
+		assert.Equal(t, 1, len(chunks[1]))
+	})
+
+	t.Run("KeepsRowLargerThanMaximumNumberOfBytesInOwnChunk", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{"aaaaaaaa", "bbbbbbbb"}
+
+		// act
+		chunks, err := client.chunkRows(rows, 500, 5)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(chunks))
+	})
+
+	t.Run("ReturnsNoChunksForNoRows", func(t *testing.T) {
+
+		client := &client{}
+
+		// act
+		chunks, err := client.chunkRows([]interface{}{}, 500, 1024)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(chunks))
+	})
+}
+
+func TestGetFailedRows(t *testing.T) {
+
+	t.Run("ReturnsRowsInPutMultiError", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{"a", "b", "c"}
+		err := googlebigquery.PutMultiError{
+			googlebigquery.RowInsertionError{RowIndex: 0},
+			googlebigquery.RowInsertionError{RowIndex: 2},
+		}
+
+		// act
+		failedRows, ok := client.getFailedRows(rows, err)
+
+		assert.True(t, ok)
+		assert.Equal(t, []interface{}{"a", "c"}, failedRows)
+	})
+
+	t.Run("ReturnsFalseForOtherErrors", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{"a", "b", "c"}
+
+		// act
+		_, ok := client.getFailedRows(rows, fmt.Errorf("Request failed"))
+
+		assert.False(t, ok)
+	})
+
+	t.Run("ReturnsFalseForRowIndexOutOfRange", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{"a"}
+		err := googlebigquery.PutMultiError{
+			googlebigquery.RowInsertionError{RowIndex: 3},
+		}
+
+		// act
+		_, ok := client.getFailedRows(rows, err)
+
+		assert.False(t, ok)
+	})
+}
+
+func TestGetMergeQuery(t *testing.T) {
+
+	t.Run("UpdatesAllColumnsExceptIDAndInsertsAllColumnsByName", func(t *testing.T) {
+
+		client := &client{projectID: "project", dataset: "dataset", table: "table"}
+		schema := googlebigquery.Schema{{Name: "ID"}, {Name: "Area"}, {Name: "MeasuredAtTime"}}
+
+		// act
+		query := client.getMergeQuery("table_staging", schema)
+
+		assert.Equal(t, "MERGE `project.dataset.table` T USING `project.dataset.table_staging` S ON T.ID = S.ID WHEN MATCHED THEN UPDATE SET Area = S.Area, MeasuredAtTime = S.MeasuredAtTime WHEN NOT MATCHED THEN INSERT (ID, Area, MeasuredAtTime) VALUES (S.ID, S.Area, S.MeasuredAtTime)", query)
+	})
+}
+
+func TestDeduplicateRows(t *testing.T) {
+
+	t.Run("KeepsLastRowPerID", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{apiv1.LoadMeasurement{ID: "a", Area: "1"}, apiv1.LoadMeasurement{ID: "b"}, apiv1.LoadMeasurement{ID: "a", Area: "2"}}
+
+		// act
+		deduplicatedRows := client.deduplicateRows(rows)
+
+		assert.Equal(t, 2, len(deduplicatedRows))
+		assert.Equal(t, "2", deduplicatedRows[0].(apiv1.LoadMeasurement).Area)
+		assert.Equal(t, "b", deduplicatedRows[1].(apiv1.LoadMeasurement).ID)
+	})
+}
+
+func TestToStructSavers(t *testing.T) {
+
+	t.Run("SetsIDAsInsertID", func(t *testing.T) {
+
+		client := &client{}
+		rows := []interface{}{apiv1.LoadMeasurement{ID: "a"}, &apiv1.LoadMeasurement{ID: "b"}}
+
+		// act
+		savers := client.toStructSavers(rows)
+
+		assert.Equal(t, 2, len(savers))
+		assert.Equal(t, "a", savers[0].InsertID)
+		assert.Equal(t, "b", savers[1].InsertID)
+	})
+}
+
+func TestGetMaxTimesQuery(t *testing.T) {
+
+	t.Run("GroupsByKeyColumns", func(t *testing.T) {
+
+		client := &client{projectID: "project", dataset: "dataset", table: "table"}
+
+		// act
+		query := client.getMaxTimesQuery("MeasuredAtTime", []string{"Area", "ExchangeWithArea"})
+
+		assert.Equal(t, "SELECT Area, ExchangeWithArea, MAX(MeasuredAtTime) FROM `project.dataset.table` GROUP BY Area, ExchangeWithArea", query)
+	})
+
+	t.Run("ReturnsOverallMaximumWithoutKeyColumns", func(t *testing.T) {
+
+		client := &client{projectID: "project", dataset: "dataset", table: "table"}
+
+		// act
+		query := client.getMaxTimesQuery("MeasuredAtTime", nil)
+
+		assert.Equal(t, "SELECT MAX(MeasuredAtTime) FROM `project.dataset.table`", query)
+	})
+}
@@ -0,0 +1,169 @@
+package bigquery
+
+import (
+	"fmt"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/sink"
+	"github.com/rs/zerolog/log"
+)
+
+// NewSinkClient returns new sink.Client that stores each measurement stream in its own bigquery table
+func NewSinkClient(clients map[apiv1.MeasurementStream]Client, init, upsert bool) (sink.Client, error) {
+	return &sinkClient{
+		clients: clients,
+		init:    init,
+		upsert:  upsert,
+	}, nil
+}
+
+type sinkClient struct {
+	clients map[apiv1.MeasurementStream]Client
+	init    bool
+	upsert  bool
+}
+
+func (c *sinkClient) Init() (err error) {
+
+	if !c.init {
+		return nil
+	}
+
+	for stream, client := range c.clients {
+		err = client.InitBigqueryTable()
+		if err != nil {
+			return fmt.Errorf("Failed initializing bigquery table for %v measurements: %w", stream, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *sinkClient) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	client, ok := c.clients[stream]
+	if !ok {
+		log.Debug().Msgf("Measurements for stream %v are not stored in bigquery, skipping", stream)
+		return nil
+	}
+
+	return client.InsertMeasurements(measurements)
+}
+
+// Upserts returns whether measurements are merged by id; streamed inserts add a duplicate row for an existing id
+func (c *sinkClient) Upserts() bool {
+	return c.upsert
+}
+
+func (c *sinkClient) Close() (err error) {
+	for stream, client := range c.clients {
+		if closeErr := client.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Failed closing bigquery client for %v measurements: %w", stream, closeErr)
+		}
+	}
+
+	return err
+}
+
+// ReadStoredState derives the state from the latest time slot stored in each table
+func (c *sinkClient) ReadStoredState() (state *apiv1.State, err error) {
+
+	state = &apiv1.State{}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamGeneration]; ok {
+		state.LastRetrievedGenerationTime, err = c.getMaxTimePerArea(client, "MeasuredAtTime")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamExchange]; ok {
+		maxTimes, err := client.GetMaxTimes("MeasuredAtTime", "Area", "ExchangeWithArea")
+		if err != nil {
+			return nil, err
+		}
+		state.LastRetrievedExchangeTime = map[apiv1.Area]map[apiv1.Area]time.Time{}
+		for _, mt := range maxTimes {
+			if state.LastRetrievedExchangeTime[apiv1.Area(mt.Keys[0])] == nil {
+				state.LastRetrievedExchangeTime[apiv1.Area(mt.Keys[0])] = map[apiv1.Area]time.Time{}
+			}
+			state.LastRetrievedExchangeTime[apiv1.Area(mt.Keys[0])][apiv1.Area(mt.Keys[1])] = mt.Time
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamBalance]; ok {
+		state.LastRetrievedBalanceTime, err = c.getMaxTimePerArea(client, "MeasuredAtTime")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamLoad]; ok {
+		state.LastRetrievedLoadTime, err = c.getMaxTimePerArea(client, "MeasuredAtTime")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamForecast]; ok {
+		maxTimes, err := client.GetMaxTimes("ForecastForTime", "Area", "ForecastType")
+		if err != nil {
+			return nil, err
+		}
+		state.LastRetrievedForecastTime = map[apiv1.Area]map[apiv1.ForecastType]time.Time{}
+		for _, mt := range maxTimes {
+			if state.LastRetrievedForecastTime[apiv1.Area(mt.Keys[0])] == nil {
+				state.LastRetrievedForecastTime[apiv1.Area(mt.Keys[0])] = map[apiv1.ForecastType]time.Time{}
+			}
+			state.LastRetrievedForecastTime[apiv1.Area(mt.Keys[0])][apiv1.ForecastType(mt.Keys[1])] = mt.Time
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamPrice]; ok {
+		state.LastRetrievedPriceTime, err = c.getMaxTimePerArea(client, "MeasuredAtTime")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamConsumption]; ok {
+		maxTimes, err := client.GetMaxTimes("MeasuredAtTime")
+		if err != nil {
+			return nil, err
+		}
+		for _, mt := range maxTimes {
+			state.LastRetrievedConsumptionTime = mt.Time
+		}
+	}
+
+	if client, ok := c.clients[apiv1.MeasurementStreamCapacity]; ok {
+		maxTimes, err := client.GetMaxTimes("MeasuredAtTime", "Area")
+		if err != nil {
+			return nil, err
+		}
+		state.LastRetrievedCapacityTime = map[apiv1.Area]time.Time{}
+		for _, mt := range maxTimes {
+			// the stored time is the start of the year in local time, which in utc can fall in the previous year
+			year := mt.Time.Add(24 * time.Hour).Year()
+			state.LastRetrievedCapacityTime[apiv1.Area(mt.Keys[0])] = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	return state, nil
+}
+
+func (c *sinkClient) getMaxTimePerArea(client Client, timeColumn string) (maxTimePerArea map[apiv1.Area]time.Time, err error) {
+
+	maxTimes, err := client.GetMaxTimes(timeColumn, "Area")
+	if err != nil {
+		return nil, err
+	}
+
+	maxTimePerArea = map[apiv1.Area]time.Time{}
+	for _, mt := range maxTimes {
+		maxTimePerArea[apiv1.Area(mt.Keys[0])] = mt.Time
+	}
+
+	return maxTimePerArea, nil
+}
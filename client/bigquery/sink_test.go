@@ -0,0 +1,66 @@
+package bigquery
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	Client
+	maxTimes map[string][]MaxTime
+}
+
+func (f *fakeClient) GetMaxTimes(timeColumn string, keyColumns ...string) ([]MaxTime, error) {
+	return f.maxTimes[timeColumn], nil
+}
+
+func TestInsertMeasurements(t *testing.T) {
+
+	t.Run("SkipsStreamWithoutTable", func(t *testing.T) {
+
+		client, _ := NewSinkClient(map[apiv1.MeasurementStream]Client{
+			apiv1.MeasurementStreamGeneration: &fakeClient{},
+		}, false, false)
+
+		// act
+		err := client.InsertMeasurements(apiv1.MeasurementStreamPrice, []apiv1.PriceMeasurement{{}})
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestReadStoredState(t *testing.T) {
+
+	t.Run("ReturnsLatestTimePerArea", func(t *testing.T) {
+
+		measuredAtTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		client, _ := NewSinkClient(map[apiv1.MeasurementStream]Client{
+			apiv1.MeasurementStreamGeneration: &fakeClient{maxTimes: map[string][]MaxTime{"MeasuredAtTime": {{Keys: []string{string(apiv1.AreaNetherlands)}, Time: measuredAtTime}}}},
+			apiv1.MeasurementStreamForecast:   &fakeClient{maxTimes: map[string][]MaxTime{"ForecastForTime": {{Keys: []string{string(apiv1.AreaNetherlands), "WindAndSolar"}, Time: measuredAtTime}}}},
+		}, false, false)
+
+		// act
+		state, err := client.(*sinkClient).ReadStoredState()
+
+		assert.Nil(t, err)
+		assert.Equal(t, measuredAtTime, state.LastRetrievedGenerationTime[apiv1.AreaNetherlands])
+		assert.Equal(t, measuredAtTime, state.LastRetrievedForecastTime[apiv1.AreaNetherlands][apiv1.ForecastType("WindAndSolar")])
+		assert.Nil(t, state.LastRetrievedLoadTime)
+	})
+
+	t.Run("ReturnsStartOfYearForCapacityStoredInLocalTime", func(t *testing.T) {
+
+		client, _ := NewSinkClient(map[apiv1.MeasurementStream]Client{
+			apiv1.MeasurementStreamCapacity: &fakeClient{maxTimes: map[string][]MaxTime{"MeasuredAtTime": {{Keys: []string{string(apiv1.AreaNetherlands)}, Time: time.Date(2020, 12, 31, 23, 0, 0, 0, time.UTC)}}}},
+		}, false, false)
+
+		// act
+		state, err := client.(*sinkClient).ReadStoredState()
+
+		assert.Nil(t, err)
+		assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), state.LastRetrievedCapacityTime[apiv1.AreaNetherlands])
+	})
+}
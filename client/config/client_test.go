@@ -29,6 +29,16 @@ func TestReadConfigFromFile(t *testing.T) {
 		assert.Equal(t, apiv1.AreaBelgium, config.Areas[0].Exchanges[0].Area)
 		assert.Equal(t, apiv1.CountryCodeBelgium, config.Areas[0].Exchanges[0].Country)
 		assert.Equal(t, 60, config.Areas[0].Exchanges[0].ResolutionMinutes)
+		assert.Equal(t, 60, config.Areas[0].GetBalanceResolutionMinutes())
+		assert.Equal(t, []apiv1.ForecastType{apiv1.ForecastTypeWindAndSolar, apiv1.ForecastTypeLoad}, config.Areas[0].Forecasts)
+		assert.Equal(t, 48, config.Areas[0].GapLookbackHours)
+		assert.Equal(t, []apiv1.PsrType{apiv1.PsrTypeNuclear, apiv1.PsrTypeSolar}, config.Areas[0].ExpectedProductionTypes)
+		assert.Equal(t, 0, config.Areas[1].GapLookbackHours)
+
+		assert.Equal(t, apiv1.EmissionFactor{Lifecycle: 450, Direct: 350}, config.Areas[0].GetEmissionFactor(apiv1.EnergyTypeGas, apiv1.PsrTypeFossilGas))
+		assert.Equal(t, apiv1.EmissionFactor{Lifecycle: 1050, Direct: 1000}, config.Areas[0].GetEmissionFactor(apiv1.EnergyTypeCoal, apiv1.PsrTypeFossilBrownCoal))
+		assert.Equal(t, apiv1.EnergyTypeCoal.GetDefaultEmissionFactor(), config.Areas[0].GetEmissionFactor(apiv1.EnergyTypeCoal, apiv1.PsrTypeFossilHardCoal))
+		assert.Equal(t, apiv1.EnergyTypeGas.GetDefaultEmissionFactor(), config.Areas[1].GetEmissionFactor(apiv1.EnergyTypeGas, apiv1.PsrTypeFossilGas))
 	})
 }
 
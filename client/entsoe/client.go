@@ -1,44 +1,96 @@
 package entsoe
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
 	"github.com/rs/zerolog/log"
-	"github.com/sethgrid/pester"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultBaseURL is the endpoint of the transparency platform restful api
+	DefaultBaseURL = "https://transparency.entsoe.eu/api"
 )
 
 var (
-	ErrNoMatchingDataFound = errors.New("No matching data found")
+	// DefaultRetryPolicy retries transient failures a few times, backing off from 1 up to 30 seconds
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
 )
 
+// RetryPolicy controls how often requests failing with a network error, rate limiting or 5xx status are retried, with exponential backoff in between
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
 type Client interface {
-	GetAggregatedGenerationPerType(area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetAggregatedGenerationPerTypeResponse, err error)
-	GetPhysicalCrossBorderFlow(area apiv1.Area, areaPeer apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetPhysicalCrossBorderFlowResponse, err error)
+	GetAggregatedGenerationPerType(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetAggregatedGenerationPerTypeResponse, err error)
+	GetPhysicalCrossBorderFlow(ctx context.Context, area apiv1.Area, areaPeer apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetPhysicalCrossBorderFlowResponse, err error)
+	GetActualTotalLoad(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetActualTotalLoadResponse, err error)
+	GetWindAndSolarForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetWindAndSolarForecastResponse, err error)
+	GetGenerationForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetGenerationForecastResponse, err error)
+	GetLoadForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetLoadForecastResponse, err error)
+	GetDayAheadPrices(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetDayAheadPricesResponse, err error)
+	GetInstalledGenerationCapacityAggregated(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetInstalledGenerationCapacityAggregatedResponse, err error)
 }
 
-func NewClient(securityToken string) (Client, error) {
+func NewClient(httpClient *http.Client, baseURL, securityToken string, requestsPerMinute int, retryPolicy RetryPolicy) (Client, error) {
+	if httpClient == nil {
+		return nil, fmt.Errorf("Http client is nil, please provide a client")
+	}
+	if _, err := url.ParseRequestURI(baseURL); err != nil {
+		return nil, fmt.Errorf("Base url %v is invalid: %w", baseURL, err)
+	}
 	if securityToken == "" {
 		return nil, fmt.Errorf("Token is empty, please provide a valid api token for transparency.entsoe.eu")
 	}
+	if requestsPerMinute <= 0 {
+		return nil, fmt.Errorf("Requests per minute is %v, please provide a positive limit", requestsPerMinute)
+	}
+	if retryPolicy.MaxAttempts <= 0 {
+		return nil, fmt.Errorf("Max attempts is %v, please allow at least one attempt", retryPolicy.MaxAttempts)
+	}
+	if retryPolicy.InitialBackoff < 0 || retryPolicy.MaxBackoff < retryPolicy.InitialBackoff {
+		return nil, fmt.Errorf("Backoff from %v up to %v is invalid, please provide a positive range", retryPolicy.InitialBackoff, retryPolicy.MaxBackoff)
+	}
 
 	return &client{
-		apiBaseURL:    "https://transparency.entsoe.eu/api",
+		httpClient:    httpClient,
+		apiBaseURL:    baseURL,
 		securityToken: securityToken,
+		retryPolicy:   retryPolicy,
+		// a single token bucket shared by all callers, without bursts so the limit holds for any minute
+		limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), 1),
 	}, nil
 }
 
 type client struct {
+	httpClient    *http.Client
 	apiBaseURL    string
 	securityToken string
+	retryPolicy   RetryPolicy
+	limiter       *rate.Limiter
 }
 
-func (c *client) GetAggregatedGenerationPerType(area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetAggregatedGenerationPerTypeResponse, err error) {
+func (c *client) GetAggregatedGenerationPerType(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetAggregatedGenerationPerTypeResponse, err error) {
 
 	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_aggregated_generation_per_type_16_1_b_c
 
@@ -59,83 +111,397 @@ func (c *client) GetAggregatedGenerationPerType(area apiv1.Area, timeInterval ap
 
 	log.Info().Msgf("Getting aggregated generation per type for in domain %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
 
-	getAggregatedGenerationPerTypeURL := fmt.Sprintf("%v?securityToken=%v&documentType=%v&processType=%v&in_Domain=%v&timeInterval=%v", c.apiBaseURL, c.securityToken, apiv1.DocumentTypeActualGenerationPerType, apiv1.ProcessTypeRealised, area, timeInterval.FormatAsParameter())
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypeActualGenerationPerType)},
+		"processType":  {string(apiv1.ProcessTypeRealised)},
+		"in_Domain":    {string(area)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
 
-	log.Debug().Msgf("GET %v", strings.Replace(getAggregatedGenerationPerTypeURL, c.securityToken, "***", -1))
+func (c *client) GetPhysicalCrossBorderFlow(ctx context.Context, area apiv1.Area, areaPeer apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetPhysicalCrossBorderFlowResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_physical_flows_12_1_g
 
-	resp, err := pester.Get(getAggregatedGenerationPerTypeURL)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
+	// 4.2.15. Physical Flows [12.1.G]
+	// - One year range limit applies
+	// - Minimum time interval in query response is MTU period
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - In_Domain
+	//   - Out_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+	// - Data are provided without netting because only one direction is requested
 
-	if resp.StatusCode != http.StatusOK {
+	log.Info().Msgf("Getting physical flow between domain %v and domain %v and time interval %v to %v...", area, areaPeer, timeInterval.Start, timeInterval.End)
 
-		log.Debug().Str("body", string(body)).Msgf("%v GET %v", resp.StatusCode, strings.Replace(getAggregatedGenerationPerTypeURL, c.securityToken, "***", -1))
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypeAggregatedEnergyDataReport)},
+		"in_Domain":    {string(area)},
+		"out_Domain":   {string(areaPeer)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
 
-		if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "No matching data found") {
-			return response, ErrNoMatchingDataFound
-		}
+	return
+}
 
-		return response, fmt.Errorf("Request returned unexpected status code %v", resp.StatusCode)
-	}
+func (c *client) GetActualTotalLoad(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetActualTotalLoadResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_actual_total_load_6_1_a
 
-	err = xml.Unmarshal(body, &response)
-	if err != nil {
-		return
-	}
+	// 4.1.1. Actual Total Load [6.1.A]
+	// - One year range limit applies
+	// - Minimum time interval in query response is one MTU period
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - ProcessType
+	//   - OutBiddingZone_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+
+	log.Info().Msgf("Getting actual total load for out bidding zone %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType":          {string(apiv1.DocumentTypeSystemTotalLoad)},
+		"processType":           {string(apiv1.ProcessTypeRealised)},
+		"outBiddingZone_Domain": {string(area)},
+		"timeInterval":          {timeInterval.FormatAsParameter()},
+	}, &response)
 
 	return
 }
 
-func (c *client) GetPhysicalCrossBorderFlow(area apiv1.Area, areaPeer apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetPhysicalCrossBorderFlowResponse, err error) {
-	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_physical_flows_12_1_g
+func (c *client) GetWindAndSolarForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetWindAndSolarForecastResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_generation_forecasts_for_wind_and_solar_14_1_d
 
-	// 4.2.15. Physical Flows [12.1.G]
+	// 4.4.4. Generation Forecasts for Wind and Solar [14.1.D]
 	// - One year range limit applies
-	// - Minimum time interval in query response is MTU period
+	// - Minimum time interval in query response is one day
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - ProcessType
+	//   - In_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+	// - Optional parameters
+	//   - PsrType (When used, only queried production type is returned)
+
+	log.Info().Msgf("Getting wind and solar forecast for in domain %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypeWindAndSolarForecast)},
+		"processType":  {string(apiv1.ProcessTypeDayAhead)},
+		"in_Domain":    {string(area)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
+
+func (c *client) GetGenerationForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetGenerationForecastResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_generation_forecast_14_1_c
+
+	// 4.4.3. Generation Forecast - Day ahead [14.1.C]
+	// - One year range limit applies
+	// - Minimum time interval in query response is one day
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - ProcessType
+	//   - In_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+
+	// Please note that time series with inBiddingZone_Domain reflect generation, while outBiddingZone_Domain reflects consumption.
+
+	log.Info().Msgf("Getting generation forecast for in domain %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypeGenerationForecast)},
+		"processType":  {string(apiv1.ProcessTypeDayAhead)},
+		"in_Domain":    {string(area)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
+
+func (c *client) GetLoadForecast(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetLoadForecastResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_day_ahead_total_load_forecast_6_1_b
+
+	// 4.1.2. Day-Ahead Total Load Forecast [6.1.B]
+	// - One year range limit applies
+	// - Minimum time interval in query response is one day
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - ProcessType
+	//   - OutBiddingZone_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+
+	log.Info().Msgf("Getting load forecast for out bidding zone %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType":          {string(apiv1.DocumentTypeSystemTotalLoad)},
+		"processType":           {string(apiv1.ProcessTypeDayAhead)},
+		"outBiddingZone_Domain": {string(area)},
+		"timeInterval":          {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
+
+func (c *client) GetDayAheadPrices(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetDayAheadPricesResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_day_ahead_prices_12_1_d
+
+	// 4.2.10. Day Ahead Prices [12.1.D]
+	// - One year range limit applies
+	// - Minimum time interval in query response is one day
 	// - Mandatory parameters
 	//   - DocumentType
 	//   - In_Domain
 	//   - Out_Domain
 	//   - TimeInterval or combination of PeriodStart and PeriodEnd
-	// - Data are provided without netting because only one direction is requested
+	// - In_Domain and Out_Domain must be populated with the same bidding zone
 
-	log.Info().Msgf("Getting physical flow between domain %v and domain %v and time interval %v to %v...", area, areaPeer, timeInterval.Start, timeInterval.End)
+	log.Info().Msgf("Getting day ahead prices for bidding zone %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypePriceDocument)},
+		"in_Domain":    {string(area)},
+		"out_Domain":   {string(area)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
+
+func (c *client) GetInstalledGenerationCapacityAggregated(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (response apiv1.GetInstalledGenerationCapacityAggregatedResponse, err error) {
+	// https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_installed_generation_capacity_aggregated_14_1_a
+
+	// 4.4.1. Installed Generation Capacity Aggregated [14.1.A]
+	// - One year range limit applies
+	// - Minimum time interval in query response is one year
+	// - Mandatory parameters
+	//   - DocumentType
+	//   - ProcessType
+	//   - In_Domain
+	//   - TimeInterval or combination of PeriodStart and PeriodEnd
+	// - Optional parameters
+	//   - PsrType (When used, only queried production type is returned)
+
+	log.Info().Msgf("Getting installed generation capacity aggregated for in domain %v and time interval %v to %v...", area, timeInterval.Start, timeInterval.End)
+
+	err = c.getDocument(ctx, url.Values{
+		"documentType": {string(apiv1.DocumentTypeInstalledGenerationPerType)},
+		"processType":  {string(apiv1.ProcessTypeYearAhead)},
+		"in_Domain":    {string(area)},
+		"timeInterval": {timeInterval.FormatAsParameter()},
+	}, &response)
+
+	return
+}
+
+// getDocument requests the document matching the query parameters and unmarshals the returned xml into response; transient
+// failures are retried according to the retry policy and cancelling the context aborts both waiting and in-flight requests
+func (c *client) getDocument(ctx context.Context, params url.Values, response interface{}) (err error) {
+
+	// the token is added last, so the logged query never contains it
+	loggedURL := c.apiBaseURL + "?" + params.Encode()
+	query := url.Values{"securityToken": {c.securityToken}}
+	for k, v := range params {
+		query[k] = v
+	}
+	requestURL := c.apiBaseURL + "?" + query.Encode()
+
+	backoff := c.retryPolicy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		statusCode, header, body, err := c.get(ctx, requestURL, loggedURL)
+		if err == nil {
+			err = c.checkResponse(statusCode, body)
+			if err == nil {
+				return c.unmarshalDocuments(header, body, response)
+			}
+			log.Debug().Str("body", string(body)).Msgf("%v GET %v", statusCode, loggedURL)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !isRetryable(statusCode, err) || attempt >= c.retryPolicy.MaxAttempts {
+			return err
+		}
+
+		// back off at least as long as the api asks for when rate limiting
+		wait := backoff
+		if retryAfter := getRetryAfter(header); retryAfter > wait {
+			wait = retryAfter
+		}
+
+		log.Warn().Err(err).Msgf("Attempt %v of %v for GET %v failed, retrying in %v", attempt, c.retryPolicy.MaxAttempts, loggedURL, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > c.retryPolicy.MaxBackoff {
+			backoff = c.retryPolicy.MaxBackoff
+		}
+	}
+}
 
-	getPhysicalCrossBorderFlowURL := fmt.Sprintf("%v?securityToken=%v&documentType=%v&in_Domain=%v&out_Domain=%v&timeInterval=%v", c.apiBaseURL, c.securityToken, apiv1.DocumentTypeAggregatedEnergyDataReport, area, areaPeer, timeInterval.FormatAsParameter())
+// get executes a single request after waiting for the shared rate limiter and returns the status code, headers and body
+func (c *client) get(ctx context.Context, requestURL, loggedURL string) (statusCode int, header http.Header, body []byte, err error) {
 
-	log.Debug().Msgf("GET %v", strings.Replace(getPhysicalCrossBorderFlowURL, c.securityToken, "***", -1))
+	// wait for the shared rate limiter, to stay within the limits of the api
+	err = c.limiter.Wait(ctx)
+	if err != nil {
+		return
+	}
 
-	resp, err := pester.Get(getPhysicalCrossBorderFlowURL)
+	log.Debug().Msgf("GET %v", loggedURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
 		return
 	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// the url in the error contains the token
+		return 0, nil, nil, errors.New(strings.Replace(err.Error(), url.QueryEscape(c.securityToken), "***", -1))
+	}
 	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+
+	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// checkResponse returns the reason a query has been rejected for, entsoe explains it in an acknowledgement document
+// that's even returned with status code 200 by some endpoints
+func (c *client) checkResponse(statusCode int, body []byte) error {
+
+	if acknowledgementErr, ok := apiv1.ParseAcknowledgement(statusCode, body); ok {
+		return acknowledgementErr
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("Request returned status code %v, please provide a valid api token for transparency.entsoe.eu: %w", statusCode, apiv1.ErrUnauthorized)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("Request returned status code %v: %w", statusCode, apiv1.ErrRateLimited)
+	}
+
+	return fmt.Errorf("Request returned unexpected status code %v", statusCode)
+}
+
+// unmarshalDocuments unmarshals the xml document into response, or if it's a zip archive all documents in it, merged into one
+func (c *client) unmarshalDocuments(header http.Header, body []byte, response interface{}) (err error) {
+
+	if !isZip(header, body) {
+		return xml.Unmarshal(body, response)
+	}
 
-		log.Debug().Str("body", string(body)).Msgf("%v GET %v", resp.StatusCode, strings.Replace(getPhysicalCrossBorderFlowURL, c.securityToken, "***", -1))
+	documents, err := unzip(body)
+	if err != nil {
+		return
+	}
 
-		if resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "No matching data found") {
-			return response, ErrNoMatchingDataFound
+	document, ok := response.(apiv1.Document)
+	if !ok {
+		return fmt.Errorf("Response of type %T can't be merged from %v documents", response, len(documents))
+	}
+
+	var timePeriod apiv1.TimeInterval
+	nrOfMergedDocuments := 0
+	for _, d := range documents {
+		// archives can hold acknowledgements for parts of the interval without data
+		if acknowledgementErr, ok := apiv1.ParseAcknowledgement(http.StatusOK, d); ok {
+			if errors.Is(acknowledgementErr, apiv1.ErrNoMatchingDataFound) {
+				continue
+			}
+			return acknowledgementErr
 		}
 
-		return response, fmt.Errorf("Request returned unexpected status code %v", resp.StatusCode)
+		// time series of later documents are appended to the earlier ones, but the time period is overwritten
+		err = xml.Unmarshal(d, response)
+		if err != nil {
+			return
+		}
+		timePeriod.Extend(*document.GetTimePeriod())
+		nrOfMergedDocuments++
 	}
 
-	err = xml.Unmarshal(body, &response)
+	if nrOfMergedDocuments == 0 {
+		return apiv1.ErrNoMatchingDataFound
+	}
+
+	*document.GetTimePeriod() = timePeriod
+
+	log.Debug().Msgf("Merged %v of %v documents from zip archive", nrOfMergedDocuments, len(documents))
+
+	return nil
+}
+
+// isZip returns true if the body is a zip archive, checking the content type as well as the signature
+func isZip(header http.Header, body []byte) bool {
+	return strings.HasPrefix(header.Get("Content-Type"), "application/zip") || bytes.HasPrefix(body, []byte("PK\x03\x04"))
+}
+
+// unzip returns the content of all files in the zip archive, in the order of their names
+func unzip(body []byte) (documents [][]byte, err error) {
+
+	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
 	if err != nil {
 		return
 	}
 
-	return
+	files := append([]*zip.File{}, reader.File...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		document, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		documents = append(documents, document)
+	}
+
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("Zip archive contains no documents")
+	}
+
+	return documents, nil
+}
+
+// isRetryable returns true for network errors, rate limiting and server side errors, other responses won't change on retry
+func isRetryable(statusCode int, err error) bool {
+	return statusCode == 0 || statusCode >= http.StatusInternalServerError || errors.Is(err, apiv1.ErrRateLimited)
+}
+
+// getRetryAfter returns the delay in seconds from the retry-after header, or zero if it's missing or a date
+func getRetryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
 }
@@ -1,7 +1,16 @@
 package entsoe
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,9 +24,12 @@ func TestGetAggregatedGenerationPerType(t *testing.T) {
 		if testing.Short() {
 			t.Skip("skipping test in short mode.")
 		}
+		if os.Getenv("ENTSOE_TOKEN") == "" {
+			t.Skip("skipping test without ENTSOE_TOKEN.")
+		}
 
 		// set first with 'export ENTSOE_TOKEN=...'
-		client, err := NewClient(os.Getenv("ENTSOE_TOKEN"))
+		client, err := NewClient(&http.Client{Timeout: time.Minute}, DefaultBaseURL, os.Getenv("ENTSOE_TOKEN"), 400, DefaultRetryPolicy)
 		assert.Nil(t, err)
 
 		area := apiv1.AreaNetherlands
@@ -33,9 +45,292 @@ func TestGetAggregatedGenerationPerType(t *testing.T) {
 		}
 
 		// act
-		response, err := client.GetAggregatedGenerationPerType(area, timeInterval)
+		response, err := client.GetAggregatedGenerationPerType(context.Background(), area, timeInterval)
 
 		assert.Nil(t, err)
 		assert.Equal(t, "", response)
 	})
+
+	testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
+	timeInterval := apiv1.TimeInterval{
+		Start: time.Date(2020, 3, 18, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2020, 3, 19, 0, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("ReturnsRecordedResponse", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(testResponse)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		response, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 39, len(response.TimeSeries))
+		assert.Equal(t, timeInterval.Start, response.TimePeriod.Start)
+	})
+
+	t.Run("EscapesQueryParameters", func(t *testing.T) {
+
+		var query map[string][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			_, _ = w.Write(testResponse)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "a&b=c+d")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"a&b=c+d"}, query["securityToken"])
+		assert.Equal(t, []string{"A75"}, query["documentType"])
+		assert.Equal(t, []string{"A16"}, query["processType"])
+		assert.Equal(t, []string{"10YNL----------L"}, query["in_Domain"])
+		assert.Equal(t, []string{"2020-03-18T00:00Z/2020-03-19T00:00Z"}, query["timeInterval"])
+	})
+
+	t.Run("RetriesServerErrors", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write(testResponse)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		response, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+		assert.Equal(t, 39, len(response.TimeSeries))
+	})
+
+	t.Run("GivesUpAfterMaxAttempts", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("ReturnsErrNoMatchingDataFoundWithoutRetrying", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(getAcknowledgementDocument("No matching data found for Data item ACTUAL_GENERATION_PER_PRODUCTION_TYPE [16.1.B&amp;C] (10YNL----------L) and interval 2020-03-18T00:00:00.000Z/2020-03-19T00:00:00.000Z."))
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.True(t, errors.Is(err, apiv1.ErrNoMatchingDataFound))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("ReturnsErrQueryTooLargeWithoutRetrying", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(getAcknowledgementDocument("The amount of requested data exceeds allowed limit. Requested 400 documents but only 200 are allowed."))
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		var acknowledgementErr *apiv1.AcknowledgementError
+		assert.True(t, errors.As(err, &acknowledgementErr))
+		assert.Equal(t, apiv1.ReasonCodeOther, acknowledgementErr.ReasonCode)
+		assert.True(t, errors.Is(err, apiv1.ErrQueryTooLarge))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("RetriesWhenRateLimited", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write(getAcknowledgementDocument("Max allowed requests per minute from each unique IP is up to 400 only."))
+				return
+			}
+			_, _ = w.Write(testResponse)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("ReturnsErrUnauthorizedWithoutRetrying", func(t *testing.T) {
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("<html><body>Unauthorized. Missing or invalid security token</body></html>"))
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.True(t, errors.Is(err, apiv1.ErrUnauthorized))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("MergesDocumentsFromZipArchive", func(t *testing.T) {
+
+		nextDayResponse := strings.ReplaceAll(strings.ReplaceAll(string(testResponse), "2020-03-19", "2020-03-20"), "2020-03-18", "2020-03-19")
+		archive := getZipArchive(t, map[string][]byte{
+			"001-document.xml": testResponse,
+			"002-document.xml": []byte(nextDayResponse),
+			"003-document.xml": getAcknowledgementDocument("No matching data found for Data item ACTUAL_GENERATION_PER_PRODUCTION_TYPE"),
+		})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/zip")
+			_, _ = w.Write(archive)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		response, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, apiv1.TimeInterval{Start: timeInterval.Start, End: timeInterval.End.Add(24 * time.Hour)})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 78, len(response.TimeSeries))
+		assert.Equal(t, timeInterval.Start, response.TimePeriod.Start)
+		assert.Equal(t, timeInterval.End.Add(24*time.Hour), response.TimePeriod.End)
+	})
+
+	t.Run("ReturnsErrNoMatchingDataFoundForZipArchiveWithoutData", func(t *testing.T) {
+
+		archive := getZipArchive(t, map[string][]byte{
+			"001-document.xml": getAcknowledgementDocument("No matching data found for Data item ACTUAL_GENERATION_PER_PRODUCTION_TYPE"),
+		})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(archive)
+		}))
+		defer server.Close()
+
+		client := newTestClient(t, server.URL, "token")
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(context.Background(), apiv1.AreaNetherlands, timeInterval)
+
+		assert.True(t, errors.Is(err, apiv1.ErrNoMatchingDataFound))
+	})
+
+	t.Run("AbortsInFlightRequestWhenContextIsCancelled", func(t *testing.T) {
+
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		}))
+		defer server.Close()
+		defer close(done)
+
+		client := newTestClient(t, server.URL, "token")
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// act
+		_, err := client.GetAggregatedGenerationPerType(ctx, apiv1.AreaNetherlands, timeInterval)
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("ReturnsErrorForInvalidBaseURL", func(t *testing.T) {
+
+		// act
+		_, err := NewClient(&http.Client{}, "transparency.entsoe.eu", "token", 400, DefaultRetryPolicy)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("ReturnsErrorForInvalidRetryPolicy", func(t *testing.T) {
+
+		// act
+		_, err := NewClient(&http.Client{}, DefaultBaseURL, "token", 400, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Second})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func newTestClient(t *testing.T, baseURL, securityToken string) Client {
+	client, err := NewClient(&http.Client{Timeout: 5 * time.Second}, baseURL, securityToken, 60000, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	assert.Nil(t, err)
+
+	return client
+}
+
+func getAcknowledgementDocument(reasonText string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Acknowledgement_MarketDocument xmlns="urn:iec62325.351:tc57wg16:451-1:acknowledgementdocument:7:0">
+	<mRID>ee5b6d34-3a56-4e3d-a4b8-5e5d0b4c1d2f</mRID>
+	<createdDateTime>2021-03-11T17:42:45Z</createdDateTime>
+	<Reason>
+		<code>999</code>
+		<text>` + reasonText + `</text>
+	</Reason>
+</Acknowledgement_MarketDocument>`)
+}
+
+func getZipArchive(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range files {
+		f, err := writer.Create(name)
+		assert.Nil(t, err)
+		_, err = f.Write(content)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, writer.Close())
+
+	return buffer.Bytes()
 }
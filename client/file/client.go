@@ -0,0 +1,296 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrIncorrectTypeMeasurement = errors.New("Type of measurement is incorrect")
+	ErrUnknownFormat            = errors.New("Format should be parquet or csv")
+)
+
+const (
+	FormatParquet = "parquet"
+	FormatCSV     = "csv"
+)
+
+// Client is the interface for writing measurements to files partitioned by area and date
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// NewClient returns new file.Client writing to files like <directory>/generation/area=10YNL----------L/date=2021-03-12/part.parquet
+func NewClient(directory, format string) (Client, error) {
+
+	if format != FormatParquet && format != FormatCSV {
+		return nil, ErrUnknownFormat
+	}
+
+	return &client{
+		directory: directory,
+		format:    format,
+	}, nil
+}
+
+type client struct {
+	directory string
+	format    string
+	mutex     sync.Mutex
+}
+
+// sampleRow is a sample flattened into a row with the fields of the measurement it belongs to
+type sampleRow struct {
+	MeasuredAtTime        int64   `parquet:"name=measured_at_time, type=TIMESTAMP_MILLIS"`
+	ID                    string  `parquet:"name=id, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	SampleIndex           int32   `parquet:"name=sample_index, type=INT32"`
+	Source                string  `parquet:"name=source, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Area                  string  `parquet:"name=area, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Country               string  `parquet:"name=country, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	ExchangeWithArea      string  `parquet:"name=exchange_with_area, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	ExchangeWithCountry   string  `parquet:"name=exchange_with_country, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	ForecastType          string  `parquet:"name=forecast_type, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Resolution            string  `parquet:"name=resolution, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	EnergyType            string  `parquet:"name=energy_type, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	OriginalEnergyType    string  `parquet:"name=original_energy_type, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	IsRenewable           bool    `parquet:"name=is_renewable, type=BOOLEAN"`
+	CarbonIntensity       float64 `parquet:"name=carbon_intensity, type=DOUBLE"`
+	DirectCarbonIntensity float64 `parquet:"name=direct_carbon_intensity, type=DOUBLE"`
+	MetricType            string  `parquet:"name=metric_type, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	SampleDirection       string  `parquet:"name=sample_direction, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	SampleUnit            string  `parquet:"name=sample_unit, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Value                 float64 `parquet:"name=value, type=DOUBLE"`
+	RevisionNumber        int32   `parquet:"name=revision_number, type=INT32"`
+	FetchedAtTime         *int64  `parquet:"name=fetched_at_time, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	Currency              string  `parquet:"name=currency, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	PricePerMegaWattHour  float64 `parquet:"name=price_per_mega_watt_hour, type=DOUBLE"`
+}
+
+func (c *client) Init() (err error) {
+	return os.MkdirAll(c.directory, 0755)
+}
+
+// InsertMeasurements merges the rows into the existing file of each partition and atomically replaces it, so a run
+// that gets interrupted never leaves a partially written file and re-running it doesn't add duplicates
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	rows, err := c.toRows(measurements)
+	if errors.Is(err, ErrIncorrectTypeMeasurement) {
+		log.Debug().Msgf("Measurements for stream %v are not written to files, skipping", stream)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	partitions := map[string][]sampleRow{}
+	paths := []string{}
+	for _, r := range rows {
+		path := c.getPath(stream, r)
+		if _, ok := partitions[path]; !ok {
+			paths = append(paths, path)
+		}
+		partitions[path] = append(partitions[path], r)
+	}
+
+	for _, path := range paths {
+		err = c.mergeIntoFile(path, partitions[path])
+		if err != nil {
+			return fmt.Errorf("Failed writing file %v: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *client) Close() (err error) {
+	return nil
+}
+
+func (c *client) mergeIntoFile(path string, rows []sampleRow) (err error) {
+
+	existingRows := []sampleRow{}
+	_, err = os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		existingRows, err = c.readFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows = c.mergeRows(existingRows, rows)
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fmt.Sprintf("%v.tmp-%v", path, time.Now().UnixNano())
+	err = c.writeFile(tmpPath, rows)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (c *client) readFile(path string) ([]sampleRow, error) {
+	if c.format == FormatCSV {
+		return readCSV(path)
+	}
+
+	return readParquet(path)
+}
+
+func (c *client) writeFile(path string, rows []sampleRow) error {
+	if c.format == FormatCSV {
+		return writeCSV(path, rows)
+	}
+
+	return writeParquet(path, rows)
+}
+
+// mergeRows replaces existing rows by new rows with the same id and sample index and returns them sorted by time
+func (c *client) mergeRows(existingRows, newRows []sampleRow) []sampleRow {
+
+	type key struct {
+		id          string
+		sampleIndex int32
+	}
+
+	indexes := map[key]int{}
+	rows := []sampleRow{}
+	for _, r := range append(existingRows, newRows...) {
+		k := key{r.ID, r.SampleIndex}
+		if i, ok := indexes[k]; ok {
+			rows[i] = r
+			continue
+		}
+		indexes[k] = len(rows)
+		rows = append(rows, r)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].MeasuredAtTime != rows[j].MeasuredAtTime {
+			return rows[i].MeasuredAtTime < rows[j].MeasuredAtTime
+		}
+		if rows[i].ID != rows[j].ID {
+			return rows[i].ID < rows[j].ID
+		}
+		return rows[i].SampleIndex < rows[j].SampleIndex
+	})
+
+	return rows
+}
+
+// getPath returns the partition for a row, using the area since a country like Denmark or Norway has multiple areas
+func (c *client) getPath(stream apiv1.MeasurementStream, r sampleRow) string {
+	area := r.Area
+	if area == "" {
+		area = r.Country
+	}
+	date := time.Unix(0, r.MeasuredAtTime*int64(time.Millisecond)).UTC().Format("2006-01-02")
+
+	return filepath.Join(c.directory, strings.ToLower(string(stream)), "area="+area, "date="+date, "part."+c.format)
+}
+
+// toRows flattens the samples of measurements into a row per sample
+func (c *client) toRows(measurements interface{}) (rows []sampleRow, err error) {
+
+	addSamples := func(row sampleRow, measuredAtTime time.Time, samples []*apiv1.Sample) {
+		row.MeasuredAtTime = measuredAtTime.UnixNano() / int64(time.Millisecond)
+		for i, s := range samples {
+			if s == nil {
+				continue
+			}
+			row.SampleIndex = int32(i)
+			row.EnergyType = string(s.EnergyType)
+			row.OriginalEnergyType = s.OriginalEnergyType
+			row.IsRenewable = s.IsRenewable
+			row.CarbonIntensity = s.CarbonIntensity
+			row.DirectCarbonIntensity = s.DirectCarbonIntensity
+			row.MetricType = string(s.MetricType)
+			row.SampleDirection = string(s.SampleDirection)
+			row.SampleUnit = string(s.SampleUnit)
+			row.Value = s.Value
+			rows = append(rows, row)
+		}
+	}
+
+	switch ms := measurements.(type) {
+	case []apiv1.GenerationMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, Resolution: m.Resolution, RevisionNumber: int32(m.RevisionNumber), FetchedAtTime: c.toNullableMillis(m.FetchedAtTime)}, m.MeasuredAtTime, m.Samples)
+		}
+	case []apiv1.ExchangeMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, ExchangeWithArea: m.ExchangeWithArea, ExchangeWithCountry: m.ExchangeWithCountry, Resolution: m.Resolution}, m.MeasuredAtTime, m.Samples)
+		}
+	case []apiv1.BalanceMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, Resolution: m.Resolution}, m.MeasuredAtTime, m.Samples)
+		}
+	case []apiv1.ConsumptionMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, Resolution: m.Resolution}, m.MeasuredAtTime, m.Samples)
+		}
+	case []apiv1.LoadMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, Resolution: m.Resolution}, m.MeasuredAtTime, m.Samples)
+		}
+	case []apiv1.ForecastMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, ForecastType: string(m.ForecastType), Resolution: m.Resolution}, m.ForecastForTime, m.Samples)
+		}
+	case []apiv1.PriceMeasurement:
+		// prices have no samples, so each measurement is a single row
+		for _, m := range ms {
+			rows = append(rows, sampleRow{
+				MeasuredAtTime:       m.MeasuredAtTime.UnixNano() / int64(time.Millisecond),
+				ID:                   m.ID,
+				Source:               m.Source,
+				Area:                 m.Area,
+				Country:              m.Country,
+				Resolution:           m.Resolution,
+				Currency:             m.Currency,
+				PricePerMegaWattHour: m.PricePerMegaWattHour,
+			})
+		}
+	case []apiv1.CapacityMeasurement:
+		for _, m := range ms {
+			addSamples(sampleRow{ID: m.ID, Source: m.Source, Area: m.Area, Country: m.Country, Resolution: m.Resolution}, m.MeasuredAtTime, m.Samples)
+		}
+	default:
+		return nil, ErrIncorrectTypeMeasurement
+	}
+
+	return rows, nil
+}
+
+// toNullableMillis returns nil for a time that hasn't been set, so it's stored as null instead of the start of the unix epoch
+func (c *client) toNullableMillis(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	millis := t.UnixNano() / int64(time.Millisecond)
+
+	return &millis
+}
@@ -0,0 +1,175 @@
+package file
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertMeasurements(t *testing.T) {
+
+	measuredAtTime := time.Date(2021, 3, 12, 23, 45, 0, 0, time.UTC)
+	measurements := []apiv1.GenerationMeasurement{
+		{ID: "a", Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime, Samples: []*apiv1.Sample{
+			{EnergyType: apiv1.EnergyTypeSolar, IsRenewable: true, SampleDirection: apiv1.SampleDirectionIn, Value: 1},
+			{EnergyType: apiv1.EnergyTypeGas, SampleDirection: apiv1.SampleDirectionIn, Value: 2},
+		}},
+		{ID: "b", Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime.Add(15 * time.Minute), Samples: []*apiv1.Sample{
+			{EnergyType: apiv1.EnergyTypeSolar, IsRenewable: true, SampleDirection: apiv1.SampleDirectionIn, Value: 3},
+		}},
+	}
+
+	for _, format := range []string{FormatParquet, FormatCSV} {
+		t.Run("WritesRowPerSamplePartitionedByDateFor"+strings.Title(format), func(t *testing.T) {
+
+			directory := t.TempDir()
+			c, _ := NewClient(directory, format)
+			err := c.Init()
+			assert.Nil(t, err)
+
+			// act
+			err = c.InsertMeasurements(apiv1.MeasurementStreamGeneration, measurements)
+
+			assert.Nil(t, err)
+			rows, err := c.(*client).readFile(filepath.Join(directory, "generation", "area=10YNL----------L", "date=2021-03-12", "part."+format))
+			assert.Nil(t, err)
+			assert.Equal(t, 2, len(rows))
+			assert.Equal(t, "a", rows[0].ID)
+			assert.Equal(t, "Solar", rows[0].EnergyType)
+			assert.Equal(t, true, rows[0].IsRenewable)
+			assert.Equal(t, measuredAtTime.UnixNano()/int64(time.Millisecond), rows[0].MeasuredAtTime)
+			assert.Equal(t, int32(1), rows[1].SampleIndex)
+			assert.Equal(t, 2.0, rows[1].Value)
+			rows, err = c.(*client).readFile(filepath.Join(directory, "generation", "area=10YNL----------L", "date=2021-03-13", "part."+format))
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(rows))
+			assert.Equal(t, "b", rows[0].ID)
+		})
+
+		t.Run("AppendsToExistingFileWithoutDuplicatesFor"+strings.Title(format), func(t *testing.T) {
+
+			directory := t.TempDir()
+			c, _ := NewClient(directory, format)
+			err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, measurements[:1])
+			assert.Nil(t, err)
+			updatedMeasurement := measurements[0]
+			updatedMeasurement.ID = "c"
+			updatedMeasurement.Samples = updatedMeasurement.Samples[:1]
+
+			// act
+			err = c.InsertMeasurements(apiv1.MeasurementStreamGeneration, []apiv1.GenerationMeasurement{measurements[0], updatedMeasurement})
+
+			assert.Nil(t, err)
+			rows, err := c.(*client).readFile(filepath.Join(directory, "generation", "area=10YNL----------L", "date=2021-03-12", "part."+format))
+			assert.Nil(t, err)
+			assert.Equal(t, 3, len(rows))
+			files, _ := ioutil.ReadDir(filepath.Join(directory, "generation", "area=10YNL----------L", "date=2021-03-12"))
+			assert.Equal(t, 1, len(files))
+		})
+	}
+
+	for _, format := range []string{FormatParquet, FormatCSV} {
+		t.Run("WritesRowPerPriceFor"+strings.Title(format), func(t *testing.T) {
+
+			directory := t.TempDir()
+			c, _ := NewClient(directory, format)
+
+			// act
+			err := c.InsertMeasurements(apiv1.MeasurementStreamPrice, []apiv1.PriceMeasurement{
+				{ID: "a", Area: "10YNL----------L", Country: "NL", Resolution: "PT15M", Currency: "EUR", PricePerMegaWattHour: 48.5, MeasuredAtTime: measuredAtTime},
+			})
+
+			assert.Nil(t, err)
+			rows, err := c.(*client).readFile(filepath.Join(directory, "price", "area=10YNL----------L", "date=2021-03-12", "part."+format))
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(rows))
+			assert.Equal(t, "EUR", rows[0].Currency)
+			assert.Equal(t, 48.5, rows[0].PricePerMegaWattHour)
+			assert.Equal(t, "PT15M", rows[0].Resolution)
+		})
+
+		t.Run("WritesRevisionNumberAndFetchedAtTimeFor"+strings.Title(format), func(t *testing.T) {
+
+			directory := t.TempDir()
+			c, _ := NewClient(directory, format)
+			fetchedAtTime := time.Date(2021, 3, 14, 8, 0, 0, 0, time.UTC)
+			revisedMeasurement := measurements[0]
+			revisedMeasurement.RevisionNumber = 1
+			revisedMeasurement.FetchedAtTime = fetchedAtTime
+
+			// act
+			err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, []apiv1.GenerationMeasurement{revisedMeasurement})
+
+			assert.Nil(t, err)
+			rows, err := c.(*client).readFile(filepath.Join(directory, "generation", "area=10YNL----------L", "date=2021-03-12", "part."+format))
+			assert.Nil(t, err)
+			assert.Equal(t, int32(1), rows[0].RevisionNumber)
+			assert.Equal(t, fetchedAtTime.UnixNano()/int64(time.Millisecond), *rows[0].FetchedAtTime)
+		})
+	}
+
+	t.Run("SkipsUnsupportedMeasurements", func(t *testing.T) {
+
+		directory := t.TempDir()
+		c, _ := NewClient(directory, FormatParquet)
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, []string{"a"})
+
+		assert.Nil(t, err)
+		files, _ := ioutil.ReadDir(directory)
+		assert.Equal(t, 0, len(files))
+	})
+}
+
+func TestNewClient(t *testing.T) {
+
+	t.Run("ReturnsErrorForUnknownFormat", func(t *testing.T) {
+
+		// act
+		_, err := NewClient(t.TempDir(), "xlsx")
+
+		assert.Equal(t, ErrUnknownFormat, err)
+	})
+}
+
+func TestGetPath(t *testing.T) {
+
+	t.Run("UsesAreaForAreasInTheSameCountry", func(t *testing.T) {
+
+		c := &client{directory: "/data", format: FormatCSV}
+		measuredAtTime := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+
+		// act
+		path1 := c.getPath(apiv1.MeasurementStreamLoad, sampleRow{Area: "10YDK-1--------W", Country: "DK", MeasuredAtTime: measuredAtTime})
+		path2 := c.getPath(apiv1.MeasurementStreamLoad, sampleRow{Area: "10YDK-2--------M", Country: "DK", MeasuredAtTime: measuredAtTime})
+
+		assert.Equal(t, "/data/load/area=10YDK-1--------W/date=2021-03-12/part.csv", path1)
+		assert.Equal(t, "/data/load/area=10YDK-2--------M/date=2021-03-12/part.csv", path2)
+	})
+
+	t.Run("UsesCountryIfAreaIsUnknown", func(t *testing.T) {
+
+		c := &client{directory: "/data", format: FormatCSV}
+
+		// act
+		path := c.getPath(apiv1.MeasurementStreamLoad, sampleRow{Country: "DE", MeasuredAtTime: time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)})
+
+		assert.Equal(t, "/data/load/area=DE/date=2021-03-12/part.csv", path)
+	})
+
+	t.Run("UsesAreaIfCountryIsUnknown", func(t *testing.T) {
+
+		c := &client{directory: "/data", format: FormatCSV}
+
+		// act
+		path := c.getPath(apiv1.MeasurementStreamLoad, sampleRow{Area: "10YDE-VE-------2", MeasuredAtTime: time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)})
+
+		assert.Equal(t, "/data/load/area=10YDE-VE-------2/date=2021-03-12/part.csv", path)
+	})
+}
@@ -0,0 +1,209 @@
+package file
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	csvHeader = []string{
+		"measured_at_time",
+		"id",
+		"sample_index",
+		"source",
+		"area",
+		"country",
+		"exchange_with_area",
+		"exchange_with_country",
+		"forecast_type",
+		"resolution",
+		"energy_type",
+		"original_energy_type",
+		"is_renewable",
+		"carbon_intensity",
+		"direct_carbon_intensity",
+		"metric_type",
+		"sample_direction",
+		"sample_unit",
+		"value",
+		"revision_number",
+		"fetched_at_time",
+		"currency",
+		"price_per_mega_watt_hour",
+	}
+)
+
+func readCSV(path string) (rows []sampleRow, err error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, record := range records {
+		if i == 0 {
+			// skip header
+			continue
+		}
+		r, err := fromCSVRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("Failed parsing line %v: %w", i+1, err)
+		}
+		rows = append(rows, r)
+	}
+
+	return rows, nil
+}
+
+func writeCSV(path string, rows []sampleRow) (err error) {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	csvWriter := csv.NewWriter(file)
+	err = csvWriter.Write(csvHeader)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	for _, r := range rows {
+		err = csvWriter.Write(toCSVRecord(r))
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	csvWriter.Flush()
+	err = csvWriter.Error()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func toCSVRecord(r sampleRow) []string {
+	fetchedAtTime := ""
+	if r.FetchedAtTime != nil {
+		fetchedAtTime = time.Unix(0, *r.FetchedAtTime*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+	}
+
+	return []string{
+		time.Unix(0, r.MeasuredAtTime*int64(time.Millisecond)).UTC().Format(time.RFC3339),
+		r.ID,
+		strconv.Itoa(int(r.SampleIndex)),
+		r.Source,
+		r.Area,
+		r.Country,
+		r.ExchangeWithArea,
+		r.ExchangeWithCountry,
+		r.ForecastType,
+		r.Resolution,
+		r.EnergyType,
+		r.OriginalEnergyType,
+		strconv.FormatBool(r.IsRenewable),
+		strconv.FormatFloat(r.CarbonIntensity, 'f', -1, 64),
+		strconv.FormatFloat(r.DirectCarbonIntensity, 'f', -1, 64),
+		r.MetricType,
+		r.SampleDirection,
+		r.SampleUnit,
+		strconv.FormatFloat(r.Value, 'f', -1, 64),
+		strconv.Itoa(int(r.RevisionNumber)),
+		fetchedAtTime,
+		r.Currency,
+		strconv.FormatFloat(r.PricePerMegaWattHour, 'f', -1, 64),
+	}
+}
+
+func fromCSVRecord(record []string) (r sampleRow, err error) {
+
+	if len(record) != len(csvHeader) {
+		return r, fmt.Errorf("Expected %v columns, but got %v", len(csvHeader), len(record))
+	}
+
+	measuredAtTime, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return r, err
+	}
+	sampleIndex, err := strconv.Atoi(record[2])
+	if err != nil {
+		return r, err
+	}
+	isRenewable, err := strconv.ParseBool(record[12])
+	if err != nil {
+		return r, err
+	}
+	carbonIntensity, err := strconv.ParseFloat(record[13], 64)
+	if err != nil {
+		return r, err
+	}
+	directCarbonIntensity, err := strconv.ParseFloat(record[14], 64)
+	if err != nil {
+		return r, err
+	}
+	value, err := strconv.ParseFloat(record[18], 64)
+	if err != nil {
+		return r, err
+	}
+	revisionNumber, err := strconv.Atoi(record[19])
+	if err != nil {
+		return r, err
+	}
+	var fetchedAtTime *int64
+	if record[20] != "" {
+		t, err := time.Parse(time.RFC3339, record[20])
+		if err != nil {
+			return r, err
+		}
+		millis := t.UnixNano() / int64(time.Millisecond)
+		fetchedAtTime = &millis
+	}
+	pricePerMegaWattHour, err := strconv.ParseFloat(record[22], 64)
+	if err != nil {
+		return r, err
+	}
+
+	return sampleRow{
+		MeasuredAtTime:        measuredAtTime.UnixNano() / int64(time.Millisecond),
+		ID:                    record[1],
+		SampleIndex:           int32(sampleIndex),
+		Source:                record[3],
+		Area:                  record[4],
+		Country:               record[5],
+		ExchangeWithArea:      record[6],
+		ExchangeWithCountry:   record[7],
+		ForecastType:          record[8],
+		Resolution:            record[9],
+		EnergyType:            record[10],
+		OriginalEnergyType:    record[11],
+		IsRenewable:           isRenewable,
+		CarbonIntensity:       carbonIntensity,
+		DirectCarbonIntensity: directCarbonIntensity,
+		MetricType:            record[15],
+		SampleDirection:       record[16],
+		SampleUnit:            record[17],
+		Value:                 value,
+		RevisionNumber:        int32(revisionNumber),
+		FetchedAtTime:         fetchedAtTime,
+		Currency:              record[21],
+		PricePerMegaWattHour:  pricePerMegaWattHour,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package file
+
+import (
+	"os"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// localFile implements source.ParquetFile for files on the local filesystem
+type localFile struct {
+	*os.File
+}
+
+func (f *localFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.Name()
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localFile{file}, nil
+}
+
+func (f *localFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localFile{file}, nil
+}
+
+func readParquet(path string) (rows []sampleRow, err error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	parquetFile := &localFile{file}
+	defer parquetFile.Close()
+
+	parquetReader, err := reader.NewParquetReader(parquetFile, new(sampleRow), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer parquetReader.ReadStop()
+
+	rows = make([]sampleRow, parquetReader.GetNumRows())
+	err = parquetReader.Read(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func writeParquet(path string, rows []sampleRow) (err error) {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	parquetFile := &localFile{file}
+
+	parquetWriter, err := writer.NewParquetWriter(parquetFile, new(sampleRow), 1)
+	if err != nil {
+		parquetFile.Close()
+		return err
+	}
+	parquetWriter.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for _, r := range rows {
+		err = parquetWriter.Write(r)
+		if err != nil {
+			parquetFile.Close()
+			return err
+		}
+	}
+
+	err = parquetWriter.WriteStop()
+	if err != nil {
+		parquetFile.Close()
+		return err
+	}
+
+	err = parquetFile.Sync()
+	if err != nil {
+		parquetFile.Close()
+		return err
+	}
+
+	return parquetFile.Close()
+}
@@ -0,0 +1,206 @@
+package influxdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrIncorrectTypeMeasurement = errors.New("Type of measurement is incorrect")
+)
+
+var (
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+)
+
+// Client is the interface for writing measurements to influxdb using the v2 write api
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// NewClient returns new influxdb.Client
+func NewClient(serverURL, organization, bucket, token string, batchSize int) (Client, error) {
+
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("Batch size should be larger than 0, but is %v", batchSize)
+	}
+
+	return &client{
+		serverURL:    strings.TrimSuffix(serverURL, "/"),
+		organization: organization,
+		bucket:       bucket,
+		token:        token,
+		batchSize:    batchSize,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}, nil
+}
+
+type client struct {
+	serverURL    string
+	organization string
+	bucket       string
+	token        string
+	batchSize    int
+	httpClient   *http.Client
+}
+
+func (c *client) Init() (err error) {
+	return nil
+}
+
+// InsertMeasurements writes all measurements before returning, so the state never moves past points that haven't been written
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	if stream != apiv1.MeasurementStreamGeneration && stream != apiv1.MeasurementStreamExchange {
+		log.Debug().Msgf("Measurements for stream %v are not written to influxdb, skipping", stream)
+		return nil
+	}
+
+	lines, err := c.toLines(measurements)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(lines); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		err = c.write(lines[start:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *client) Close() (err error) {
+	return nil
+}
+
+// toLines converts each sample of generation or exchange measurements into a point in line protocol
+func (c *client) toLines(measurements interface{}) (lines []string, err error) {
+
+	switch m := measurements.(type) {
+	case []apiv1.GenerationMeasurement:
+		for _, gm := range m {
+			for _, s := range gm.Samples {
+				if s == nil {
+					continue
+				}
+				lines = append(lines, c.toLine("generation", map[string]string{
+					"area":                 gm.Area,
+					"country":              gm.Country,
+					"energy_type":          string(s.EnergyType),
+					"original_energy_type": s.OriginalEnergyType,
+					"direction":            string(s.SampleDirection),
+					"renewable":            strconv.FormatBool(s.IsRenewable),
+				}, s.Value, gm.MeasuredAtTime))
+			}
+		}
+	case []apiv1.ExchangeMeasurement:
+		for _, em := range m {
+			for _, s := range em.Samples {
+				if s == nil {
+					continue
+				}
+				lines = append(lines, c.toLine("exchange", map[string]string{
+					"area":         em.Area,
+					"country":      em.Country,
+					"peer":         em.ExchangeWithArea,
+					"peer_country": em.ExchangeWithCountry,
+					"direction":    string(s.SampleDirection),
+				}, s.Value, em.MeasuredAtTime))
+			}
+		}
+	default:
+		return nil, ErrIncorrectTypeMeasurement
+	}
+
+	return lines, nil
+}
+
+func (c *client) toLine(measurement string, tags map[string]string, value float64, timestamp time.Time) string {
+
+	// tags are sorted by key as recommended by influxdb; empty tags aren't allowed in line protocol
+	keys := []string{}
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var line strings.Builder
+	line.WriteString(measurementEscaper.Replace(measurement))
+	for _, k := range keys {
+		line.WriteString(",")
+		line.WriteString(tagEscaper.Replace(k))
+		line.WriteString("=")
+		line.WriteString(tagEscaper.Replace(tags[k]))
+	}
+	line.WriteString(" value=")
+	line.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	line.WriteString(" ")
+	line.WriteString(strconv.FormatInt(timestamp.Unix(), 10))
+
+	return line.String()
+}
+
+func (c *client) write(lines []string) (err error) {
+
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	_, err = gzipWriter.Write([]byte(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	writeURL := fmt.Sprintf("%v/api/v2/write?org=%v&bucket=%v&precision=s", c.serverURL, url.QueryEscape(c.organization), url.QueryEscape(c.bucket))
+
+	request, err := http.NewRequest(http.MethodPost, writeURL, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Token "+c.token)
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	request.Header.Set("Content-Encoding", "gzip")
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Writing %v points to influxdb failed with status %v: %v", len(lines), response.StatusCode, string(responseBody))
+	}
+
+	log.Debug().Msgf("Wrote %v points to influxdb bucket %v", len(lines), c.bucket)
+
+	return nil
+}
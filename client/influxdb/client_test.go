@@ -0,0 +1,139 @@
+package influxdb
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToLines(t *testing.T) {
+
+	t.Run("ReturnsPointPerGenerationSample", func(t *testing.T) {
+
+		client := &client{}
+		measurements := []apiv1.GenerationMeasurement{
+			{Area: "10YNL----------L", Country: "NL", MeasuredAtTime: time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC), Samples: []*apiv1.Sample{
+				{EnergyType: apiv1.EnergyTypeSolar, OriginalEnergyType: "B16", IsRenewable: true, SampleDirection: apiv1.SampleDirectionOut, Value: 1234.5},
+				{EnergyType: apiv1.EnergyTypeGas, OriginalEnergyType: "B04", IsRenewable: false, SampleDirection: apiv1.SampleDirectionOut, Value: 4000},
+			}},
+		}
+
+		// act
+		lines, err := client.toLines(measurements)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			`generation,area=10YNL----------L,country=NL,direction=Out,energy_type=Solar,original_energy_type=B16,renewable=true value=1234.5 1615544100`,
+			`generation,area=10YNL----------L,country=NL,direction=Out,energy_type=Gas,original_energy_type=B04,renewable=false value=4000 1615544100`,
+		}, lines)
+	})
+
+	t.Run("ReturnsPointPerExchangeSampleWithoutEmptyTags", func(t *testing.T) {
+
+		client := &client{}
+		measurements := []apiv1.ExchangeMeasurement{
+			{Area: "10YNL----------L", ExchangeWithArea: "10YBE----------2", ExchangeWithCountry: "BE", MeasuredAtTime: time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC), Samples: []*apiv1.Sample{
+				{SampleDirection: apiv1.SampleDirectionIn, Value: 100},
+			}},
+		}
+
+		// act
+		lines, err := client.toLines(measurements)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{`exchange,area=10YNL----------L,direction=In,peer=10YBE----------2,peer_country=BE value=100 1615544100`}, lines)
+	})
+
+	t.Run("ReturnsErrorForUnsupportedMeasurements", func(t *testing.T) {
+
+		client := &client{}
+
+		// act
+		_, err := client.toLines([]apiv1.LoadMeasurement{})
+
+		assert.Equal(t, ErrIncorrectTypeMeasurement, err)
+	})
+}
+
+func TestToLine(t *testing.T) {
+
+	t.Run("EscapesTagValues", func(t *testing.T) {
+
+		client := &client{}
+
+		// act
+		line := client.toLine("generation", map[string]string{"area": "a b,c=d"}, 1, time.Unix(1, 0))
+
+		assert.Equal(t, `generation,area=a\ b\,c\=d value=1 1`, line)
+	})
+}
+
+func TestInsertMeasurements(t *testing.T) {
+
+	t.Run("WritesGzippedBatches", func(t *testing.T) {
+
+		requests := []*http.Request{}
+		bodies := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gzipReader, err := gzip.NewReader(r.Body)
+			assert.Nil(t, err)
+			body, _ := ioutil.ReadAll(gzipReader)
+			requests = append(requests, r)
+			bodies = append(bodies, string(body))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		c, _ := NewClient(server.URL, "home", "electricity", "token", 2)
+		measurements := []apiv1.GenerationMeasurement{
+			{Area: "10YNL----------L", MeasuredAtTime: time.Unix(1, 0), Samples: []*apiv1.Sample{{Value: 1}, {Value: 2}, {Value: 3}}},
+		}
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, measurements)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(requests))
+		assert.Equal(t, "/api/v2/write", requests[0].URL.Path)
+		assert.Equal(t, "org=home&bucket=electricity&precision=s", requests[0].URL.RawQuery)
+		assert.Equal(t, "Token token", requests[0].Header.Get("Authorization"))
+		assert.Equal(t, "gzip", requests[0].Header.Get("Content-Encoding"))
+		assert.Equal(t, 2, len(strings.Split(bodies[0], "\n")))
+		assert.Equal(t, 1, len(strings.Split(bodies[1], "\n")))
+	})
+
+	t.Run("ReturnsErrorIfWriteFails", func(t *testing.T) {
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		c, _ := NewClient(server.URL, "home", "electricity", "token", 2)
+		measurements := []apiv1.GenerationMeasurement{
+			{Area: "10YNL----------L", MeasuredAtTime: time.Unix(1, 0), Samples: []*apiv1.Sample{{Value: 1}}},
+		}
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, measurements)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("SkipsOtherStreams", func(t *testing.T) {
+
+		c, _ := NewClient("http://localhost:1", "home", "electricity", "token", 2)
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamLoad, []apiv1.LoadMeasurement{{ID: "a"}})
+
+		assert.Nil(t, err)
+	})
+}
@@ -0,0 +1,159 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	publishTimeout = 10 * time.Second
+)
+
+// Client is the interface for publishing the most recent measurements per area to retained mqtt topics
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// NewClient returns new mqtt.Client
+func NewClient(brokerURL, clientID, username, password, topicPrefix string, qos byte) (Client, error) {
+
+	if qos > 2 {
+		return nil, fmt.Errorf("Qos should be 0, 1 or 2, but is %v", qos)
+	}
+
+	options := pahomqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true)
+
+	return &client{
+		mqttClient:    pahomqtt.NewClient(options),
+		topicPrefix:   strings.TrimSuffix(topicPrefix, "/"),
+		qos:           qos,
+		lastPublished: map[string]time.Time{},
+	}, nil
+}
+
+type client struct {
+	mqttClient    pahomqtt.Client
+	topicPrefix   string
+	qos           byte
+	mutex         sync.Mutex
+	lastPublished map[string]time.Time
+}
+
+type message struct {
+	topic          string
+	payload        interface{}
+	measuredAtTime time.Time
+}
+
+func (c *client) Init() (err error) {
+	token := c.mqttClient.Connect()
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("Connecting to mqtt broker timed out after %v", publishTimeout)
+	}
+
+	return token.Error()
+}
+
+// InsertMeasurements publishes the most recent measurement per area as retained message, so subscribers get it as soon as they connect
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	messages := c.getMessages(measurements)
+	if len(messages) == 0 {
+		log.Debug().Msgf("Measurements for stream %v are not published to mqtt, skipping", stream)
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, m := range messages {
+		// measurements are inserted in order, but a concurrent backfill shouldn't overwrite a more recent message
+		if lastPublished, ok := c.lastPublished[m.topic]; ok && m.measuredAtTime.Before(lastPublished) {
+			continue
+		}
+
+		payload, err := json.Marshal(m.payload)
+		if err != nil {
+			return err
+		}
+
+		token := c.mqttClient.Publish(m.topic, c.qos, true, payload)
+		if !token.WaitTimeout(publishTimeout) {
+			return fmt.Errorf("Publishing to mqtt topic %v timed out after %v", m.topic, publishTimeout)
+		}
+		if token.Error() != nil {
+			return fmt.Errorf("Failed publishing to mqtt topic %v: %w", m.topic, token.Error())
+		}
+
+		c.lastPublished[m.topic] = m.measuredAtTime
+	}
+
+	return nil
+}
+
+func (c *client) Close() (err error) {
+	c.mqttClient.Disconnect(250)
+	return nil
+}
+
+// getMessages returns a message with the most recent measurement for each topic, and a summary with derived values for generation
+func (c *client) getMessages(measurements interface{}) (messages []message) {
+
+	latest := map[string]message{}
+	topics := []string{}
+	add := func(m message) {
+		if l, ok := latest[m.topic]; ok && m.measuredAtTime.Before(l.measuredAtTime) {
+			return
+		}
+		if _, ok := latest[m.topic]; !ok {
+			topics = append(topics, m.topic)
+		}
+		latest[m.topic] = m
+	}
+
+	switch ms := measurements.(type) {
+	case []apiv1.GenerationMeasurement:
+		for _, m := range ms {
+			add(message{topic: c.getTopic(m.Area, "generation"), payload: m, measuredAtTime: m.MeasuredAtTime})
+			add(message{topic: c.getTopic(m.Area, "summary"), payload: apiv1.NewMixSummary(m), measuredAtTime: m.MeasuredAtTime})
+		}
+	case []apiv1.ExchangeMeasurement:
+		for _, m := range ms {
+			add(message{topic: c.getTopic(m.Area, "exchange", m.ExchangeWithArea), payload: m, measuredAtTime: m.MeasuredAtTime})
+		}
+	case []apiv1.ConsumptionMeasurement:
+		for _, m := range ms {
+			add(message{topic: c.getTopic(m.Area, "consumption"), payload: m, measuredAtTime: m.MeasuredAtTime})
+		}
+	case []apiv1.LoadMeasurement:
+		for _, m := range ms {
+			add(message{topic: c.getTopic(m.Area, "load"), payload: m, measuredAtTime: m.MeasuredAtTime})
+		}
+	}
+
+	for _, t := range topics {
+		messages = append(messages, latest[t])
+	}
+
+	return messages
+}
+
+// getTopic returns a topic like jarvis/electricity-mix/10YNL----------L/generation; it uses the area instead of the country,
+// because a country like Denmark or Norway has multiple areas
+func (c *client) getTopic(area string, levels ...string) string {
+	return strings.Join(append([]string{c.topicPrefix, area}, levels...), "/")
+}
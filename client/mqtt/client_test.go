@@ -0,0 +1,129 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMessages(t *testing.T) {
+
+	t.Run("ReturnsMostRecentGenerationAndSummaryPerArea", func(t *testing.T) {
+
+		client := &client{topicPrefix: "jarvis/electricity-mix"}
+		measuredAtTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		measurements := []apiv1.GenerationMeasurement{
+			{ID: "a", Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime},
+			{ID: "b", Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime.Add(15 * time.Minute)},
+			{ID: "c", Area: "10YBE----------2", Country: "BE", MeasuredAtTime: measuredAtTime},
+		}
+
+		// act
+		messages := client.getMessages(measurements)
+
+		assert.Equal(t, 4, len(messages))
+		assert.Equal(t, "jarvis/electricity-mix/10YNL----------L/generation", messages[0].topic)
+		assert.Equal(t, "b", messages[0].payload.(apiv1.GenerationMeasurement).ID)
+		assert.Equal(t, "jarvis/electricity-mix/10YNL----------L/summary", messages[1].topic)
+		assert.Equal(t, measuredAtTime.Add(15*time.Minute), messages[1].payload.(apiv1.MixSummary).MeasuredAtTime)
+		assert.Equal(t, "jarvis/electricity-mix/10YBE----------2/generation", messages[2].topic)
+	})
+
+	t.Run("ReturnsMessagesPerAreaForAreasInTheSameCountry", func(t *testing.T) {
+
+		client := &client{topicPrefix: "jarvis/electricity-mix"}
+		measuredAtTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		measurements := []apiv1.GenerationMeasurement{
+			{ID: "a", Area: "10YDK-1--------W", Country: "DK", MeasuredAtTime: measuredAtTime},
+			{ID: "b", Area: "10YDK-2--------M", Country: "DK", MeasuredAtTime: measuredAtTime},
+		}
+
+		// act
+		messages := client.getMessages(measurements)
+
+		assert.Equal(t, 4, len(messages))
+		assert.Equal(t, "jarvis/electricity-mix/10YDK-1--------W/generation", messages[0].topic)
+		assert.Equal(t, "a", messages[0].payload.(apiv1.GenerationMeasurement).ID)
+		assert.Equal(t, "jarvis/electricity-mix/10YDK-2--------M/generation", messages[2].topic)
+		assert.Equal(t, "b", messages[2].payload.(apiv1.GenerationMeasurement).ID)
+	})
+
+	t.Run("ReturnsMessagePerExchangePeer", func(t *testing.T) {
+
+		client := &client{topicPrefix: "jarvis/electricity-mix"}
+		measurements := []apiv1.ExchangeMeasurement{
+			{Area: "10YNL----------L", Country: "NL", ExchangeWithArea: "10YBE----------2", ExchangeWithCountry: "BE"},
+			{Area: "10YNL----------L", Country: "NL", ExchangeWithArea: "10YDE-VE-------2"},
+		}
+
+		// act
+		messages := client.getMessages(measurements)
+
+		assert.Equal(t, 2, len(messages))
+		assert.Equal(t, "jarvis/electricity-mix/10YNL----------L/exchange/10YBE----------2", messages[0].topic)
+		assert.Equal(t, "jarvis/electricity-mix/10YNL----------L/exchange/10YDE-VE-------2", messages[1].topic)
+	})
+
+	t.Run("ReturnsNoMessagesForUnsupportedMeasurements", func(t *testing.T) {
+
+		client := &client{topicPrefix: "jarvis/electricity-mix"}
+
+		// act
+		messages := client.getMessages([]apiv1.PriceMeasurement{{Area: "10YNL----------L"}})
+
+		assert.Equal(t, 0, len(messages))
+	})
+}
+
+// TestInsertMeasurementsIntegration runs against a local broker, for example started with
+// docker run -d -p 1883:1883 eclipse-mosquitto:1.6 and MQTT_BROKER_URL=tcp://localhost:1883
+func TestInsertMeasurementsIntegration(t *testing.T) {
+
+	brokerURL := os.Getenv("MQTT_BROKER_URL")
+	if brokerURL == "" {
+		t.Skip("MQTT_BROKER_URL is not set")
+	}
+
+	t.Run("PublishesRetainedMessages", func(t *testing.T) {
+
+		mqttClient, err := NewClient(brokerURL, "jarvis-electricity-mix-exporter-test", "", "", "jarvis-test/electricity-mix", 1)
+		assert.Nil(t, err)
+		err = mqttClient.Init()
+		assert.Nil(t, err)
+		defer mqttClient.Close()
+
+		measurements := []apiv1.LoadMeasurement{{ID: "a", Area: "10YNL----------L", Country: "NL", MeasuredAtTime: time.Now().UTC()}}
+
+		// act
+		err = mqttClient.InsertMeasurements(apiv1.MeasurementStreamLoad, measurements)
+
+		assert.Nil(t, err)
+
+		// a new subscriber receives the retained message
+		received := make(chan apiv1.LoadMeasurement, 1)
+		subscriber := pahomqtt.NewClient(pahomqtt.NewClientOptions().AddBroker(brokerURL).SetClientID("jarvis-electricity-mix-exporter-test-subscriber"))
+		token := subscriber.Connect()
+		token.Wait()
+		assert.Nil(t, token.Error())
+		defer subscriber.Disconnect(250)
+		token = subscriber.Subscribe("jarvis-test/electricity-mix/10YNL----------L/load", 1, func(_ pahomqtt.Client, m pahomqtt.Message) {
+			var measurement apiv1.LoadMeasurement
+			_ = json.Unmarshal(m.Payload(), &measurement)
+			received <- measurement
+		})
+		token.Wait()
+		assert.Nil(t, token.Error())
+
+		select {
+		case measurement := <-received:
+			assert.Equal(t, "a", measurement.ID)
+		case <-time.After(5 * time.Second):
+			t.Error("No retained message has been received")
+		}
+	})
+}
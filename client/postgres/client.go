@@ -0,0 +1,350 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	_ "github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrIncorrectTypeMeasurement = errors.New("Type of measurement is incorrect")
+)
+
+const (
+	// stay well below the maximum of 65535 parameters per statement
+	maxRowsPerInsert = 1000
+)
+
+var (
+	// samples are flattened into a row each; all tables share the same columns so they can be queried alike
+	tables = map[apiv1.MeasurementStream]string{
+		apiv1.MeasurementStreamGeneration: "generation_samples",
+		apiv1.MeasurementStreamExchange:   "exchange_samples",
+		apiv1.MeasurementStreamLoad:       "load_samples",
+	}
+
+	columns = []string{
+		"measured_at_time",
+		"id",
+		"sample_index",
+		"source",
+		"area",
+		"country",
+		"exchange_with_area",
+		"exchange_with_country",
+		"resolution",
+		"energy_type",
+		"original_energy_type",
+		"is_renewable",
+		"carbon_intensity",
+		"direct_carbon_intensity",
+		"metric_type",
+		"sample_direction",
+		"sample_unit",
+		"value",
+		"revision_number",
+		"fetched_at_time",
+	}
+)
+
+// Client is the interface for storing measurements in postgresql, using timescaledb hypertables if the extension is installed
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// NewClient returns new postgres.Client
+func NewClient(connectionString string, init bool) (Client, error) {
+
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		db:   db,
+		init: init,
+	}, nil
+}
+
+type client struct {
+	db   *sql.DB
+	init bool
+}
+
+type sampleRow struct {
+	ID                  string
+	SampleIndex         int
+	Source              string
+	Area                string
+	Country             string
+	ExchangeWithArea    string
+	ExchangeWithCountry string
+	Resolution          string
+	Sample              apiv1.Sample
+	MeasuredAtTime      time.Time
+	RevisionNumber      int
+	FetchedAtTime       time.Time
+}
+
+func (c *client) Init() (err error) {
+
+	if !c.init {
+		return nil
+	}
+
+	var hasTimescaledb bool
+	err = c.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&hasTimescaledb)
+	if err != nil {
+		return err
+	}
+	if !hasTimescaledb {
+		log.Warn().Msg("Extension timescaledb is not installed, creating regular tables instead of hypertables")
+	}
+
+	for _, table := range tables {
+		_, err = c.db.Exec(c.getCreateTableQuery(table))
+		if err != nil {
+			return fmt.Errorf("Failed creating table %v: %w", table, err)
+		}
+
+		// tables created before revisions were tracked lack these columns
+		_, err = c.db.Exec(c.getAddRevisionColumnsQuery(table))
+		if err != nil {
+			return fmt.Errorf("Failed adding revision columns to table %v: %w", table, err)
+		}
+
+		if hasTimescaledb {
+			_, err = c.db.Exec(fmt.Sprintf("SELECT create_hypertable('%v', 'measured_at_time', if_not_exists => TRUE)", table))
+			if err != nil {
+				return fmt.Errorf("Failed creating hypertable %v: %w", table, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	table, ok := tables[stream]
+	if !ok {
+		log.Debug().Msgf("Measurements for stream %v are not stored in postgres, skipping", stream)
+		return nil
+	}
+
+	rows, err := c.toRows(measurements)
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(rows); start += maxRowsPerInsert {
+		end := start + maxRowsPerInsert
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		_, err = tx.Exec(c.getInsertQuery(table, end-start), c.getInsertArgs(rows[start:end])...)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("Failed inserting rows into table %v: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c *client) Close() (err error) {
+	return c.db.Close()
+}
+
+// ReadStoredState derives the state for generation, exchange and load from the latest time slot stored in each table
+func (c *client) ReadStoredState() (state *apiv1.State, err error) {
+
+	state = &apiv1.State{
+		LastRetrievedGenerationTime: map[apiv1.Area]time.Time{},
+		LastRetrievedExchangeTime:   map[apiv1.Area]map[apiv1.Area]time.Time{},
+		LastRetrievedLoadTime:       map[apiv1.Area]time.Time{},
+	}
+
+	err = c.queryMaxTimes(tables[apiv1.MeasurementStreamGeneration], func(area, _ string, maxTime time.Time) {
+		state.LastRetrievedGenerationTime[apiv1.Area(area)] = maxTime
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.queryMaxTimes(tables[apiv1.MeasurementStreamExchange], func(area, exchangeWithArea string, maxTime time.Time) {
+		if state.LastRetrievedExchangeTime[apiv1.Area(area)] == nil {
+			state.LastRetrievedExchangeTime[apiv1.Area(area)] = map[apiv1.Area]time.Time{}
+		}
+		state.LastRetrievedExchangeTime[apiv1.Area(area)][apiv1.Area(exchangeWithArea)] = maxTime
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.queryMaxTimes(tables[apiv1.MeasurementStreamLoad], func(area, _ string, maxTime time.Time) {
+		state.LastRetrievedLoadTime[apiv1.Area(area)] = maxTime
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (c *client) queryMaxTimes(table string, add func(area, exchangeWithArea string, maxTime time.Time)) (err error) {
+
+	rows, err := c.db.Query(c.getMaxTimesQuery(table))
+	if err != nil {
+		return fmt.Errorf("Failed querying latest time slots from table %v: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var area, exchangeWithArea string
+		var maxTime time.Time
+		err = rows.Scan(&area, &exchangeWithArea, &maxTime)
+		if err != nil {
+			return err
+		}
+		add(area, exchangeWithArea, maxTime.UTC())
+	}
+
+	return rows.Err()
+}
+
+// toRows flattens the samples of generation, exchange or load measurements into a row per sample
+func (c *client) toRows(measurements interface{}) (rows []sampleRow, err error) {
+
+	addSamples := func(row sampleRow, samples []*apiv1.Sample) {
+		for i, s := range samples {
+			if s == nil {
+				continue
+			}
+			row.SampleIndex = i
+			row.Sample = *s
+			rows = append(rows, row)
+		}
+	}
+
+	switch m := measurements.(type) {
+	case []apiv1.GenerationMeasurement:
+		for _, gm := range m {
+			addSamples(sampleRow{ID: gm.ID, Source: gm.Source, Area: gm.Area, Country: gm.Country, Resolution: gm.Resolution, MeasuredAtTime: gm.MeasuredAtTime, RevisionNumber: gm.RevisionNumber, FetchedAtTime: gm.FetchedAtTime}, gm.Samples)
+		}
+	case []apiv1.ExchangeMeasurement:
+		for _, em := range m {
+			addSamples(sampleRow{ID: em.ID, Source: em.Source, Area: em.Area, Country: em.Country, ExchangeWithArea: em.ExchangeWithArea, ExchangeWithCountry: em.ExchangeWithCountry, Resolution: em.Resolution, MeasuredAtTime: em.MeasuredAtTime}, em.Samples)
+		}
+	case []apiv1.LoadMeasurement:
+		for _, lm := range m {
+			addSamples(sampleRow{ID: lm.ID, Source: lm.Source, Area: lm.Area, Country: lm.Country, Resolution: lm.Resolution, MeasuredAtTime: lm.MeasuredAtTime}, lm.Samples)
+		}
+	default:
+		return nil, ErrIncorrectTypeMeasurement
+	}
+
+	return rows, nil
+}
+
+func (c *client) getCreateTableQuery(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+  measured_at_time TIMESTAMPTZ NOT NULL,
+  id TEXT NOT NULL,
+  sample_index INTEGER NOT NULL,
+  source TEXT NOT NULL,
+  area TEXT NOT NULL,
+  country TEXT NOT NULL,
+  exchange_with_area TEXT NOT NULL,
+  exchange_with_country TEXT NOT NULL,
+  resolution TEXT NOT NULL,
+  energy_type TEXT NOT NULL,
+  original_energy_type TEXT NOT NULL,
+  is_renewable BOOLEAN NOT NULL,
+  carbon_intensity DOUBLE PRECISION NOT NULL,
+  direct_carbon_intensity DOUBLE PRECISION NOT NULL,
+  metric_type TEXT NOT NULL,
+  sample_direction TEXT NOT NULL,
+  sample_unit TEXT NOT NULL,
+  value DOUBLE PRECISION NOT NULL,
+  revision_number INTEGER NOT NULL DEFAULT 0,
+  fetched_at_time TIMESTAMPTZ,
+  PRIMARY KEY (measured_at_time, id, sample_index)
+)`, table)
+}
+
+func (c *client) getAddRevisionColumnsQuery(table string) string {
+	return fmt.Sprintf("ALTER TABLE %v ADD COLUMN IF NOT EXISTS revision_number INTEGER NOT NULL DEFAULT 0, ADD COLUMN IF NOT EXISTS fetched_at_time TIMESTAMPTZ", table)
+}
+
+// getMaxTimesQuery returns a query for the latest time slot per area and exchange area, which is empty for all but exchanges
+func (c *client) getMaxTimesQuery(table string) string {
+	return fmt.Sprintf("SELECT area, exchange_with_area, MAX(measured_at_time) FROM %v GROUP BY area, exchange_with_area", table)
+}
+
+// getInsertQuery returns a query inserting nrOfRows rows, updating rows stored before so re-runs don't add duplicates
+func (c *client) getInsertQuery(table string, nrOfRows int) string {
+	values := make([]string, nrOfRows)
+	for i := range values {
+		placeholders := make([]string, len(columns))
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%v", i*len(columns)+j+1)
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	updates := []string{}
+	for _, column := range columns[3:] {
+		updates = append(updates, fmt.Sprintf("%v = EXCLUDED.%v", column, column))
+	}
+
+	return fmt.Sprintf("INSERT INTO %v (%v) VALUES %v ON CONFLICT (measured_at_time, id, sample_index) DO UPDATE SET %v", table, strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+}
+
+func (c *client) getInsertArgs(rows []sampleRow) (args []interface{}) {
+	for _, r := range rows {
+		args = append(args,
+			r.MeasuredAtTime,
+			r.ID,
+			r.SampleIndex,
+			r.Source,
+			r.Area,
+			r.Country,
+			r.ExchangeWithArea,
+			r.ExchangeWithCountry,
+			r.Resolution,
+			string(r.Sample.EnergyType),
+			r.Sample.OriginalEnergyType,
+			r.Sample.IsRenewable,
+			r.Sample.CarbonIntensity,
+			r.Sample.DirectCarbonIntensity,
+			string(r.Sample.MetricType),
+			string(r.Sample.SampleDirection),
+			string(r.Sample.SampleUnit),
+			r.Sample.Value,
+			r.RevisionNumber,
+			c.toNullTime(r.FetchedAtTime),
+		)
+	}
+
+	return args
+}
+
+// toNullTime stores an unknown time as null instead of the zero time
+func (c *client) toNullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
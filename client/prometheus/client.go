@@ -0,0 +1,231 @@
+package prometheus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	generationDesc = prometheusclient.NewDesc(
+		"electricity_generation_megawatts",
+		"Generation per energy type in the most recent time slot.",
+		[]string{"area", "country", "energy_type", "renewable", "direction"}, nil,
+	)
+	exchangeDesc = prometheusclient.NewDesc(
+		"electricity_exchange_megawatts",
+		"Cross-border flow with a neighbouring area in the most recent time slot.",
+		[]string{"area", "country", "peer", "peer_country", "direction"}, nil,
+	)
+	loadDesc = prometheusclient.NewDesc(
+		"electricity_load_megawatts",
+		"Total load in the most recent time slot.",
+		[]string{"area", "country"}, nil,
+	)
+	priceDesc = prometheusclient.NewDesc(
+		"electricity_day_ahead_price_per_megawatthour",
+		"Day-ahead price in the most recent time slot.",
+		[]string{"area", "country", "currency"}, nil,
+	)
+	timeSlotDesc = prometheusclient.NewDesc(
+		"electricity_time_slot_start_timestamp_seconds",
+		"Start of the most recent time slot the metrics of a stream belong to.",
+		[]string{"stream", "area"}, nil,
+	)
+)
+
+// Client is the interface for exposing the most recent measurements as prometheus metrics
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// NewClient returns new prometheus.Client, registering its metrics and any additional collectors with registerer and pushing
+// them to the pushgateway on close if pushgatewayURL is set
+func NewClient(registerer prometheusclient.Registerer, pushgatewayURL, pushgatewayJob string, collectors ...prometheusclient.Collector) (Client, error) {
+
+	c := &client{
+		pushgatewayURL: pushgatewayURL,
+		pushgatewayJob: pushgatewayJob,
+		collectors:     collectors,
+		generation:     map[string]apiv1.GenerationMeasurement{},
+		exchange:       map[string]apiv1.ExchangeMeasurement{},
+		load:           map[string]apiv1.LoadMeasurement{},
+		price:          map[string]apiv1.PriceMeasurement{},
+	}
+
+	if registerer != nil {
+		for _, collector := range append([]prometheusclient.Collector{c}, collectors...) {
+			err := registerer.Register(collector)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return c, nil
+}
+
+type client struct {
+	pushgatewayURL string
+	pushgatewayJob string
+	collectors     []prometheusclient.Collector
+
+	// most recent measurement per area, or per area and peer for exchanges
+	mutex      sync.RWMutex
+	generation map[string]apiv1.GenerationMeasurement
+	exchange   map[string]apiv1.ExchangeMeasurement
+	load       map[string]apiv1.LoadMeasurement
+	price      map[string]apiv1.PriceMeasurement
+}
+
+func (c *client) Init() (err error) {
+	return nil
+}
+
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch m := measurements.(type) {
+	case []apiv1.GenerationMeasurement:
+		for _, gm := range m {
+			if last, ok := c.generation[gm.Area]; !ok || !gm.MeasuredAtTime.Before(last.MeasuredAtTime) {
+				c.generation[gm.Area] = gm
+			}
+		}
+	case []apiv1.ExchangeMeasurement:
+		for _, em := range m {
+			key := em.Area + "|" + em.ExchangeWithArea
+			if last, ok := c.exchange[key]; !ok || !em.MeasuredAtTime.Before(last.MeasuredAtTime) {
+				c.exchange[key] = em
+			}
+		}
+	case []apiv1.LoadMeasurement:
+		for _, lm := range m {
+			if last, ok := c.load[lm.Area]; !ok || !lm.MeasuredAtTime.Before(last.MeasuredAtTime) {
+				c.load[lm.Area] = lm
+			}
+		}
+	case []apiv1.PriceMeasurement:
+		// prices are published for tomorrow, so only expose the one for the current time slot
+		now := time.Now().UTC()
+		for _, pm := range m {
+			if pm.MeasuredAtTime.After(now) {
+				continue
+			}
+			if last, ok := c.price[pm.Area]; !ok || !pm.MeasuredAtTime.Before(last.MeasuredAtTime) {
+				c.price[pm.Area] = pm
+			}
+		}
+	default:
+		log.Debug().Msgf("Measurements for stream %v are not exposed as prometheus metrics, skipping", stream)
+	}
+
+	return nil
+}
+
+// Close pushes the metrics to the pushgateway, since the exporter runs too briefly to be scraped
+func (c *client) Close() (err error) {
+
+	if c.pushgatewayURL == "" {
+		return nil
+	}
+
+	pusher := push.New(c.pushgatewayURL, c.pushgatewayJob).Collector(c)
+	for _, collector := range c.collectors {
+		pusher = pusher.Collector(collector)
+	}
+
+	err = pusher.Push()
+	if err != nil {
+		return fmt.Errorf("Failed pushing metrics to pushgateway %v: %w", c.pushgatewayURL, err)
+	}
+
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (c *client) Describe(ch chan<- *prometheusclient.Desc) {
+	ch <- generationDesc
+	ch <- exchangeDesc
+	ch <- loadDesc
+	ch <- priceDesc
+	ch <- timeSlotDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *client) Collect(ch chan<- prometheusclient.Metric) {
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, gm := range c.generation {
+		c.collectSamples(ch, generationDesc, gm.Samples, func(s *apiv1.Sample) []string {
+			return []string{gm.Area, gm.Country, string(s.EnergyType), strconv.FormatBool(s.IsRenewable), string(s.SampleDirection)}
+		})
+		ch <- c.newTimeSlotMetric(apiv1.MeasurementStreamGeneration, gm.Area, gm.MeasuredAtTime)
+	}
+
+	for _, em := range c.exchange {
+		c.collectSamples(ch, exchangeDesc, em.Samples, func(s *apiv1.Sample) []string {
+			return []string{em.Area, em.Country, em.ExchangeWithArea, em.ExchangeWithCountry, string(s.SampleDirection)}
+		})
+	}
+
+	for _, lm := range c.load {
+		c.collectSamples(ch, loadDesc, lm.Samples, func(s *apiv1.Sample) []string {
+			return []string{lm.Area, lm.Country}
+		})
+		ch <- c.newTimeSlotMetric(apiv1.MeasurementStreamLoad, lm.Area, lm.MeasuredAtTime)
+	}
+
+	for _, pm := range c.price {
+		ch <- prometheusclient.MustNewConstMetric(priceDesc, prometheusclient.GaugeValue, pm.PricePerMegaWattHour, pm.Area, pm.Country, pm.Currency)
+		ch <- c.newTimeSlotMetric(apiv1.MeasurementStreamPrice, pm.Area, pm.MeasuredAtTime)
+	}
+}
+
+// collectSamples sends a metric per distinct set of label values, summing the values of samples that share them
+func (c *client) collectSamples(ch chan<- prometheusclient.Metric, desc *prometheusclient.Desc, samples []*apiv1.Sample, labelValues func(s *apiv1.Sample) []string) {
+
+	keys := []string{}
+	values := map[string]float64{}
+	valueTypes := map[string]prometheusclient.ValueType{}
+	for _, s := range samples {
+		if s == nil {
+			continue
+		}
+		key := strings.Join(labelValues(s), "\xff")
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] += s.Value
+		valueTypes[key] = c.mapToValueType(s.MetricType)
+	}
+
+	for _, key := range keys {
+		ch <- prometheusclient.MustNewConstMetric(desc, valueTypes[key], values[key], strings.Split(key, "\xff")...)
+	}
+}
+
+func (c *client) mapToValueType(metricType apiv1.MetricType) prometheusclient.ValueType {
+	if metricType == apiv1.MetricTypeCounter {
+		return prometheusclient.CounterValue
+	}
+
+	return prometheusclient.GaugeValue
+}
+
+func (c *client) newTimeSlotMetric(stream apiv1.MeasurementStream, area string, timeSlotStartTime time.Time) prometheusclient.Metric {
+	return prometheusclient.MustNewConstMetric(timeSlotDesc, prometheusclient.GaugeValue, float64(timeSlotStartTime.Unix()), string(stream), area)
+}
@@ -0,0 +1,146 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertMeasurements(t *testing.T) {
+
+	t.Run("ExposesMostRecentGenerationSummedPerEnergyType", func(t *testing.T) {
+
+		c, _ := NewClient(nil, "", "")
+		measuredAtTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		measurements := []apiv1.GenerationMeasurement{
+			{Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime.Add(-15 * time.Minute), Samples: []*apiv1.Sample{
+				{EnergyType: apiv1.EnergyTypeWindOnshore, IsRenewable: true, MetricType: apiv1.MetricTypeGauge, SampleDirection: apiv1.SampleDirectionOut, Value: 1},
+			}},
+			{Area: "10YNL----------L", Country: "NL", MeasuredAtTime: measuredAtTime, Samples: []*apiv1.Sample{
+				{EnergyType: apiv1.EnergyTypeWindOnshore, IsRenewable: true, MetricType: apiv1.MetricTypeGauge, SampleDirection: apiv1.SampleDirectionOut, Value: 2},
+				{EnergyType: apiv1.EnergyTypeWindOnshore, IsRenewable: true, MetricType: apiv1.MetricTypeGauge, SampleDirection: apiv1.SampleDirectionOut, Value: 3},
+			}},
+		}
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamGeneration, measurements)
+
+		assert.Nil(t, err)
+		err = testutil.CollectAndCompare(c.(*client), strings.NewReader(`
+# HELP electricity_generation_megawatts Generation per energy type in the most recent time slot.
+# TYPE electricity_generation_megawatts gauge
+electricity_generation_megawatts{area="10YNL----------L",country="NL",direction="Out",energy_type="WindOnshore",renewable="true"} 5
+`), "electricity_generation_megawatts")
+		assert.Nil(t, err)
+	})
+
+	t.Run("ExposesExchangePerPeerAndDirection", func(t *testing.T) {
+
+		c, _ := NewClient(nil, "", "")
+		measurements := []apiv1.ExchangeMeasurement{
+			{Area: "10YNL----------L", Country: "NL", ExchangeWithArea: "10YBE----------2", ExchangeWithCountry: "BE", Samples: []*apiv1.Sample{
+				{MetricType: apiv1.MetricTypeGauge, SampleDirection: apiv1.SampleDirectionIn, Value: 100},
+				{MetricType: apiv1.MetricTypeGauge, SampleDirection: apiv1.SampleDirectionOut, Value: 50},
+			}},
+		}
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamExchange, measurements)
+
+		assert.Nil(t, err)
+		err = testutil.CollectAndCompare(c.(*client), strings.NewReader(`
+# HELP electricity_exchange_megawatts Cross-border flow with a neighbouring area in the most recent time slot.
+# TYPE electricity_exchange_megawatts gauge
+electricity_exchange_megawatts{area="10YNL----------L",country="NL",direction="In",peer="10YBE----------2",peer_country="BE"} 100
+electricity_exchange_megawatts{area="10YNL----------L",country="NL",direction="Out",peer="10YBE----------2",peer_country="BE"} 50
+`), "electricity_exchange_megawatts")
+		assert.Nil(t, err)
+	})
+
+	t.Run("IgnoresPricesForFutureTimeSlots", func(t *testing.T) {
+
+		c, _ := NewClient(nil, "", "")
+		now := time.Now().UTC().Truncate(time.Hour)
+		measurements := []apiv1.PriceMeasurement{
+			{Area: "10YNL----------L", Country: "NL", Currency: "EUR", PricePerMegaWattHour: 50, MeasuredAtTime: now},
+			{Area: "10YNL----------L", Country: "NL", Currency: "EUR", PricePerMegaWattHour: 60, MeasuredAtTime: now.Add(24 * time.Hour)},
+		}
+
+		// act
+		err := c.InsertMeasurements(apiv1.MeasurementStreamPrice, measurements)
+
+		assert.Nil(t, err)
+		err = testutil.CollectAndCompare(c.(*client), strings.NewReader(`
+# HELP electricity_day_ahead_price_per_megawatthour Day-ahead price in the most recent time slot.
+# TYPE electricity_day_ahead_price_per_megawatthour gauge
+electricity_day_ahead_price_per_megawatthour{area="10YNL----------L",country="NL",currency="EUR"} 50
+`), "electricity_day_ahead_price_per_megawatthour")
+		assert.Nil(t, err)
+	})
+}
+
+func TestClose(t *testing.T) {
+
+	t.Run("PushesMetricsToPushgateway", func(t *testing.T) {
+
+		var path, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		c, _ := NewClient(nil, server.URL, "jarvis-electricity-mix-exporter")
+		_ = c.InsertMeasurements(apiv1.MeasurementStreamLoad, []apiv1.LoadMeasurement{
+			{Area: "10YNL----------L", Country: "NL", MeasuredAtTime: time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC), Samples: []*apiv1.Sample{{MetricType: apiv1.MetricTypeGauge, Value: 12000}}},
+		})
+
+		// act
+		err := c.Close()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "/metrics/job/jarvis-electricity-mix-exporter", path)
+		assert.Contains(t, body, "electricity_load_megawatts")
+	})
+
+	t.Run("PushesAdditionalCollectors", func(t *testing.T) {
+
+		var body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+
+		gauge := prometheusclient.NewGauge(prometheusclient.GaugeOpts{Name: "electricity_generation_gaps_open", Help: "Gaps."})
+		gauge.Set(3)
+		c, _ := NewClient(nil, server.URL, "jarvis-electricity-mix-exporter", gauge)
+
+		// act
+		err := c.Close()
+
+		assert.Nil(t, err)
+		assert.Contains(t, body, "electricity_generation_gaps_open")
+	})
+
+	t.Run("DoesNotPushWithoutPushgateway", func(t *testing.T) {
+
+		c, _ := NewClient(nil, "", "")
+
+		// act
+		err := c.Close()
+
+		assert.Nil(t, err)
+	})
+}
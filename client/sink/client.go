@@ -0,0 +1,78 @@
+package sink
+
+import (
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+)
+
+// Client is the interface for storing measurements, implemented by every storage backend
+type Client interface {
+	Init() (err error)
+	InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error)
+	Close() (err error)
+}
+
+// StateReader is implemented by sinks that can derive up to which time slot measurements have been stored
+type StateReader interface {
+	ReadStoredState() (state *apiv1.State, err error)
+}
+
+// Upserter is implemented by sinks that can tell whether they replace a measurement that's inserted again with the same id;
+// sinks that don't implement it are expected to replace it
+type Upserter interface {
+	Upserts() bool
+}
+
+// NewClient returns new sink.Client that stores measurements in all of the given sinks
+func NewClient(sinks ...Client) (Client, error) {
+	return &client{
+		sinks: sinks,
+	}, nil
+}
+
+type client struct {
+	sinks []Client
+}
+
+func (c *client) Init() (err error) {
+	for _, s := range c.sinks {
+		err = s.Init()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *client) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) (err error) {
+	for _, s := range c.sinks {
+		err = s.InsertMeasurements(stream, measurements)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Upserts returns whether every sink replaces a measurement that's inserted again with the same id, instead of adding a duplicate
+func (c *client) Upserts() bool {
+	for _, s := range c.sinks {
+		if upserter, ok := s.(Upserter); ok && !upserter.Upserts() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Close closes all sinks, so they can flush buffered measurements
+func (c *client) Close() (err error) {
+	for _, s := range c.sinks {
+		if closeErr := s.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
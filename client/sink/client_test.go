@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	err          error
+	streams      []apiv1.MeasurementStream
+	measurements []interface{}
+	closed       bool
+}
+
+func (f *fakeSink) Init() error {
+	return f.err
+}
+
+func (f *fakeSink) Close() error {
+	f.closed = true
+	return f.err
+}
+
+func (f *fakeSink) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) error {
+	f.streams = append(f.streams, stream)
+	f.measurements = append(f.measurements, measurements)
+	return f.err
+}
+
+func TestInsertMeasurements(t *testing.T) {
+
+	t.Run("InsertsMeasurementsInAllSinks", func(t *testing.T) {
+
+		sink1 := &fakeSink{}
+		sink2 := &fakeSink{}
+		client, _ := NewClient(sink1, sink2)
+		measurements := []apiv1.LoadMeasurement{{ID: "a"}}
+
+		// act
+		err := client.InsertMeasurements(apiv1.MeasurementStreamLoad, measurements)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []apiv1.MeasurementStream{apiv1.MeasurementStreamLoad}, sink1.streams)
+		assert.Equal(t, []interface{}{measurements}, sink1.measurements)
+		assert.Equal(t, []apiv1.MeasurementStream{apiv1.MeasurementStreamLoad}, sink2.streams)
+	})
+
+	t.Run("ReturnsErrorOfFailingSink", func(t *testing.T) {
+
+		sink1 := &fakeSink{err: errors.New("failed")}
+		sink2 := &fakeSink{}
+		client, _ := NewClient(sink1, sink2)
+
+		// act
+		err := client.InsertMeasurements(apiv1.MeasurementStreamLoad, []apiv1.LoadMeasurement{{ID: "a"}})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, len(sink2.streams))
+	})
+}
+
+type fakeUpsertingSink struct {
+	fakeSink
+	upserts bool
+}
+
+func (f *fakeUpsertingSink) Upserts() bool {
+	return f.upserts
+}
+
+func TestUpserts(t *testing.T) {
+
+	t.Run("ReturnsTrueIfNoSinkAddsDuplicates", func(t *testing.T) {
+
+		client, _ := NewClient(&fakeSink{}, &fakeUpsertingSink{upserts: true})
+
+		// act
+		upserts := client.(Upserter).Upserts()
+
+		assert.True(t, upserts)
+	})
+
+	t.Run("ReturnsFalseIfAnySinkAddsDuplicates", func(t *testing.T) {
+
+		client, _ := NewClient(&fakeSink{}, &fakeUpsertingSink{upserts: false})
+
+		// act
+		upserts := client.(Upserter).Upserts()
+
+		assert.False(t, upserts)
+	})
+}
+
+func TestClose(t *testing.T) {
+
+	t.Run("ClosesAllSinksEvenIfOneFails", func(t *testing.T) {
+
+		sink1 := &fakeSink{err: errors.New("failed")}
+		sink2 := &fakeSink{}
+		client, _ := NewClient(sink1, sink2)
+
+		// act
+		err := client.Close()
+
+		assert.NotNil(t, err)
+		assert.True(t, sink1.closed)
+		assert.True(t, sink2.closed)
+	})
+}
@@ -6,12 +6,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 
 	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
 	"github.com/rs/zerolog/log"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
 // Client is the interface for retrieving and storing state
@@ -20,34 +17,25 @@ type Client interface {
 	StoreState(ctx context.Context, state apiv1.State) (err error)
 }
 
-// NewClient returns new bigquery.Client
-func NewClient(kubeClientset *kubernetes.Clientset, stateFilePath, stateFileConfigMapName string) (Client, error) {
-	return &client{
-		kubeClientset:          kubeClientset,
-		stateFilePath:          stateFilePath,
-		stateFileConfigMapName: stateFileConfigMapName,
-	}, nil
+// Deriver is implemented by state clients that derive the state from the stored measurements instead of storing it; such
+// state only holds the last retrieved time slots, not the generation gaps and revisions
+type Deriver interface {
+	DerivesState() bool
 }
 
-type client struct {
-	kubeClientset          *kubernetes.Clientset
-	stateFilePath          string
-	stateFileConfigMapName string
-}
-
-func (c *client) ReadState(ctx context.Context) (state *apiv1.State, err error) {
+func readStateFile(stateFilePath string) (state *apiv1.State, err error) {
 
-	// check if last measurement file exists in configmap
-	if _, err := os.Stat(c.stateFilePath); !os.IsNotExist(err) {
-		log.Info().Msgf("File %v exists, reading contents...", c.stateFilePath)
+	// check if last measurement file exists
+	if _, err := os.Stat(stateFilePath); !os.IsNotExist(err) {
+		log.Info().Msgf("File %v exists, reading contents...", stateFilePath)
 
 		// read state file
-		data, err := ioutil.ReadFile(c.stateFilePath)
+		data, err := ioutil.ReadFile(stateFilePath)
 		if err != nil {
-			return nil, fmt.Errorf("Failed reading file from path %v: %w", c.stateFilePath, err)
+			return nil, fmt.Errorf("Failed reading file from path %v: %w", stateFilePath, err)
 		}
 
-		log.Info().Msgf("Unmarshalling file %v contents...", c.stateFilePath)
+		log.Info().Msgf("Unmarshalling file %v contents...", stateFilePath)
 
 		// unmarshal state file
 		if err := json.Unmarshal(data, &state); err != nil {
@@ -57,44 +45,3 @@ func (c *client) ReadState(ctx context.Context) (state *apiv1.State, err error)
 
 	return
 }
-
-func (c *client) StoreState(ctx context.Context, state apiv1.State) (err error) {
-
-	currentNamespace, err := c.getCurrentNamespace()
-	if err != nil {
-		return
-	}
-
-	// retrieve configmap
-	configMap, err := c.kubeClientset.CoreV1().ConfigMaps(currentNamespace).Get(ctx, c.stateFileConfigMapName, metav1.GetOptions{})
-	if err != nil {
-		return fmt.Errorf("Failed retrieving configmap %v: %w", c.stateFileConfigMapName, err)
-	}
-
-	// marshal state to json
-	stateData, err := json.Marshal(state)
-	if configMap.Data == nil {
-		configMap.Data = make(map[string]string)
-	}
-
-	configMap.Data[filepath.Base(c.stateFilePath)] = string(stateData)
-
-	// update configmap to have measurement available when the application runs the next time and for other applications
-	_, err = c.kubeClientset.CoreV1().ConfigMaps(currentNamespace).Update(ctx, configMap, metav1.UpdateOptions{})
-	if err != nil {
-		return fmt.Errorf("Failed updating configmap %v: %w", c.stateFileConfigMapName, err)
-	}
-
-	log.Info().Msgf("Stored state in configmap %v...", c.stateFileConfigMapName)
-
-	return nil
-}
-
-func (c *client) getCurrentNamespace() (namespace string, err error) {
-	ns, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
-	if err != nil {
-		return namespace, fmt.Errorf("Failed reading namespace: %w", err)
-	}
-
-	return string(ns), nil
-}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewConfigMapClient returns new state.Client that reads state from the mounted configmap and stores it through the kubernetes api
+func NewConfigMapClient(kubeClientset *kubernetes.Clientset, stateFilePath, stateFileConfigMapName string) (Client, error) {
+	return &configMapClient{
+		kubeClientset:          kubeClientset,
+		stateFilePath:          stateFilePath,
+		stateFileConfigMapName: stateFileConfigMapName,
+	}, nil
+}
+
+type configMapClient struct {
+	kubeClientset          *kubernetes.Clientset
+	stateFilePath          string
+	stateFileConfigMapName string
+}
+
+func (c *configMapClient) ReadState(ctx context.Context) (state *apiv1.State, err error) {
+	// the configmap is mounted as a volume, so it can be read as a file
+	return readStateFile(c.stateFilePath)
+}
+
+func (c *configMapClient) StoreState(ctx context.Context, state apiv1.State) (err error) {
+
+	currentNamespace, err := c.getCurrentNamespace()
+	if err != nil {
+		return
+	}
+
+	// retrieve configmap
+	configMap, err := c.kubeClientset.CoreV1().ConfigMaps(currentNamespace).Get(ctx, c.stateFileConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed retrieving configmap %v: %w", c.stateFileConfigMapName, err)
+	}
+
+	// marshal state to json
+	stateData, err := json.Marshal(state)
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+
+	configMap.Data[filepath.Base(c.stateFilePath)] = string(stateData)
+
+	// update configmap to have measurement available when the application runs the next time and for other applications
+	_, err = c.kubeClientset.CoreV1().ConfigMaps(currentNamespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed updating configmap %v: %w", c.stateFileConfigMapName, err)
+	}
+
+	log.Info().Msgf("Stored state in configmap %v...", c.stateFileConfigMapName)
+
+	return nil
+}
+
+func (c *configMapClient) getCurrentNamespace() (namespace string, err error) {
+	ns, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return namespace, fmt.Errorf("Failed reading namespace: %w", err)
+	}
+
+	return string(ns), nil
+}
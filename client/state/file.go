@@ -0,0 +1,68 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// NewFileClient returns new state.Client that reads and stores state in a local file, for running outside of kubernetes
+func NewFileClient(stateFilePath string) (Client, error) {
+	return &fileClient{
+		stateFilePath: stateFilePath,
+	}, nil
+}
+
+type fileClient struct {
+	stateFilePath string
+}
+
+func (c *fileClient) ReadState(ctx context.Context) (state *apiv1.State, err error) {
+	return readStateFile(c.stateFilePath)
+}
+
+// StoreState writes the state to a temporary file and renames it, so an interrupted write never corrupts the state file
+func (c *fileClient) StoreState(ctx context.Context, state apiv1.State) (err error) {
+
+	stateData, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// the temporary file has to be in the same directory to be renamed atomically
+	tmpFile, err := ioutil.TempFile(filepath.Dir(c.stateFilePath), filepath.Base(c.stateFilePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Failed creating temporary file for %v: %w", c.stateFilePath, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(stateData)
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("Failed writing temporary file for %v: %w", c.stateFilePath, err)
+	}
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("Failed writing temporary file for %v: %w", c.stateFilePath, err)
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("Failed writing temporary file for %v: %w", c.stateFilePath, err)
+	}
+
+	err = os.Rename(tmpFile.Name(), c.stateFilePath)
+	if err != nil {
+		return fmt.Errorf("Failed renaming temporary file to %v: %w", c.stateFilePath, err)
+	}
+
+	log.Info().Msgf("Stored state in file %v...", c.stateFilePath)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileClient(t *testing.T) {
+
+	t.Run("ReadsStoredState", func(t *testing.T) {
+
+		stateFilePath := filepath.Join(t.TempDir(), "last-state.json")
+		client, _ := NewFileClient(stateFilePath)
+		lastRetrievedGenerationTime := time.Date(2021, 3, 12, 10, 15, 0, 0, time.UTC)
+		err := client.StoreState(context.Background(), apiv1.State{
+			LastRetrievedGenerationTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: lastRetrievedGenerationTime},
+		})
+		assert.Nil(t, err)
+
+		// act
+		state, err := client.ReadState(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, lastRetrievedGenerationTime, state.LastRetrievedGenerationTime[apiv1.AreaNetherlands])
+		files, _ := ioutil.ReadDir(filepath.Dir(stateFilePath))
+		assert.Equal(t, 1, len(files))
+	})
+
+	t.Run("ReturnsNilStateIfFileDoesNotExist", func(t *testing.T) {
+
+		client, _ := NewFileClient(filepath.Join(t.TempDir(), "last-state.json"))
+
+		// act
+		state, err := client.ReadState(context.Background())
+
+		assert.Nil(t, err)
+		assert.Nil(t, state)
+	})
+}
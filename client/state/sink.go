@@ -0,0 +1,34 @@
+package state
+
+import (
+	"context"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/sink"
+	"github.com/rs/zerolog/log"
+)
+
+// NewSinkClient returns new state.Client that derives the state from the measurements stored in a sink, so no state has to be stored at all
+func NewSinkClient(stateReader sink.StateReader) (Client, error) {
+	return &sinkClient{
+		stateReader: stateReader,
+	}, nil
+}
+
+type sinkClient struct {
+	stateReader sink.StateReader
+}
+
+func (c *sinkClient) ReadState(ctx context.Context) (state *apiv1.State, err error) {
+	return c.stateReader.ReadStoredState()
+}
+
+func (c *sinkClient) DerivesState() bool {
+	return true
+}
+
+func (c *sinkClient) StoreState(ctx context.Context, state apiv1.State) (err error) {
+	// the state is derived from the stored measurements the next time
+	log.Debug().Msg("State is derived from stored measurements, not storing it")
+	return nil
+}
@@ -11,13 +11,18 @@ require (
 	github.com/alecthomas/repr v0.0.0-20210301060118-828286944d6a // indirect
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20190910110746-680d30ca3117 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/estafette/estafette-foundation v0.0.61
 	github.com/google/uuid v1.1.1
+	github.com/lib/pq v1.10.0
 	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/prometheus/client_golang v0.9.2
 	github.com/rs/zerolog v1.17.2
 	github.com/sergi/go-diff v1.1.0 // indirect
-	github.com/sethgrid/pester v1.1.0
 	github.com/stretchr/testify v1.6.1
+	github.com/xitongsys/parquet-go v1.5.2
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	google.golang.org/api v0.15.0
 	gopkg.in/yaml.v2 v2.2.8
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
 	k8s.io/apimachinery v0.19.2
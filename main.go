@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"runtime"
 
 	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/bigquery"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/config"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/entsoe"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/file"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/influxdb"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/mqtt"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/postgres"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/prometheus"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/sink"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/state"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/service/exporter"
 	"github.com/alecthomas/kingpin"
 	foundation "github.com/estafette/estafette-foundation"
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -28,16 +37,60 @@ var (
 	goVersion = runtime.Version()
 
 	// application specific config
-	entsoeToken = kingpin.Flag("entsoe-token", "Api token for https://transparency.entsoe.eu/api").Envar("ENTSOE_TOKEN").Required().String()
+	entsoeToken             = kingpin.Flag("entsoe-token", "Api token for https://transparency.entsoe.eu/api").Envar("ENTSOE_TOKEN").Required().String()
+	entsoeRequestsPerMinute = kingpin.Flag("entsoe-requests-per-minute", "Maximum number of requests per minute to https://transparency.entsoe.eu/api, shared by all workers").Default("400").OverrideDefaultFromEnvar("ENTSOE_REQUESTS_PER_MINUTE").Int()
+	entsoeBaseURL           = kingpin.Flag("entsoe-base-url", "Base url of the entsoe transparency platform api").Default(entsoe.DefaultBaseURL).OverrideDefaultFromEnvar("ENTSOE_BASE_URL").String()
+	entsoeRequestTimeout    = kingpin.Flag("entsoe-request-timeout", "Timeout for a single request to the entsoe api, including reading the response").Default("60s").OverrideDefaultFromEnvar("ENTSOE_REQUEST_TIMEOUT").Duration()
+	entsoeMaxAttempts       = kingpin.Flag("entsoe-max-attempts", "Maximum number of attempts for requests to the entsoe api failing with a network error, 429 or 5xx status").Default("3").OverrideDefaultFromEnvar("ENTSOE_MAX_ATTEMPTS").Int()
+	entsoeInitialBackoff    = kingpin.Flag("entsoe-initial-backoff", "Time to wait before the first retry of a failed request to the entsoe api, doubling for every next retry").Default("1s").OverrideDefaultFromEnvar("ENTSOE_INITIAL_BACKOFF").Duration()
+	entsoeMaxBackoff        = kingpin.Flag("entsoe-max-backoff", "Maximum time to wait between retries of a failed request to the entsoe api").Default("30s").OverrideDefaultFromEnvar("ENTSOE_MAX_BACKOFF").Duration()
+	concurrency             = kingpin.Flag("concurrency", "Number of areas retrieved concurrently").Default("4").OverrideDefaultFromEnvar("CONCURRENCY").Int()
 
-	bigqueryEnable          = kingpin.Flag("bigquery-enable", "Toggle to enable or disable bigquery integration").Default("true").OverrideDefaultFromEnvar("BQ_ENABLE").Bool()
-	bigqueryInit            = kingpin.Flag("bigquery-init", "Toggle to enable bigquery table initialization").Default("true").OverrideDefaultFromEnvar("BQ_INIT").Bool()
-	bigqueryProjectID       = kingpin.Flag("bigquery-project-id", "Google Cloud project id that contains the BigQuery dataset").Envar("BQ_PROJECT_ID").Required().String()
-	bigqueryDataset         = kingpin.Flag("bigquery-dataset", "Name of the BigQuery dataset").Envar("BQ_DATASET").Required().String()
-	bigqueryGenerationTable = kingpin.Flag("bigquery-generation-table", "Name of the BigQuery table with generation measurements").Envar("BQ_GENERATION_TABLE").Required().String()
-	bigqueryExchangeTable   = kingpin.Flag("bigquery-exchange-table", "Name of the BigQuery table with generation measurements").Envar("BQ_EXCHANGE_TABLE").Required().String()
+	bigqueryEnable           = kingpin.Flag("bigquery-enable", "Toggle to enable or disable bigquery integration").Default("true").OverrideDefaultFromEnvar("BQ_ENABLE").Bool()
+	bigqueryUpsert           = kingpin.Flag("bigquery-upsert", "Toggle to merge measurements by id instead of streaming them, to safely repeat backfills; uses load jobs and dml, which have daily quotas").Default("false").OverrideDefaultFromEnvar("BQ_UPSERT").Bool()
+	bigqueryInit             = kingpin.Flag("bigquery-init", "Toggle to enable bigquery table initialization").Default("true").OverrideDefaultFromEnvar("BQ_INIT").Bool()
+	bigqueryProjectID        = kingpin.Flag("bigquery-project-id", "Google Cloud project id that contains the BigQuery dataset").Envar("BQ_PROJECT_ID").String()
+	bigqueryDataset          = kingpin.Flag("bigquery-dataset", "Name of the BigQuery dataset").Envar("BQ_DATASET").String()
+	bigqueryGenerationTable  = kingpin.Flag("bigquery-generation-table", "Name of the BigQuery table with generation measurements").Envar("BQ_GENERATION_TABLE").String()
+	bigqueryExchangeTable    = kingpin.Flag("bigquery-exchange-table", "Name of the BigQuery table with exchange measurements").Envar("BQ_EXCHANGE_TABLE").String()
+	bigqueryBalanceTable     = kingpin.Flag("bigquery-balance-table", "Name of the BigQuery table with balance measurements").Envar("BQ_BALANCE_TABLE").String()
+	bigqueryConsumptionTable = kingpin.Flag("bigquery-consumption-table", "Name of the BigQuery table with consumption measurements").Envar("BQ_CONSUMPTION_TABLE").String()
+	bigqueryLoadTable        = kingpin.Flag("bigquery-load-table", "Name of the BigQuery table with load measurements").Envar("BQ_LOAD_TABLE").String()
+	bigqueryForecastTable    = kingpin.Flag("bigquery-forecast-table", "Name of the BigQuery table with forecast measurements").Envar("BQ_FORECAST_TABLE").String()
+	bigqueryPriceTable       = kingpin.Flag("bigquery-price-table", "Name of the BigQuery table with price measurements").Envar("BQ_PRICE_TABLE").String()
+	bigqueryCapacityTable    = kingpin.Flag("bigquery-capacity-table", "Name of the BigQuery table with installed capacity measurements").Envar("BQ_CAPACITY_TABLE").String()
+
+	postgresEnable           = kingpin.Flag("postgres-enable", "Toggle to enable or disable postgres / timescaledb integration").Default("false").OverrideDefaultFromEnvar("POSTGRES_ENABLE").Bool()
+	postgresInit             = kingpin.Flag("postgres-init", "Toggle to enable postgres table initialization").Default("true").OverrideDefaultFromEnvar("POSTGRES_INIT").Bool()
+	postgresConnectionString = kingpin.Flag("postgres-connection-string", "Connection string for the postgres / timescaledb database").Envar("POSTGRES_CONNECTION_STRING").String()
+
+	mqttEnable      = kingpin.Flag("mqtt-enable", "Toggle to publish the most recent measurements per area to retained mqtt topics").Default("false").OverrideDefaultFromEnvar("MQTT_ENABLE").Bool()
+	mqttBrokerURL   = kingpin.Flag("mqtt-broker-url", "Url of the mqtt broker, like tcp://mosquitto:1883").Envar("MQTT_BROKER_URL").String()
+	mqttClientID    = kingpin.Flag("mqtt-client-id", "Client id to connect to the mqtt broker with").Default("jarvis-electricity-mix-exporter").OverrideDefaultFromEnvar("MQTT_CLIENT_ID").String()
+	mqttUsername    = kingpin.Flag("mqtt-username", "Username to connect to the mqtt broker with").Envar("MQTT_USERNAME").String()
+	mqttPassword    = kingpin.Flag("mqtt-password", "Password to connect to the mqtt broker with").Envar("MQTT_PASSWORD").String()
+	mqttTopicPrefix = kingpin.Flag("mqtt-topic-prefix", "Prefix of the topics to publish to").Default("jarvis/electricity-mix").OverrideDefaultFromEnvar("MQTT_TOPIC_PREFIX").String()
+	mqttQos         = kingpin.Flag("mqtt-qos", "Quality of service to publish with").Default("1").OverrideDefaultFromEnvar("MQTT_QOS").Uint8()
+
+	fileEnable    = kingpin.Flag("file-enable", "Toggle to write measurements to local files partitioned by area and date").Default("false").OverrideDefaultFromEnvar("FILE_ENABLE").Bool()
+	fileDirectory = kingpin.Flag("file-directory", "Directory to write the measurement files to").Default("/data").OverrideDefaultFromEnvar("FILE_DIRECTORY").String()
+	fileFormat    = kingpin.Flag("file-format", "Format of the measurement files, parquet or csv").Default("parquet").OverrideDefaultFromEnvar("FILE_FORMAT").Enum("parquet", "csv")
+
+	prometheusEnable         = kingpin.Flag("prometheus-enable", "Toggle to expose the most recent measurements as prometheus metrics").Default("false").OverrideDefaultFromEnvar("PROMETHEUS_ENABLE").Bool()
+	prometheusPort           = kingpin.Flag("prometheus-port", "Port to serve prometheus metrics on at /metrics").Default("9101").OverrideDefaultFromEnvar("PROMETHEUS_PORT").Int()
+	prometheusPushgatewayURL = kingpin.Flag("prometheus-pushgateway-url", "Url of the prometheus pushgateway to push metrics to when finished, since a cronjob is too short-lived to be scraped").Envar("PROMETHEUS_PUSHGATEWAY_URL").String()
+	prometheusPushgatewayJob = kingpin.Flag("prometheus-pushgateway-job", "Job name to push metrics to the prometheus pushgateway with").Default("jarvis-electricity-mix-exporter").OverrideDefaultFromEnvar("PROMETHEUS_PUSHGATEWAY_JOB").String()
+
+	influxdbEnable       = kingpin.Flag("influxdb-enable", "Toggle to enable or disable writing generation and exchange measurements to influxdb").Default("false").OverrideDefaultFromEnvar("INFLUXDB_ENABLE").Bool()
+	influxdbURL          = kingpin.Flag("influxdb-url", "Url of the influxdb server").Envar("INFLUXDB_URL").String()
+	influxdbOrganization = kingpin.Flag("influxdb-organization", "Influxdb organization to write to").Envar("INFLUXDB_ORGANIZATION").String()
+	influxdbBucket       = kingpin.Flag("influxdb-bucket", "Influxdb bucket to write to").Envar("INFLUXDB_BUCKET").String()
+	influxdbToken        = kingpin.Flag("influxdb-token", "Influxdb api token with write access to the bucket").Envar("INFLUXDB_TOKEN").String()
+	influxdbBatchSize    = kingpin.Flag("influxdb-batch-size", "Maximum number of points per write to influxdb").Default("5000").OverrideDefaultFromEnvar("INFLUXDB_BATCH_SIZE").Int()
 
 	configPath                   = kingpin.Flag("config-path", "Path to the config.yaml file").Default("/configs/config.yaml").OverrideDefaultFromEnvar("CONFIG_PATH").String()
+	stateBackend                 = kingpin.Flag("state-backend", "Where to keep state: configmap to store it through the kubernetes api, file to store it in the state file, or bigquery to derive it from the stored measurements").Default("configmap").OverrideDefaultFromEnvar("STATE_BACKEND").Enum("configmap", "file", "bigquery")
+	cursorPolicy                 = kingpin.Flag("cursor-policy", "How to resume when the state and the latest measurements stored in the sink disagree: none to skip the check, state or sink to trust either, earliest to avoid gaps or latest to avoid refetching").Default("none").OverrideDefaultFromEnvar("CURSOR_POLICY").Enum("none", "state", "sink", "earliest", "latest")
 	measurementFilePath          = kingpin.Flag("state-file-path", "Path to file with state.").Default("/configs/last-state.json").OverrideDefaultFromEnvar("STATE_FILE_PATH").String()
 	measurementFileConfigMapName = kingpin.Flag("state-file-configmap-name", "Name of the configmap with state file.").Default("jarvis-electricity-mix-exporter").OverrideDefaultFromEnvar("STATE_FILE_CONFIG_MAP_NAME").String()
 )
@@ -53,37 +106,78 @@ func main() {
 	// create context to cancel commands on sigterm
 	ctx := foundation.InitCancellationContext(context.Background())
 
-	// init bigquery client
-	generationBigqueryClient, err := bigquery.NewClient(*bigqueryProjectID, *bigqueryEnable, *bigqueryDataset, *bigqueryGenerationTable, apiv1.GenerationMeasurement{}, "MeasuredAtTime")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed creating bigquery.Client for GenerationMeasurement")
+	sinks := []sink.Client{}
+
+	var bigquerySinkClient sink.Client
+	if *bigqueryEnable {
+		var err error
+		bigquerySinkClient, err = newBigquerySinkClient()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating bigquery sink")
+		}
+		sinks = append(sinks, bigquerySinkClient)
 	}
-	exchangeBigqueryClient, err := bigquery.NewClient(*bigqueryProjectID, *bigqueryEnable, *bigqueryDataset, *bigqueryExchangeTable, apiv1.ExchangeMeasurement{}, "MeasuredAtTime")
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed creating bigquery.Client for ExchangeMeasurement")
+
+	if *postgresEnable {
+		if *postgresConnectionString == "" {
+			log.Fatal().Msg("Flag postgres-connection-string is required when postgres is enabled")
+		}
+		postgresClient, err := postgres.NewClient(*postgresConnectionString, *postgresInit)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating postgres.Client")
+		}
+		sinks = append(sinks, postgresClient)
+	}
+
+	if *influxdbEnable {
+		if *influxdbURL == "" || *influxdbOrganization == "" || *influxdbBucket == "" {
+			log.Fatal().Msg("Flags influxdb-url, influxdb-organization and influxdb-bucket are required when influxdb is enabled")
+		}
+		influxdbClient, err := influxdb.NewClient(*influxdbURL, *influxdbOrganization, *influxdbBucket, *influxdbToken, *influxdbBatchSize)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating influxdb.Client")
+		}
+		sinks = append(sinks, influxdbClient)
+	}
+
+	if *mqttEnable {
+		if *mqttBrokerURL == "" {
+			log.Fatal().Msg("Flag mqtt-broker-url is required when mqtt is enabled")
+		}
+		mqttClient, err := mqtt.NewClient(*mqttBrokerURL, *mqttClientID, *mqttUsername, *mqttPassword, *mqttTopicPrefix, *mqttQos)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed creating mqtt.Client")
+		}
+		sinks = append(sinks, mqttClient)
 	}
 
-	// init bigquery table if it doesn't exist yet
-	if *bigqueryInit {
-		err = generationBigqueryClient.InitBigqueryTable()
+	if *fileEnable {
+		fileClient, err := file.NewClient(*fileDirectory, *fileFormat)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed initializing bigquery table for GenerationMeasurement")
+			log.Fatal().Err(err).Msg("Failed creating file.Client")
 		}
-		err = exchangeBigqueryClient.InitBigqueryTable()
+		sinks = append(sinks, fileClient)
+	}
+
+	if *prometheusEnable {
+		prometheusClient, err := prometheus.NewClient(prometheusclient.DefaultRegisterer, *prometheusPushgatewayURL, *prometheusPushgatewayJob, exporter.Collectors()...)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed initializing bigquery table for ExchangeMeasurement")
+			log.Fatal().Err(err).Msg("Failed creating prometheus.Client")
 		}
+		sinks = append(sinks, prometheusClient)
+
+		foundation.InitMetricsWithPort(*prometheusPort)
 	}
 
-	// create kubernetes api client
-	kubeClientConfig, err := rest.InClusterConfig()
+	sinkClient, err := sink.NewClient(sinks...)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed retrieving kubeClientConfig")
+		log.Fatal().Err(err).Msg("Failed creating sink.Client")
 	}
-	// creates the clientset
-	kubeClientset, err := kubernetes.NewForConfig(kubeClientConfig)
+
+	// init tables if they don't exist yet
+	err = sinkClient.Init()
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed creating kubeClientset")
+		log.Fatal().Err(err).Msg("Failed initializing sinks")
 	}
 
 	configClient, err := config.NewClient(*configPath)
@@ -91,17 +185,21 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed creating config.Client")
 	}
 
-	stateClient, err := state.NewClient(kubeClientset, *measurementFilePath, *measurementFileConfigMapName)
+	stateClient, err := newStateClient(bigquerySinkClient)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed creating state.Client")
 	}
 
-	entsoeClient, err := entsoe.NewClient(*entsoeToken)
+	entsoeClient, err := entsoe.NewClient(&http.Client{Timeout: *entsoeRequestTimeout}, *entsoeBaseURL, *entsoeToken, *entsoeRequestsPerMinute, entsoe.RetryPolicy{
+		MaxAttempts:    *entsoeMaxAttempts,
+		InitialBackoff: *entsoeInitialBackoff,
+		MaxBackoff:     *entsoeMaxBackoff,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed creating entsoe.client")
 	}
 
-	exporterService, err := exporter.NewService(generationBigqueryClient, exchangeBigqueryClient, configClient, stateClient, entsoeClient)
+	exporterService, err := exporter.NewService(sinkClient, configClient, stateClient, entsoeClient, *concurrency, getStateReader(sinks), apiv1.CursorPolicy(*cursorPolicy))
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed creating exporter.Service")
 	}
@@ -114,4 +212,97 @@ func main() {
 	}
 
 	waitGroup.Wait()
+
+	// flush measurements buffered by sinks
+	err = sinkClient.Close()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed closing sinks")
+	}
+}
+
+// newBigquerySinkClient creates a bigquery.Client per measurement stream with a configured table, each storing its measurements in its own table
+func newBigquerySinkClient() (sink.Client, error) {
+
+	if *bigqueryProjectID == "" || *bigqueryDataset == "" {
+		return nil, fmt.Errorf("Flags bigquery-project-id and bigquery-dataset are required when bigquery is enabled")
+	}
+
+	tables := []struct {
+		stream         apiv1.MeasurementStream
+		table          string
+		typeForSchema  interface{}
+		partitionField string
+	}{
+		{apiv1.MeasurementStreamGeneration, *bigqueryGenerationTable, apiv1.GenerationMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamExchange, *bigqueryExchangeTable, apiv1.ExchangeMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamBalance, *bigqueryBalanceTable, apiv1.BalanceMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamConsumption, *bigqueryConsumptionTable, apiv1.ConsumptionMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamLoad, *bigqueryLoadTable, apiv1.LoadMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamForecast, *bigqueryForecastTable, apiv1.ForecastMeasurement{}, "ForecastForTime"},
+		{apiv1.MeasurementStreamPrice, *bigqueryPriceTable, apiv1.PriceMeasurement{}, "MeasuredAtTime"},
+		{apiv1.MeasurementStreamCapacity, *bigqueryCapacityTable, apiv1.CapacityMeasurement{}, "MeasuredAtTime"},
+	}
+
+	clients := map[apiv1.MeasurementStream]bigquery.Client{}
+	for _, t := range tables {
+		if t.table == "" {
+			log.Info().Msgf("No bigquery table has been set for %v measurements, they won't be stored in bigquery", t.stream)
+			continue
+		}
+
+		client, err := bigquery.NewClient(*bigqueryProjectID, *bigqueryEnable, *bigqueryDataset, t.table, t.typeForSchema, t.partitionField, *bigqueryUpsert)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating bigquery.Client for %v measurements: %w", t.stream, err)
+		}
+		clients[t.stream] = client
+	}
+
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("At least one bigquery table has to be set when bigquery is enabled")
+	}
+
+	return bigquery.NewSinkClient(clients, *bigqueryInit, *bigqueryUpsert)
+}
+
+// getStateReader returns the first sink that can derive state from its stored measurements, or nil if none of them can
+func getStateReader(sinks []sink.Client) sink.StateReader {
+	for _, s := range sinks {
+		if stateReader, ok := s.(sink.StateReader); ok {
+			return stateReader
+		}
+	}
+
+	return nil
+}
+
+// newStateClient returns the state.Client for the configured backend; only the configmap backend needs to run inside kubernetes
+func newStateClient(bigquerySinkClient sink.Client) (state.Client, error) {
+	switch *stateBackend {
+	case "file":
+		return state.NewFileClient(*measurementFilePath)
+
+	case "bigquery":
+		if bigquerySinkClient == nil {
+			return nil, fmt.Errorf("State backend bigquery requires bigquery to be enabled")
+		}
+		stateReader, ok := bigquerySinkClient.(sink.StateReader)
+		if !ok {
+			return nil, fmt.Errorf("Bigquery sink can't derive state from stored measurements")
+		}
+		return state.NewSinkClient(stateReader)
+
+	default:
+		// create kubernetes api client
+		kubeClientConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Failed retrieving kubeClientConfig: %w", err)
+		}
+		// creates the clientset
+		kubeClientset, err := kubernetes.NewForConfig(kubeClientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Failed creating kubeClientset: %w", err)
+		}
+
+		return state.NewConfigMapClient(kubeClientset, *measurementFilePath, *measurementFileConfigMapName)
+	}
 }
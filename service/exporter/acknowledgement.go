@@ -0,0 +1,39 @@
+package exporter
+
+import (
+	"errors"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// requestSplittingTooLarge calls request for the time interval and, as long as entsoe rejects the query as too large, for the
+// first half of it instead; it returns the interval that has actually been retrieved, so the caller can continue after it
+func (s *service) requestSplittingTooLarge(timeInterval apiv1.TimeInterval, resolution time.Duration, request func(timeInterval apiv1.TimeInterval) error) (apiv1.TimeInterval, error) {
+	for {
+		err := request(timeInterval)
+		if !errors.Is(err, apiv1.ErrQueryTooLarge) {
+			return timeInterval, err
+		}
+
+		half := (timeInterval.End.Sub(timeInterval.Start) / 2).Truncate(resolution)
+		if half < resolution || half <= 0 {
+			return timeInterval, err
+		}
+
+		log.Warn().Err(err).Msgf("Query for %v to %v is too large, retrying for %v to %v", timeInterval.Start, timeInterval.End, timeInterval.Start, timeInterval.Start.Add(half))
+		timeInterval.End = timeInterval.Start.Add(half)
+	}
+}
+
+// isRateLimited returns true if entsoe kept rate limiting after the client retried; progress is stored per interval, so the
+// run can end without failing and the next one continues where this one stopped
+func (s *service) isRateLimited(err error) bool {
+	if errors.Is(err, apiv1.ErrRateLimited) {
+		log.Warn().Err(err).Msg("Entsoe keeps rate limiting requests, backing off until the next run")
+		return true
+	}
+
+	return false
+}
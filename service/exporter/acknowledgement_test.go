@@ -0,0 +1,102 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestRequestSplittingTooLarge(t *testing.T) {
+
+	start := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)
+	tooLargeErr := &apiv1.AcknowledgementError{StatusCode: http.StatusBadRequest, ReasonCode: apiv1.ReasonCodeOther, ReasonText: "The amount of requested data exceeds allowed limit."}
+
+	t.Run("HalvesIntervalUntilQueryIsAccepted", func(t *testing.T) {
+
+		service := service{}
+		requestedIntervals := []apiv1.TimeInterval{}
+
+		// act
+		retrievedInterval, err := service.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: start.Add(96 * time.Hour)}, 15*time.Minute, func(timeInterval apiv1.TimeInterval) error {
+			requestedIntervals = append(requestedIntervals, timeInterval)
+			if timeInterval.End.Sub(timeInterval.Start) > 24*time.Hour {
+				return tooLargeErr
+			}
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(requestedIntervals))
+		assert.Equal(t, apiv1.TimeInterval{Start: start, End: start.Add(24 * time.Hour)}, retrievedInterval)
+	})
+
+	t.Run("KeepsIntervalsAlignedToResolution", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		retrievedInterval, err := service.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: start.Add(3 * time.Hour)}, time.Hour, func(timeInterval apiv1.TimeInterval) error {
+			if timeInterval.End.Sub(timeInterval.Start) > time.Hour {
+				return tooLargeErr
+			}
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, start.Add(time.Hour), retrievedInterval.End)
+	})
+
+	t.Run("ReturnsErrorIfIntervalCantBeSplitFurther", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		_, err := service.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, 15*time.Minute, func(timeInterval apiv1.TimeInterval) error {
+			return tooLargeErr
+		})
+
+		assert.True(t, errors.Is(err, apiv1.ErrQueryTooLarge))
+	})
+
+	t.Run("ReturnsOtherErrorsWithoutSplitting", func(t *testing.T) {
+
+		service := service{}
+		nrOfRequests := 0
+
+		// act
+		_, err := service.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: start.Add(96 * time.Hour)}, 15*time.Minute, func(timeInterval apiv1.TimeInterval) error {
+			nrOfRequests++
+			return apiv1.ErrNoMatchingDataFound
+		})
+
+		assert.True(t, errors.Is(err, apiv1.ErrNoMatchingDataFound))
+		assert.Equal(t, 1, nrOfRequests)
+	})
+}
+
+func TestIsRateLimited(t *testing.T) {
+	t.Run("ReturnsTrueForWrappedRateLimitedError", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		rateLimited := service.isRateLimited(fmt.Errorf("Request returned status code 429: %w", apiv1.ErrRateLimited))
+
+		assert.True(t, rateLimited)
+	})
+
+	t.Run("ReturnsFalseForOtherErrors", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		rateLimited := service.isRateLimited(apiv1.ErrUnauthorized)
+
+		assert.False(t, rateLimited)
+	})
+}
@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+func (s *service) runForCapacities(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, config apiv1.Config, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if config.InstalledCapacity == nil || !config.InstalledCapacity.Enable {
+		return lastState, nil
+	}
+
+	// areas are checked concurrently, all sharing the rate limit of the entsoe client
+	err := s.runConcurrently(len(config.Areas), func(i int) (err error) {
+		_, err = s.runForCapacity(ctx, stop, waitGroup, *config.InstalledCapacity, *config.Areas[i], lastState)
+		return
+	})
+
+	return lastState, err
+}
+
+func (s *service) runForCapacity(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, capacityConfig apiv1.InstalledCapacityConfig, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	now := time.Now().UTC()
+
+	// installed capacity only changes once a year, so don't check more often than configured; this also holds for a refresh,
+	// otherwise the current year would be stored again on every run for as long as refresh is set
+	s.stateMutex.RLock()
+	lastCheckedCapacityTime, hasLastCheckedCapacityTime := lastState.LastCheckedCapacityTime[areaConfig.Area]
+	s.stateMutex.RUnlock()
+	if hasLastCheckedCapacityTime && now.Before(lastCheckedCapacityTime.AddDate(0, 0, capacityConfig.CheckIntervalDays)) {
+		log.Info().Msgf("Installed capacity for area %v has last been checked at %v, skipping", areaConfig.Area, lastCheckedCapacityTime)
+		return lastState, nil
+	}
+
+	log.Info().Msgf("Retrieving installed capacity for area %v / country %v", areaConfig.Area, areaConfig.Country)
+
+	// if it's the first time use the configured start year, otherwise start at the year after the last stored one
+	startYear := now.Year() - capacityConfig.StartYearsAgo
+	lastRetrievedYear := 0
+	s.stateMutex.RLock()
+	if lastState != nil && lastState.LastRetrievedCapacityTime != nil {
+		if lastRetrievedCapacityTime, ok := lastState.LastRetrievedCapacityTime[areaConfig.Area]; ok {
+			lastRetrievedYear = lastRetrievedCapacityTime.Year()
+			startYear = lastRetrievedYear + 1
+		}
+	}
+	lastChecksum, hasLastChecksum := lastState.LastRetrievedCapacityChecksum[areaConfig.Area]
+	s.stateMutex.RUnlock()
+	if capacityConfig.Refresh && startYear > now.Year() {
+		startYear = now.Year()
+	}
+
+	for year := startYear; year <= now.Year(); year++ {
+		start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		end := start.AddDate(1, 0, 0)
+
+		// installed capacity is published per year, so a year is the smallest interval a too large query can be split into
+		var response apiv1.GetInstalledGenerationCapacityAggregatedResponse
+		_, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, end.Sub(start), func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetInstalledGenerationCapacityAggregated(ctx, areaConfig.Area, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			log.Info().Msgf("No installed capacity has been published for year %v yet", year)
+			break
+		}
+
+		measurement, ok := s.createCapacityMeasurement(response, areaConfig)
+		if !ok {
+			log.Info().Msgf("No installed capacity has been returned for year %v", year)
+			break
+		}
+
+		// a refreshed year has been stored before, so it's only stored again if its values changed; without a recorded
+		// checksum that can't be told, so then it's only stored again if the sinks replace it instead of adding a duplicate
+		checksum := s.getSamplesChecksum(measurement.Samples)
+		storeMeasurement := true
+		if year <= lastRetrievedYear {
+			storeMeasurement = (hasLastChecksum && checksum != lastChecksum) || (!hasLastChecksum && s.sinkUpserts())
+		}
+		if !storeMeasurement {
+			log.Info().Msgf("Installed capacity for area %v hasn't changed for year %v, skipping", areaConfig.Area, year)
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurement
+			if storeMeasurement {
+				err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamCapacity, []apiv1.CapacityMeasurement{measurement})
+				if err != nil {
+					return err
+				}
+			}
+
+			// update state, using the requested start to stay clear of time zone differences in the returned period
+			s.stateMutex.Lock()
+			if lastState.LastRetrievedCapacityTime == nil {
+				lastState.LastRetrievedCapacityTime = make(map[apiv1.Area]time.Time, 0)
+			}
+			lastState.LastRetrievedCapacityTime[areaConfig.Area] = start
+			if lastState.LastRetrievedCapacityChecksum == nil {
+				lastState.LastRetrievedCapacityChecksum = make(map[apiv1.Area]string, 0)
+			}
+			lastState.LastRetrievedCapacityChecksum[areaConfig.Area] = checksum
+			s.stateMutex.Unlock()
+
+			if s.isStopping(stop) {
+				return s.storeState(ctx, lastState)
+			}
+
+			return nil
+		})
+		if err != nil || s.isStopping(stop) {
+			return lastState, err
+		}
+	}
+
+	err := s.storeGuarded(waitGroup, func() error {
+		s.stateMutex.Lock()
+		if lastState.LastCheckedCapacityTime == nil {
+			lastState.LastCheckedCapacityTime = make(map[apiv1.Area]time.Time, 0)
+		}
+		lastState.LastCheckedCapacityTime[areaConfig.Area] = now
+		s.stateMutex.Unlock()
+
+		// store state
+		return s.storeState(ctx, lastState)
+	})
+	if err != nil {
+		return lastState, err
+	}
+
+	return lastState, nil
+}
+
+func (s *service) createCapacityMeasurement(response apiv1.GetInstalledGenerationCapacityAggregatedResponse, areaConfig apiv1.AreaConfig) (measurement apiv1.CapacityMeasurement, ok bool) {
+	measurement = apiv1.CapacityMeasurement{
+		ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamCapacity, string(areaConfig.Source), string(areaConfig.Area), response.TimePeriod.Start),
+		Source:         string(areaConfig.Source),
+		Area:           string(areaConfig.Area),
+		Country:        string(areaConfig.Country),
+		MeasuredAtTime: response.TimePeriod.Start,
+	}
+
+	for _, ts := range response.TimeSeries {
+		// capacity is published once per year, so the first period holds it
+		if len(ts.Periods) == 0 || len(ts.Periods[0].Points) == 0 {
+			log.Warn().Msgf("Timeserie %v for psr type %v has no points", ts.ID, ts.MktPsrType.PsrType)
+			continue
+		}
+
+		if measurement.Resolution == "" {
+			measurement.Resolution = string(ts.Periods[0].Resolution)
+		}
+
+		energyType := s.mapToEnergyType(ts.MktPsrType.PsrType)
+		measurement.Samples = append(measurement.Samples, &apiv1.Sample{
+			EnergyType:         energyType,
+			OriginalEnergyType: string(ts.MktPsrType.PsrType),
+			IsRenewable:        energyType.IsRenewable(),
+			MetricType:         apiv1.MetricTypeGauge,
+			SampleDirection:    s.mapToSampleDirection(ts),
+			SampleUnit:         s.mapToSampleUnit(ts.QuanityMeasurementUnit),
+			Value:              ts.Periods[0].Points[0].Quantity,
+		})
+	}
+
+	return measurement, len(measurement.Samples) > 0
+}
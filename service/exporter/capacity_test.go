@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestCreateCapacityMeasurement(t *testing.T) {
+	t.Run("CreatesSamplePerTimeSerie", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A68-response.xml")
+		var response apiv1.GetInstalledGenerationCapacityAggregatedResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement, ok := service.createCapacityMeasurement(response, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, Country: apiv1.CountryCodeNetherlands, Source: apiv1.SourceEntsoe})
+
+		assert.True(t, ok)
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurement.Area)
+		assert.Equal(t, string(apiv1.ResolutionP1Y), measurement.Resolution)
+		assert.Equal(t, time.Date(2020, 12, 31, 23, 0, 0, 0, time.UTC), measurement.MeasuredAtTime)
+		assert.Equal(t, 10, len(measurement.Samples))
+		assert.Equal(t, apiv1.EnergyTypeBiomass, measurement.Samples[0].EnergyType)
+		assert.Equal(t, apiv1.SampleDirectionIn, measurement.Samples[0].SampleDirection)
+		assert.Equal(t, apiv1.SampleUnitMegaWatt, measurement.Samples[0].SampleUnit)
+		assert.Equal(t, 494.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("ReturnsFalseWithoutTimeSeries", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		_, ok := service.createCapacityMeasurement(apiv1.GetInstalledGenerationCapacityAggregatedResponse{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+
+		assert.False(t, ok)
+	})
+}
+
+func TestRunForCapacity(t *testing.T) {
+
+	testResponse, _ := ioutil.ReadFile("../../api/v1/A68-response.xml")
+	var response apiv1.GetInstalledGenerationCapacityAggregatedResponse
+	err := xml.Unmarshal([]byte(testResponse), &response)
+	assert.Nil(t, err)
+
+	now := time.Now().UTC()
+	currentYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	capacityConfig := apiv1.InstalledCapacityConfig{Enable: true, CheckIntervalDays: 7, Refresh: true}
+
+	t.Run("DoesNotRefreshWithinCheckInterval", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{capacityResponse: response}}
+		lastState := &apiv1.State{
+			LastRetrievedCapacityTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: currentYear},
+			LastCheckedCapacityTime:   map[apiv1.Area]time.Time{apiv1.AreaNetherlands: now.AddDate(0, 0, -1)},
+		}
+
+		// act
+		_, err := service.runForCapacity(context.Background(), make(chan struct{}), &sync.WaitGroup{}, capacityConfig, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+	})
+
+	t.Run("RefreshesCurrentYearAfterCheckInterval", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{capacityResponse: response}}
+		lastState := &apiv1.State{
+			LastRetrievedCapacityTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: currentYear},
+			LastCheckedCapacityTime:   map[apiv1.Area]time.Time{apiv1.AreaNetherlands: now.AddDate(0, 0, -8)},
+		}
+
+		// act
+		_, err := service.runForCapacity(context.Background(), make(chan struct{}), &sync.WaitGroup{}, capacityConfig, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		assert.True(t, lastState.LastCheckedCapacityTime[apiv1.AreaNetherlands].After(now.AddDate(0, 0, -1)))
+	})
+
+	t.Run("DoesNotStoreUnchangedRefresh", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{capacityResponse: response}}
+		measurement, _ := service.createCapacityMeasurement(response, apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+		lastState := &apiv1.State{
+			LastRetrievedCapacityTime:     map[apiv1.Area]time.Time{apiv1.AreaNetherlands: currentYear},
+			LastCheckedCapacityTime:       map[apiv1.Area]time.Time{apiv1.AreaNetherlands: now.AddDate(0, 0, -8)},
+			LastRetrievedCapacityChecksum: map[apiv1.Area]string{apiv1.AreaNetherlands: service.getSamplesChecksum(measurement.Samples)},
+		}
+
+		// act
+		_, err := service.runForCapacity(context.Background(), make(chan struct{}), &sync.WaitGroup{}, capacityConfig, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+		assert.True(t, lastState.LastCheckedCapacityTime[apiv1.AreaNetherlands].After(now.AddDate(0, 0, -1)))
+	})
+
+	t.Run("StoresChangedRefreshIfASinkAddsDuplicates", func(t *testing.T) {
+
+		sinkClient := &fakeAppendingSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{capacityResponse: response}}
+		lastState := &apiv1.State{
+			LastRetrievedCapacityTime:     map[apiv1.Area]time.Time{apiv1.AreaNetherlands: currentYear},
+			LastCheckedCapacityTime:       map[apiv1.Area]time.Time{apiv1.AreaNetherlands: now.AddDate(0, 0, -8)},
+			LastRetrievedCapacityChecksum: map[apiv1.Area]string{apiv1.AreaNetherlands: "outdated"},
+		}
+
+		// act
+		_, err := service.runForCapacity(context.Background(), make(chan struct{}), &sync.WaitGroup{}, capacityConfig, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		assert.NotEqual(t, "outdated", lastState.LastRetrievedCapacityChecksum[apiv1.AreaNetherlands])
+	})
+
+	t.Run("OnlyRecordsRefreshWithoutChecksumIfASinkAddsDuplicates", func(t *testing.T) {
+
+		sinkClient := &fakeAppendingSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{capacityResponse: response}}
+		lastState := &apiv1.State{
+			LastRetrievedCapacityTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: currentYear},
+			LastCheckedCapacityTime:   map[apiv1.Area]time.Time{apiv1.AreaNetherlands: now.AddDate(0, 0, -8)},
+		}
+
+		// act
+		_, err := service.runForCapacity(context.Background(), make(chan struct{}), &sync.WaitGroup{}, capacityConfig, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+		assert.NotEqual(t, "", lastState.LastRetrievedCapacityChecksum[apiv1.AreaNetherlands])
+	})
+}
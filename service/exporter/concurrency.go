@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// runConcurrently runs task for every index with at most the configured number of workers and returns the first error;
+// once a task has failed no new tasks are started
+func (s *service) runConcurrently(nrOfTasks int, task func(i int) error) error {
+	if nrOfTasks == 0 {
+		return nil
+	}
+
+	nrOfWorkers := s.concurrency
+	if nrOfWorkers <= 0 {
+		nrOfWorkers = 1
+	}
+	if nrOfWorkers > nrOfTasks {
+		nrOfWorkers = nrOfTasks
+	}
+
+	tasks := make(chan int, nrOfTasks)
+	for i := 0; i < nrOfTasks; i++ {
+		tasks <- i
+	}
+	close(tasks)
+
+	errs := make(chan error, nrOfTasks)
+	var workers sync.WaitGroup
+	for w := 0; w < nrOfWorkers; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range tasks {
+				if len(errs) > 0 {
+					return
+				}
+				if err := task(i); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	close(errs)
+
+	// returns nil if no task has failed
+	return <-errs
+}
+
+// isStopping returns true once a shutdown signal has been received, so no new requests get started
+func (s *service) isStopping(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// storeState stores the state shared by all workers, while no worker can update it
+func (s *service) storeState(ctx context.Context, lastState *apiv1.State) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	log.Debug().Interface("lastState", lastState).Msg("Storing state")
+
+	return s.stateClient.StoreState(ctx, *lastState)
+}
+
+// storeGuarded runs store while the wait group keeps a graceful shutdown from exiting halfway through writing measurements
+// and state; the wait group is released again whether store fails or not
+func (s *service) storeGuarded(waitGroup *sync.WaitGroup, store func() error) error {
+	waitGroup.Add(1)
+	defer waitGroup.Done()
+
+	return store()
+}
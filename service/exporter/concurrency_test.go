@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	t.Run("RunsAllTasks", func(t *testing.T) {
+
+		service := service{concurrency: 3}
+		var mutex sync.Mutex
+		done := map[int]bool{}
+
+		// act
+		err := service.runConcurrently(10, func(i int) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			done[i] = true
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(done))
+	})
+
+	t.Run("RunsAtMostConcurrencyTasksAtTheSameTime", func(t *testing.T) {
+
+		service := service{concurrency: 2}
+		var running, maxRunning int32
+
+		// act
+		err := service.runConcurrently(8, func(i int) error {
+			r := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), maxRunning)
+	})
+
+	t.Run("ReturnsErrorOfFailedTask", func(t *testing.T) {
+
+		service := service{concurrency: 1}
+		nrOfRunTasks := 0
+
+		// act
+		err := service.runConcurrently(5, func(i int) error {
+			nrOfRunTasks++
+			if i == 1 {
+				return fmt.Errorf("Task %v failed", i)
+			}
+			return nil
+		})
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "Task 1 failed", err.Error())
+		assert.Equal(t, 2, nrOfRunTasks)
+	})
+
+	t.Run("ReturnsNilWithoutTasks", func(t *testing.T) {
+
+		service := service{concurrency: 4}
+
+		// act
+		err := service.runConcurrently(0, func(i int) error {
+			return fmt.Errorf("Task %v should not run", i)
+		})
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestIsStopping(t *testing.T) {
+	t.Run("ReturnsFalseBeforeStopIsClosed", func(t *testing.T) {
+
+		service := service{}
+		stop := make(chan struct{})
+
+		// act
+		isStopping := service.isStopping(stop)
+
+		assert.False(t, isStopping)
+	})
+
+	t.Run("ReturnsTrueAfterStopIsClosed", func(t *testing.T) {
+
+		service := service{}
+		stop := make(chan struct{})
+		close(stop)
+
+		// act
+		isStopping := service.isStopping(stop)
+
+		assert.True(t, isStopping)
+	})
+}
+
+func TestStoreGuarded(t *testing.T) {
+	t.Run("ReleasesWaitGroupIfStoreFails", func(t *testing.T) {
+
+		service := service{}
+		waitGroup := &sync.WaitGroup{}
+
+		// act
+		err := service.storeGuarded(waitGroup, func() error {
+			return fmt.Errorf("Inserting measurements failed")
+		})
+
+		assert.NotNil(t, err)
+		released := make(chan struct{})
+		go func() {
+			waitGroup.Wait()
+			close(released)
+		}()
+		select {
+		case <-released:
+		case <-time.After(time.Second):
+			t.Fatal("Wait group has not been released")
+		}
+	})
+}
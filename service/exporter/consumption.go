@@ -0,0 +1,467 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrSingularFlowMatrix = errors.New("Flow matrix is singular")
+)
+
+func (s *service) runForConsumptionMix(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, config apiv1.Config, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if config.ConsumptionMix == nil || !config.ConsumptionMix.Enable {
+		return lastState, nil
+	}
+
+	consumptionMixConfig := *config.ConsumptionMix
+
+	log.Info().Interface("consumptionMixConfig", consumptionMixConfig).Msgf("Computing consumption mix for %v areas", len(config.Areas))
+
+	for {
+		now := time.Now().UTC().Round(time.Duration(consumptionMixConfig.ResolutionMinutes) * time.Minute)
+
+		// if it's the first time use the configured start, otherwise start at last stored value
+		start := now.AddDate(-1*consumptionMixConfig.StartYearsAgo, -1*consumptionMixConfig.StartMonthsAgo, -1*consumptionMixConfig.StartDaysAgo)
+		s.stateMutex.RLock()
+		if lastState != nil && !lastState.LastRetrievedConsumptionTime.IsZero() {
+			start = lastState.LastRetrievedConsumptionTime.Add(time.Duration(consumptionMixConfig.ResolutionMinutes) * time.Minute)
+		}
+		s.stateMutex.RUnlock()
+		end := start.Add(time.Duration(4*24*consumptionMixConfig.ResolutionMinutes) * time.Minute)
+		if end.After(now) {
+			end = now
+		}
+		log.Debug().Msgf("start: %v", start)
+		log.Debug().Msgf("end: %v", end)
+
+		// don't continue, we're up to date
+		if !start.Before(end) {
+			log.Info().Msgf("Start - %v - and end - %v - are equal, exiting", start, end)
+			return lastState, nil
+		}
+
+		// retrieve generation and flows for all areas, all of them for the first half if any query is too large
+		var generationResponses map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse
+		var flowResponses map[apiv1.Area]map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse
+		retrievedInterval, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, time.Duration(consumptionMixConfig.ResolutionMinutes)*time.Minute, func(timeInterval apiv1.TimeInterval) (err error) {
+			generationResponses, flowResponses, err = s.getConsumptionMixResponses(ctx, config, timeInterval)
+			return
+		})
+		if err != nil {
+			return lastState, err
+		}
+		end = retrievedInterval.End
+
+		measurements := []apiv1.ConsumptionMeasurement{}
+		lastTimeSlotStartTime := time.Time{}
+		nrOfSlots := int(end.Sub(start).Minutes() / float64(consumptionMixConfig.ResolutionMinutes))
+		for i := 0; i < nrOfSlots; i++ {
+			timeSlotStartTime := start.Add(time.Duration(i*consumptionMixConfig.ResolutionMinutes) * time.Minute)
+
+			timeSlotMeasurements, err := s.createConsumptionMeasurementsForTimeSlot(config, generationResponses, flowResponses, timeSlotStartTime)
+			if err != nil {
+				return lastState, err
+			}
+			if len(timeSlotMeasurements) == 0 {
+				// not every area has published generation for this time slot (yet)
+				break
+			}
+
+			measurements = append(measurements, timeSlotMeasurements...)
+			lastTimeSlotStartTime = timeSlotStartTime
+		}
+
+		if len(measurements) == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurements
+			err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamConsumption, measurements)
+			if err != nil {
+				return err
+			}
+
+			// update state
+			s.stateMutex.Lock()
+			lastState.LastRetrievedConsumptionTime = lastTimeSlotStartTime
+			s.stateMutex.Unlock()
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+	}
+}
+
+// getConsumptionMixResponses retrieves generation for all areas concurrently, and the flows for all exchanges once per pair of areas
+func (s *service) getConsumptionMixResponses(ctx context.Context, config apiv1.Config, timeInterval apiv1.TimeInterval) (generationResponses map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse, flowResponses map[apiv1.Area]map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse, err error) {
+
+	areaResponses := make([]apiv1.GetAggregatedGenerationPerTypeResponse, len(config.Areas))
+	err = s.runConcurrently(len(config.Areas), func(i int) (err error) {
+		areaResponses[i], err = s.entsoeClient.GetAggregatedGenerationPerType(ctx, config.Areas[i].Area, timeInterval)
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return nil
+		}
+		return
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	generationResponses = map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse{}
+	for i, areaConfig := range config.Areas {
+		generationResponses[areaConfig.Area] = areaResponses[i]
+	}
+
+	flowResponses = map[apiv1.Area]map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{}
+	for _, areaConfig := range config.Areas {
+		for _, exchangeConfig := range areaConfig.Exchanges {
+			if _, ok := flowResponses[exchangeConfig.Area][areaConfig.Area]; ok {
+				continue
+			}
+			responses, err := s.getPhysicalCrossBorderFlows(ctx, *areaConfig, *exchangeConfig, timeInterval)
+			if err != nil {
+				return nil, nil, err
+			}
+			if flowResponses[areaConfig.Area] == nil {
+				flowResponses[areaConfig.Area] = map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{}
+			}
+			flowResponses[areaConfig.Area][exchangeConfig.Area] = responses
+		}
+	}
+
+	return generationResponses, flowResponses, nil
+}
+
+func (s *service) createConsumptionMeasurementsForTimeSlot(config apiv1.Config, generationResponses map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse, flowResponses map[apiv1.Area]map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse, timeSlotStartTime time.Time) (measurements []apiv1.ConsumptionMeasurement, err error) {
+
+	resolutionMinutes := config.ConsumptionMix.ResolutionMinutes
+
+	// net generation per energy type for each area; an area that hasn't published generation for this time slot would
+	// silently drop out of the tracing, so the time slot is left for a later run
+	generation := map[apiv1.Area]map[apiv1.EnergyType]float64{}
+	emissionFactors := map[apiv1.Area]map[apiv1.EnergyType]apiv1.EmissionFactor{}
+	for _, areaConfig := range config.Areas {
+		// generation at a finer resolution is averaged over the time slot of the consumption mix
+		consumptionAreaConfig := *areaConfig
+		consumptionAreaConfig.ResolutionMinutes = resolutionMinutes
+
+		generationMeasurement := s.createGenerationMeasurementForTimeSlot(generationResponses[areaConfig.Area], timeSlotStartTime, consumptionAreaConfig)
+		if len(generationMeasurement.Samples) == 0 {
+			log.Info().Msgf("Area %v has no generation for time slot %v yet, postponing consumption mix", areaConfig.Area, timeSlotStartTime)
+			return nil, nil
+		}
+
+		generation[areaConfig.Area] = map[apiv1.EnergyType]float64{}
+		samplesPerEnergyType := map[apiv1.EnergyType][]*apiv1.Sample{}
+		for _, sample := range generationMeasurement.Samples {
+			samplesPerEnergyType[sample.EnergyType] = append(samplesPerEnergyType[sample.EnergyType], sample)
+			switch sample.SampleDirection {
+			case apiv1.SampleDirectionIn:
+				generation[areaConfig.Area][sample.EnergyType] += sample.Value
+			case apiv1.SampleDirectionOut:
+				// outBiddingZone series reflect consumption, like pumped storage
+				generation[areaConfig.Area][sample.EnergyType] -= sample.Value
+			}
+		}
+		for energyType, value := range generation[areaConfig.Area] {
+			// storage that consumes more than it generates is treated as regular load
+			if value < 0 {
+				generation[areaConfig.Area][energyType] = 0
+			}
+		}
+
+		// emissions of the generation in this area, including the overrides per psr type
+		emissionFactors[areaConfig.Area] = map[apiv1.EnergyType]apiv1.EmissionFactor{}
+		for energyType, samples := range samplesPerEnergyType {
+			lifecycle, direct := apiv1.GetCarbonIntensity(samples, apiv1.SampleDirectionIn)
+			emissionFactors[areaConfig.Area][energyType] = apiv1.EmissionFactor{Lifecycle: lifecycle, Direct: direct}
+		}
+	}
+
+	// physical flows between all areas, keyed by the area the power flows out of and then the area it flows into
+	flows := map[apiv1.Area]map[apiv1.Area]float64{}
+	for _, areaConfig := range config.Areas {
+		for _, exchangeConfig := range areaConfig.Exchanges {
+			responses, ok := flowResponses[areaConfig.Area][exchangeConfig.Area]
+			if !ok {
+				continue
+			}
+			consumptionExchangeConfig := *exchangeConfig
+			consumptionExchangeConfig.ResolutionMinutes = resolutionMinutes
+
+			exchangeMeasurement := s.createExchangeMeasurementForTimeSlot(responses, timeSlotStartTime, *areaConfig, consumptionExchangeConfig)
+			for _, sample := range exchangeMeasurement.Samples {
+				switch sample.SampleDirection {
+				case apiv1.SampleDirectionIn:
+					s.setFlow(flows, exchangeConfig.Area, areaConfig.Area, sample.Value)
+				case apiv1.SampleDirectionOut:
+					s.setFlow(flows, areaConfig.Area, exchangeConfig.Area, sample.Value)
+				}
+			}
+		}
+	}
+
+	consumption, err := s.traceConsumptionMix(generation, flows)
+	if err != nil {
+		return measurements, err
+	}
+
+	for _, areaConfig := range config.Areas {
+		consumptionPerOrigin, ok := consumption[areaConfig.Area]
+		if !ok {
+			continue
+		}
+
+		measurement := apiv1.ConsumptionMeasurement{
+			ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamConsumption, string(areaConfig.Source), string(areaConfig.Area), timeSlotStartTime),
+			Source:         string(areaConfig.Source),
+			Area:           string(areaConfig.Area),
+			Country:        string(areaConfig.Country),
+			Resolution:     fmt.Sprintf("PT%vM", resolutionMinutes),
+			MeasuredAtTime: timeSlotStartTime,
+		}
+
+		// sum the consumption per energy type over all areas of origin, weighting the emissions of each area of origin
+		consumptionPerEnergyType := map[apiv1.EnergyType]float64{}
+		emissionsPerEnergyType := map[apiv1.EnergyType]apiv1.EmissionFactor{}
+		for origin, consumptionOfOrigin := range consumptionPerOrigin {
+			for energyType, value := range consumptionOfOrigin {
+				emissionFactor, ok := emissionFactors[origin][energyType]
+				if !ok {
+					// imports from areas that aren't configured have no emissions of their own
+					emissionFactor = areaConfig.GetEmissionFactor(energyType, apiv1.PsrTypeUnknown)
+				}
+				consumptionPerEnergyType[energyType] += value
+				emissions := emissionsPerEnergyType[energyType]
+				emissions.Lifecycle += value * emissionFactor.Lifecycle
+				emissions.Direct += value * emissionFactor.Direct
+				emissionsPerEnergyType[energyType] = emissions
+			}
+		}
+
+		energyTypes := []apiv1.EnergyType{}
+		for energyType := range consumptionPerEnergyType {
+			energyTypes = append(energyTypes, energyType)
+		}
+		sort.Slice(energyTypes, func(i, j int) bool {
+			return energyTypes[i] < energyTypes[j]
+		})
+
+		for _, energyType := range energyTypes {
+			value := consumptionPerEnergyType[energyType]
+			emissionFactor := areaConfig.GetEmissionFactor(energyType, apiv1.PsrTypeUnknown)
+			if value > 0 {
+				emissionFactor = apiv1.EmissionFactor{Lifecycle: emissionsPerEnergyType[energyType].Lifecycle / value, Direct: emissionsPerEnergyType[energyType].Direct / value}
+			}
+			measurement.Samples = append(measurement.Samples, &apiv1.Sample{
+				EnergyType:            energyType,
+				IsRenewable:           energyType.IsRenewable(),
+				CarbonIntensity:       emissionFactor.Lifecycle,
+				DirectCarbonIntensity: emissionFactor.Direct,
+				MetricType:            apiv1.MetricTypeGauge,
+				// consumption is outgoing from the grid, like the outBiddingZone series of ENTSO-E
+				SampleDirection: apiv1.SampleDirectionOut,
+				SampleUnit:      apiv1.SampleUnitMegaWatt,
+				Value:           value,
+			})
+		}
+
+		measurement.CarbonIntensity, measurement.DirectCarbonIntensity = apiv1.GetCarbonIntensity(measurement.Samples, apiv1.SampleDirectionOut)
+
+		measurements = append(measurements, measurement)
+	}
+
+	return
+}
+
+// consumptionSource is the area and energy type consumed power has been generated with
+type consumptionSource struct {
+	Area       apiv1.Area
+	EnergyType apiv1.EnergyType
+}
+
+func (s *service) setFlow(flows map[apiv1.Area]map[apiv1.Area]float64, from, to apiv1.Area, value float64) {
+	if flows[from] == nil {
+		flows[from] = map[apiv1.Area]float64{}
+	}
+	// exchanges configured for both areas report the same flow, so it's set instead of added
+	flows[from][to] = value
+}
+
+// traceConsumptionMix follows the flow tracing approach used by electricitymap (https://arxiv.org/abs/1812.06679); every area
+// mixes its own generation with its imports and exports that same mix, so the share u_i of an energy type in area i satisfies
+//
+//	u_i * (generation_i + imports_i) - sum_j(flow_j_i * u_j) = generation_i
+//
+// the mix is traced per area of origin and energy type, so imported power keeps the emissions of the area generating it;
+// imports from areas without generation are attributed to the unknown energy type of that area
+func (s *service) traceConsumptionMix(generation map[apiv1.Area]map[apiv1.EnergyType]float64, flows map[apiv1.Area]map[apiv1.Area]float64) (consumption map[apiv1.Area]map[apiv1.Area]map[apiv1.EnergyType]float64, err error) {
+
+	areas := []apiv1.Area{}
+	for area := range generation {
+		areas = append(areas, area)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		return areas[i] < areas[j]
+	})
+
+	areaIndex := map[apiv1.Area]int{}
+	for i, area := range areas {
+		areaIndex[area] = i
+	}
+
+	// the generation of each area is a source of its own, as are imports from unknown areas
+	sources := map[apiv1.Area]map[consumptionSource]float64{}
+	for _, area := range areas {
+		sources[area] = map[consumptionSource]float64{}
+		for energyType, value := range generation[area] {
+			sources[area][consumptionSource{Area: area, EnergyType: energyType}] = value
+		}
+	}
+	for from, flowsTo := range flows {
+		if _, ok := areaIndex[from]; ok {
+			continue
+		}
+		for to, value := range flowsTo {
+			if _, ok := areaIndex[to]; ok {
+				sources[to][consumptionSource{Area: from, EnergyType: apiv1.EnergyTypeUnknown}] += value
+			}
+		}
+	}
+
+	sourcesMap := map[consumptionSource]bool{}
+	for _, area := range areas {
+		for source := range sources[area] {
+			sourcesMap[source] = true
+		}
+	}
+	sourceKeys := []consumptionSource{}
+	for source := range sourcesMap {
+		sourceKeys = append(sourceKeys, source)
+	}
+	sort.Slice(sourceKeys, func(i, j int) bool {
+		if sourceKeys[i].Area != sourceKeys[j].Area {
+			return sourceKeys[i].Area < sourceKeys[j].Area
+		}
+		return sourceKeys[i].EnergyType < sourceKeys[j].EnergyType
+	})
+
+	n := len(areas)
+	a := make([][]float64, n)
+	b := make([][]float64, n)
+	totals := make([]float64, n)
+	for i, area := range areas {
+		a[i] = make([]float64, n)
+		b[i] = make([]float64, len(sourceKeys))
+
+		for k, source := range sourceKeys {
+			b[i][k] = sources[area][source]
+			totals[i] += sources[area][source]
+		}
+		for j, areaPeer := range areas {
+			if flow, ok := flows[areaPeer][area]; ok && i != j {
+				a[i][j] -= flow
+				totals[i] += flow
+			}
+		}
+
+		a[i][i] = totals[i]
+		if totals[i] == 0 {
+			// nothing flows through this area, its shares are all zero
+			a[i][i] = 1
+		}
+	}
+
+	shares, err := s.solveLinearSystem(a, b)
+	if err != nil {
+		return
+	}
+
+	consumption = map[apiv1.Area]map[apiv1.Area]map[apiv1.EnergyType]float64{}
+	for i, area := range areas {
+		exports := 0.0
+		for areaPeer, flow := range flows[area] {
+			if areaPeer != area {
+				exports += flow
+			}
+		}
+		consumed := math.Max(0, totals[i]-exports)
+
+		consumption[area] = map[apiv1.Area]map[apiv1.EnergyType]float64{}
+		for k, source := range sourceKeys {
+			if consumption[area][source.Area] == nil {
+				consumption[area][source.Area] = map[apiv1.EnergyType]float64{}
+			}
+			consumption[area][source.Area][source.EnergyType] = shares[i][k] * consumed
+		}
+	}
+
+	return
+}
+
+// solveLinearSystem solves a * x = b for every column of b, using gaussian elimination with partial pivoting
+func (s *service) solveLinearSystem(a [][]float64, b [][]float64) (x [][]float64, err error) {
+
+	n := len(a)
+
+	// work on copies to leave the input untouched
+	m := make([][]float64, n)
+	x = make([][]float64, n)
+	for i := 0; i < n; i++ {
+		m[i] = append([]float64{}, a[i]...)
+		x[i] = append([]float64{}, b[i]...)
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, ErrSingularFlowMatrix
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		x[col], x[pivot] = x[pivot], x[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for c := col; c < n; c++ {
+				m[row][c] -= factor * m[col][c]
+			}
+			for c := range x[row] {
+				x[row][c] -= factor * x[col][c]
+			}
+		}
+	}
+
+	for row := n - 1; row >= 0; row-- {
+		for c := range x[row] {
+			for col := row + 1; col < n; col++ {
+				x[row][c] -= m[row][col] * x[col][c]
+			}
+			x[row][c] /= m[row][row]
+		}
+	}
+
+	return x, nil
+}
@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestTraceConsumptionMix(t *testing.T) {
+	t.Run("ReturnsOwnGenerationWithoutExchanges", func(t *testing.T) {
+
+		service := service{}
+		generation := map[apiv1.Area]map[apiv1.EnergyType]float64{
+			apiv1.AreaNetherlands: {apiv1.EnergyTypeGas: 300, apiv1.EnergyTypeSolar: 100},
+		}
+		flows := map[apiv1.Area]map[apiv1.Area]float64{}
+
+		// act
+		consumption, err := service.traceConsumptionMix(generation, flows)
+
+		assert.Nil(t, err)
+		assert.InDelta(t, 300.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNetherlands][apiv1.EnergyTypeGas], 0.001)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNetherlands][apiv1.EnergyTypeSolar], 0.001)
+	})
+
+	t.Run("MixesImportsIntoConsumptionOfImportingArea", func(t *testing.T) {
+
+		service := service{}
+		generation := map[apiv1.Area]map[apiv1.EnergyType]float64{
+			apiv1.AreaGermany:     {apiv1.EnergyTypeCoal: 100},
+			apiv1.AreaNetherlands: {apiv1.EnergyTypeWindOffshore: 100},
+		}
+		flows := map[apiv1.Area]map[apiv1.Area]float64{
+			apiv1.AreaGermany: {apiv1.AreaNetherlands: 50},
+		}
+
+		// act
+		consumption, err := service.traceConsumptionMix(generation, flows)
+
+		assert.Nil(t, err)
+		assert.InDelta(t, 50.0, consumption[apiv1.AreaGermany][apiv1.AreaGermany][apiv1.EnergyTypeCoal], 0.001)
+		assert.InDelta(t, 0.0, consumption[apiv1.AreaGermany][apiv1.AreaNetherlands][apiv1.EnergyTypeWindOffshore], 0.001)
+		assert.InDelta(t, 50.0, consumption[apiv1.AreaNetherlands][apiv1.AreaGermany][apiv1.EnergyTypeCoal], 0.001)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNetherlands][apiv1.EnergyTypeWindOffshore], 0.001)
+	})
+
+	t.Run("PassesTransitFlowsThroughIntermediateArea", func(t *testing.T) {
+
+		service := service{}
+		generation := map[apiv1.Area]map[apiv1.EnergyType]float64{
+			apiv1.AreaNorway:      {apiv1.EnergyTypeHydro: 200},
+			apiv1.AreaNetherlands: {apiv1.EnergyTypeGas: 200},
+			apiv1.AreaBelgium:     {apiv1.EnergyTypeNuclear: 100},
+		}
+		flows := map[apiv1.Area]map[apiv1.Area]float64{
+			apiv1.AreaNorway:      {apiv1.AreaNetherlands: 100},
+			apiv1.AreaNetherlands: {apiv1.AreaBelgium: 150},
+		}
+
+		// act
+		consumption, err := service.traceConsumptionMix(generation, flows)
+
+		assert.Nil(t, err)
+
+		// the netherlands mixes 200 gas with 100 hydro and exports half of that mix
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNetherlands][apiv1.EnergyTypeGas], 0.001)
+		assert.InDelta(t, 50.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNorway][apiv1.EnergyTypeHydro], 0.001)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaBelgium][apiv1.AreaNetherlands][apiv1.EnergyTypeGas], 0.001)
+		assert.InDelta(t, 50.0, consumption[apiv1.AreaBelgium][apiv1.AreaNorway][apiv1.EnergyTypeHydro], 0.001)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaBelgium][apiv1.AreaBelgium][apiv1.EnergyTypeNuclear], 0.001)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaNorway][apiv1.AreaNorway][apiv1.EnergyTypeHydro], 0.001)
+	})
+
+	t.Run("AttributesImportsFromAreasWithoutGenerationToUnknownOfThatArea", func(t *testing.T) {
+
+		service := service{}
+		generation := map[apiv1.Area]map[apiv1.EnergyType]float64{
+			apiv1.AreaNetherlands: {apiv1.EnergyTypeGas: 100},
+		}
+		flows := map[apiv1.Area]map[apiv1.Area]float64{
+			apiv1.AreaGreatBritain: {apiv1.AreaNetherlands: 30},
+		}
+
+		// act
+		consumption, err := service.traceConsumptionMix(generation, flows)
+
+		assert.Nil(t, err)
+		assert.InDelta(t, 100.0, consumption[apiv1.AreaNetherlands][apiv1.AreaNetherlands][apiv1.EnergyTypeGas], 0.001)
+		assert.InDelta(t, 30.0, consumption[apiv1.AreaNetherlands][apiv1.AreaGreatBritain][apiv1.EnergyTypeUnknown], 0.001)
+		_, ok := consumption[apiv1.AreaGreatBritain]
+		assert.False(t, ok)
+	})
+}
+
+func TestCreateConsumptionMeasurementsForTimeSlot(t *testing.T) {
+
+	start := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)
+	generationResponse := func(area apiv1.Area, psrType apiv1.PsrType, quantities ...float64) apiv1.GetAggregatedGenerationPerTypeResponse {
+		period := apiv1.TimeSeriePeriod{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Duration(len(quantities)) * 15 * time.Minute)}, Resolution: apiv1.ResolutionPT15M}
+		for i, q := range quantities {
+			period.Points = append(period.Points, apiv1.TimeSeriePoint{Position: i + 1, Quantity: q})
+		}
+		timeSerie := apiv1.AggregatedGenerationTimeSerie{InBiddingZone: area, QuanityMeasurementUnit: apiv1.MeasurementUnitMegaWatt, Periods: apiv1.TimeSeriePeriods{period}}
+		timeSerie.MktPsrType.PsrType = psrType
+		return apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{timeSerie}}
+	}
+	config := apiv1.Config{
+		Areas: []*apiv1.AreaConfig{
+			{Area: apiv1.AreaBelgium, ResolutionMinutes: 15},
+			{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15},
+		},
+		ConsumptionMix: &apiv1.ConsumptionMixConfig{ResolutionMinutes: 60},
+	}
+
+	t.Run("AveragesGenerationOverTimeSlotOfConsumptionMix", func(t *testing.T) {
+
+		service := service{}
+		generationResponses := map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse{
+			apiv1.AreaBelgium:     generationResponse(apiv1.AreaBelgium, apiv1.PsrTypeNuclear, 100, 100, 100, 100),
+			apiv1.AreaNetherlands: generationResponse(apiv1.AreaNetherlands, apiv1.PsrTypeFossilGas, 100, 200, 300, 400),
+		}
+
+		// act
+		measurements, err := service.createConsumptionMeasurementsForTimeSlot(config, generationResponses, nil, start)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(measurements))
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurements[1].Area)
+		assert.Equal(t, apiv1.EnergyTypeGas, measurements[1].Samples[0].EnergyType)
+		assert.InDelta(t, 250.0, measurements[1].Samples[0].Value, 0.001)
+	})
+
+	t.Run("ReturnsNoMeasurementsIfAnAreaHasNoGenerationYet", func(t *testing.T) {
+
+		service := service{}
+		generationResponses := map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse{
+			apiv1.AreaBelgium:     generationResponse(apiv1.AreaBelgium, apiv1.PsrTypeNuclear, 100, 100),
+			apiv1.AreaNetherlands: generationResponse(apiv1.AreaNetherlands, apiv1.PsrTypeFossilGas, 100, 200, 300, 400),
+		}
+
+		// act
+		measurements, err := service.createConsumptionMeasurementsForTimeSlot(config, generationResponses, nil, start)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(measurements))
+	})
+	t.Run("WeightsImportsWithEmissionFactorsOfAreaOfOrigin", func(t *testing.T) {
+
+		service := service{}
+		belgium := &apiv1.AreaConfig{Area: apiv1.AreaBelgium, ResolutionMinutes: 15, EmissionFactors: map[string]apiv1.EmissionFactor{string(apiv1.EnergyTypeGas): {Lifecycle: 400, Direct: 300}}, Exchanges: []*apiv1.ExchangeConfig{{Area: apiv1.AreaNetherlands, ResolutionMinutes: 60}}}
+		netherlands := &apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15}
+		config := apiv1.Config{Areas: []*apiv1.AreaConfig{belgium, netherlands}, ConsumptionMix: &apiv1.ConsumptionMixConfig{ResolutionMinutes: 60}}
+		generationResponses := map[apiv1.Area]apiv1.GetAggregatedGenerationPerTypeResponse{
+			apiv1.AreaBelgium:     generationResponse(apiv1.AreaBelgium, apiv1.PsrTypeFossilGas, 100, 100, 100, 100),
+			apiv1.AreaNetherlands: generationResponse(apiv1.AreaNetherlands, apiv1.PsrTypeFossilGas, 100, 100, 100, 100),
+		}
+		flowPeriod := apiv1.TimeSeriePeriod{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, Resolution: apiv1.ResolutionPT60M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 50}}}
+		flowResponses := map[apiv1.Area]map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{
+			apiv1.AreaBelgium: {
+				apiv1.AreaNetherlands: {{TimeSeries: []apiv1.PhysicalFlowTimeSerie{{InDomain: apiv1.AreaNetherlands, OutDomain: apiv1.AreaBelgium, QuanityMeasurementUnit: apiv1.MeasurementUnitMegaWatt, Periods: apiv1.TimeSeriePeriods{flowPeriod}}}}},
+			},
+		}
+
+		// act
+		measurements, err := service.createConsumptionMeasurementsForTimeSlot(config, generationResponses, flowResponses, start)
+
+		assert.Nil(t, err)
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurements[1].Area)
+		assert.Equal(t, 1, len(measurements[1].Samples))
+		// 100 MW of dutch gas at 490 / 370 and 50 MW of belgian gas at 400 / 300
+		assert.InDelta(t, 150.0, measurements[1].Samples[0].Value, 0.001)
+		assert.InDelta(t, 460.0, measurements[1].Samples[0].CarbonIntensity, 0.001)
+		assert.InDelta(t, 346.667, measurements[1].Samples[0].DirectCarbonIntensity, 0.001)
+		assert.InDelta(t, 460.0, measurements[1].CarbonIntensity, 0.001)
+	})
+}
@@ -0,0 +1,189 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+func (s *service) runForForecasts(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	var err error
+	for _, forecastType := range areaConfig.Forecasts {
+		lastState, err = s.runForForecast(ctx, stop, waitGroup, areaConfig, forecastType, lastState)
+		if err != nil {
+			return lastState, err
+		}
+	}
+
+	return lastState, nil
+}
+
+func (s *service) runForForecast(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, forecastType apiv1.ForecastType, lastState *apiv1.State) (*apiv1.State, error) {
+
+	log.Info().Msgf("Retrieving %v forecast for area %v / country %v", forecastType, areaConfig.Area, areaConfig.Country)
+
+	for {
+		now := time.Now().UTC()
+
+		// day-ahead forecasts are published in the afternoon for the next day, so retrieve up to the end of tomorrow
+		horizon := now.Truncate(24*time.Hour).AddDate(0, 0, 2)
+
+		// if it's the first time use the start of the area, otherwise start at last stored value
+		start := now.Round(time.Duration(areaConfig.ResolutionMinutes)*time.Minute).AddDate(-1*areaConfig.StartYearsAgo, -1*areaConfig.StartMonthsAgo, -1*areaConfig.StartDaysAgo)
+		s.stateMutex.RLock()
+		if lastState != nil && lastState.LastRetrievedForecastTime != nil && lastState.LastRetrievedForecastTime[areaConfig.Area] != nil {
+			if lastRetrievedForecastTime, ok := lastState.LastRetrievedForecastTime[areaConfig.Area][forecastType]; ok {
+				start = lastRetrievedForecastTime.Add(time.Duration(areaConfig.ResolutionMinutes) * time.Minute)
+			}
+		}
+		s.stateMutex.RUnlock()
+		end := start.Add(time.Duration(4*24*areaConfig.ResolutionMinutes) * time.Minute)
+		if end.After(horizon) {
+			end = horizon
+		}
+		log.Debug().Msgf("start: %v", start)
+		log.Debug().Msgf("end: %v", end)
+
+		// don't continue, we're up to date
+		if !start.Before(end) {
+			log.Info().Msgf("Start - %v - and end - %v - are equal, exiting", start, end)
+			return lastState, nil
+		}
+
+		var measurements []apiv1.ForecastMeasurement
+		_, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, time.Duration(areaConfig.ResolutionMinutes)*time.Minute, func(timeInterval apiv1.TimeInterval) (err error) {
+			measurements, err = s.getForecastMeasurements(ctx, areaConfig, forecastType, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			log.Info().Msg("No data has been found, exiting")
+			return lastState, nil
+		}
+
+		if len(measurements) == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurements
+			err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamForecast, measurements)
+			if err != nil {
+				return err
+			}
+
+			// update state
+			s.stateMutex.Lock()
+			if lastState.LastRetrievedForecastTime == nil {
+				lastState.LastRetrievedForecastTime = make(map[apiv1.Area]map[apiv1.ForecastType]time.Time, 0)
+			}
+			if lastState.LastRetrievedForecastTime[areaConfig.Area] == nil {
+				lastState.LastRetrievedForecastTime[areaConfig.Area] = make(map[apiv1.ForecastType]time.Time, 0)
+			}
+			lastState.LastRetrievedForecastTime[areaConfig.Area][forecastType] = measurements[len(measurements)-1].ForecastForTime
+			s.stateMutex.Unlock()
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+	}
+}
+
+func (s *service) getForecastMeasurements(ctx context.Context, areaConfig apiv1.AreaConfig, forecastType apiv1.ForecastType, timeInterval apiv1.TimeInterval) (measurements []apiv1.ForecastMeasurement, err error) {
+	switch forecastType {
+	case apiv1.ForecastTypeWindAndSolar:
+		response, err := s.entsoeClient.GetWindAndSolarForecast(ctx, areaConfig.Area, timeInterval)
+		if err != nil {
+			return measurements, err
+		}
+		return s.createForecastMeasurementsForGeneration(response, areaConfig, forecastType, time.Now().UTC()), nil
+
+	case apiv1.ForecastTypeGeneration:
+		response, err := s.entsoeClient.GetGenerationForecast(ctx, areaConfig.Area, timeInterval)
+		if err != nil {
+			return measurements, err
+		}
+		return s.createForecastMeasurementsForGeneration(response, areaConfig, forecastType, time.Now().UTC()), nil
+
+	case apiv1.ForecastTypeLoad:
+		response, err := s.entsoeClient.GetLoadForecast(ctx, areaConfig.Area, timeInterval)
+		if err != nil {
+			return measurements, err
+		}
+		return s.createForecastMeasurementsForLoad(response, areaConfig, time.Now().UTC()), nil
+	}
+
+	return measurements, fmt.Errorf("Forecast type %v is not supported", forecastType)
+}
+
+func (s *service) createForecastMeasurementsForGeneration(response apiv1.GetAggregatedGenerationPerTypeResponse, areaConfig apiv1.AreaConfig, forecastType apiv1.ForecastType, fetchedAtTime time.Time) (measurements []apiv1.ForecastMeasurement) {
+
+	nrOfSlots := int(response.TimePeriod.End.Sub(response.TimePeriod.Start).Minutes() / float64(areaConfig.ResolutionMinutes))
+	for i := 0; i < nrOfSlots; i++ {
+		timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*areaConfig.ResolutionMinutes) * time.Minute)
+		generationMeasurement := s.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig)
+		if len(generationMeasurement.Samples) == 0 {
+			// the forecast for this time slot hasn't been published yet
+			break
+		}
+
+		measurements = append(measurements, apiv1.ForecastMeasurement{
+			ID:              apiv1.NewMeasurementID(apiv1.MeasurementStreamForecast, generationMeasurement.Source, generationMeasurement.Area, timeSlotStartTime, string(forecastType)),
+			Source:          generationMeasurement.Source,
+			Area:            generationMeasurement.Area,
+			Country:         generationMeasurement.Country,
+			Resolution:      generationMeasurement.Resolution,
+			ForecastType:    forecastType,
+			Samples:         generationMeasurement.Samples,
+			IssuedAtTime:    response.CreatedDateTime,
+			ForecastForTime: timeSlotStartTime,
+			FetchedAtTime:   fetchedAtTime,
+		})
+	}
+
+	return
+}
+
+func (s *service) createForecastMeasurementsForLoad(response apiv1.GetLoadForecastResponse, areaConfig apiv1.AreaConfig, fetchedAtTime time.Time) (measurements []apiv1.ForecastMeasurement) {
+
+	nrOfSlots := int(response.TimePeriod.End.Sub(response.TimePeriod.Start).Minutes() / float64(areaConfig.ResolutionMinutes))
+	for i := 0; i < nrOfSlots; i++ {
+		timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*areaConfig.ResolutionMinutes) * time.Minute)
+		loadMeasurement := s.createLoadMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig)
+		if len(loadMeasurement.Samples) == 0 {
+			// the forecast for this time slot hasn't been published yet
+			break
+		}
+
+		measurements = append(measurements, apiv1.ForecastMeasurement{
+			ID:              apiv1.NewMeasurementID(apiv1.MeasurementStreamForecast, loadMeasurement.Source, loadMeasurement.Area, timeSlotStartTime, string(apiv1.ForecastTypeLoad)),
+			Source:          loadMeasurement.Source,
+			Area:            loadMeasurement.Area,
+			Country:         loadMeasurement.Country,
+			Resolution:      loadMeasurement.Resolution,
+			ForecastType:    apiv1.ForecastTypeLoad,
+			Samples:         loadMeasurement.Samples,
+			IssuedAtTime:    response.CreatedDateTime,
+			ForecastForTime: timeSlotStartTime,
+			FetchedAtTime:   fetchedAtTime,
+		})
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestCreateForecastMeasurementsForGeneration(t *testing.T) {
+	t.Run("CreatesMeasurementForEachTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
+		var response apiv1.GetGenerationForecastResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		fetchedAtTime := time.Date(2021, 3, 11, 18, 0, 0, 0, time.UTC)
+
+		// act
+		measurements := service.createForecastMeasurementsForGeneration(response, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15}, apiv1.ForecastTypeGeneration, fetchedAtTime)
+
+		assert.Equal(t, 96, len(measurements))
+		assert.Equal(t, apiv1.ForecastTypeGeneration, measurements[0].ForecastType)
+		assert.Equal(t, 19, len(measurements[0].Samples))
+		assert.Equal(t, time.Date(2021, 3, 11, 17, 42, 45, 0, time.UTC), measurements[0].IssuedAtTime)
+		assert.Equal(t, fetchedAtTime, measurements[0].FetchedAtTime)
+		assert.Equal(t, response.TimePeriod.Start, measurements[0].ForecastForTime)
+		assert.Equal(t, response.TimePeriod.End.Add(-15*time.Minute), measurements[95].ForecastForTime)
+	})
+}
+
+func TestCreateForecastMeasurementsForLoad(t *testing.T) {
+	t.Run("CreatesMeasurementForEachTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A65-response.xml")
+		var response apiv1.GetLoadForecastResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		fetchedAtTime := time.Date(2021, 3, 12, 16, 0, 0, 0, time.UTC)
+
+		// act
+		measurements := service.createForecastMeasurementsForLoad(response, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15}, fetchedAtTime)
+
+		assert.Equal(t, 96, len(measurements))
+		assert.Equal(t, apiv1.ForecastTypeLoad, measurements[0].ForecastType)
+		assert.Equal(t, 1, len(measurements[0].Samples))
+		assert.Equal(t, 10517.0, measurements[0].Samples[0].Value)
+		assert.Equal(t, time.Date(2021, 3, 12, 15, 2, 11, 0, time.UTC), measurements[0].IssuedAtTime)
+		assert.Equal(t, fetchedAtTime, measurements[0].FetchedAtTime)
+		assert.Equal(t, response.TimePeriod.Start, measurements[0].ForecastForTime)
+	})
+}
@@ -0,0 +1,252 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/sink"
+	"github.com/rs/zerolog/log"
+)
+
+// runForGenerationGaps re-fetches the time slots that had missing or partial generation samples in earlier runs, since
+// entsoe publishes some production types late; slots that are still incomplete are retried until they leave the lookback window
+func (s *service) runForGenerationGaps(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if areaConfig.GapLookbackHours <= 0 {
+		return lastState, nil
+	}
+
+	lookbackStart := time.Now().UTC().Add(time.Duration(-1*areaConfig.GapLookbackHours) * time.Hour)
+
+	s.stateMutex.RLock()
+	gaps := append([]time.Time{}, lastState.GenerationGaps[areaConfig.Area]...)
+	s.stateMutex.RUnlock()
+
+	openGaps := []time.Time{}
+	for _, g := range gaps {
+		if !g.Before(lookbackStart) {
+			openGaps = append(openGaps, g)
+		}
+	}
+	if expired := len(gaps) - len(openGaps); expired > 0 {
+		log.Warn().Msgf("Giving up on %v time slots with missing or partial generation samples for area %v, they're older than %v hours", expired, areaConfig.Area, areaConfig.GapLookbackHours)
+		gapsExpiredTotal.WithLabelValues(string(areaConfig.Area)).Add(float64(expired))
+	}
+
+	if len(openGaps) == 0 {
+		return lastState, s.updateGenerationGaps(ctx, areaConfig, lastState, gaps, openGaps)
+	}
+
+	log.Info().Msgf("Re-fetching %v time slots with missing or partial generation samples for area %v", len(openGaps), areaConfig.Area)
+
+	resolution := time.Duration(areaConfig.ResolutionMinutes) * time.Minute
+	remainingGaps := []time.Time{}
+	for i := 0; i < len(openGaps); {
+		if s.isStopping(stop) {
+			remainingGaps = append(remainingGaps, openGaps[i:]...)
+			break
+		}
+
+		// retrieve nearby gaps with a single request, limited to the same interval as regular retrieval
+		j := i + 1
+		for j < len(openGaps) && openGaps[j].Before(openGaps[i].Add(4*24*resolution)) {
+			j++
+		}
+
+		var response apiv1.GetAggregatedGenerationPerTypeResponse
+		retrievedInterval, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: openGaps[i], End: openGaps[j-1].Add(resolution)}, resolution, func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetAggregatedGenerationPerType(ctx, areaConfig.Area, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+
+		// the gaps after a split interval are retrieved with the next request
+		for j > i+1 && !openGaps[j-1].Before(retrievedInterval.End) {
+			j--
+		}
+		slots := openGaps[i:j]
+		i = j
+		if err != nil {
+			remainingGaps = append(remainingGaps, slots...)
+			continue
+		}
+
+		measurements := []apiv1.GenerationMeasurement{}
+		for _, slot := range slots {
+			measurement := s.createGenerationMeasurementForTimeSlot(response, slot, areaConfig)
+			if len(measurement.Samples) > 0 {
+				measurements = append(measurements, measurement)
+			}
+		}
+		if len(measurements) == 0 {
+			remainingGaps = append(remainingGaps, slots...)
+			continue
+		}
+
+		// slots without any samples can't be rewritten yet
+		stillMissing := s.findGenerationGaps(measurements, s.getExpectedProductionTypes(response, areaConfig))
+		for _, slot := range slots {
+			if !s.containsTimeSlot(measurements, slot) {
+				stillMissing = append(stillMissing, slot)
+			}
+		}
+		remainingGaps = append(remainingGaps, stillMissing...)
+
+		// rewrite the time slots with the same id if every sink replaces them, otherwise a sink like bigquery without upsert
+		// would add duplicates, so the completed values are stored as a new revision
+		s.stateMutex.RLock()
+		revisedMeasurements := s.getGenerationRevisions(areaConfig, lastState, measurements, time.Now().UTC(), s.sinkUpserts())
+		s.stateMutex.RUnlock()
+		if len(revisedMeasurements) == 0 {
+			continue
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamGeneration, revisedMeasurements)
+			if err != nil {
+				return err
+			}
+
+			s.stateMutex.Lock()
+			s.recordGenerationRevisions(areaConfig, lastState, revisedMeasurements)
+			s.stateMutex.Unlock()
+
+			// store the revisions right away, so a failing run doesn't write the same revision twice
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+	}
+
+	sort.Slice(remainingGaps, func(i, j int) bool { return remainingGaps[i].Before(remainingGaps[j]) })
+
+	repaired := len(openGaps) - len(remainingGaps)
+	log.Info().Msgf("Repaired %v of %v time slots with missing or partial generation samples for area %v", repaired, len(openGaps), areaConfig.Area)
+	gapsRepairedTotal.WithLabelValues(string(areaConfig.Area)).Add(float64(repaired))
+
+	return lastState, s.updateGenerationGaps(ctx, areaConfig, lastState, gaps, remainingGaps)
+}
+
+// updateGenerationGaps replaces the gaps that have been re-fetched by the ones that are still open and stores the state
+func (s *service) updateGenerationGaps(ctx context.Context, areaConfig apiv1.AreaConfig, lastState *apiv1.State, previousGaps, remainingGaps []time.Time) error {
+
+	s.stateMutex.Lock()
+	if len(remainingGaps) > 0 {
+		lastState.GenerationGaps[areaConfig.Area] = remainingGaps
+	} else {
+		delete(lastState.GenerationGaps, areaConfig.Area)
+	}
+	s.stateMutex.Unlock()
+
+	gapsOpen.WithLabelValues(string(areaConfig.Area)).Set(float64(len(remainingGaps)))
+
+	if len(previousGaps) == len(remainingGaps) {
+		return nil
+	}
+
+	return s.storeState(ctx, lastState)
+}
+
+// addGenerationGaps records the time slots with missing or partial samples within the lookback window, so they get
+// re-fetched on later runs; the state mutex has to be held by the caller
+func (s *service) addGenerationGaps(areaConfig apiv1.AreaConfig, lastState *apiv1.State, gaps []time.Time) {
+
+	if areaConfig.GapLookbackHours <= 0 {
+		return
+	}
+
+	lookbackStart := time.Now().UTC().Add(time.Duration(-1*areaConfig.GapLookbackHours) * time.Hour)
+
+	found := 0
+	for _, g := range gaps {
+		if g.Before(lookbackStart) {
+			continue
+		}
+		if lastState.GenerationGaps == nil {
+			lastState.GenerationGaps = make(map[apiv1.Area][]time.Time, 0)
+		}
+		exists := false
+		for _, existing := range lastState.GenerationGaps[areaConfig.Area] {
+			if existing.Equal(g) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			lastState.GenerationGaps[areaConfig.Area] = append(lastState.GenerationGaps[areaConfig.Area], g)
+			found++
+		}
+	}
+
+	if found == 0 {
+		return
+	}
+
+	areaGaps := lastState.GenerationGaps[areaConfig.Area]
+	sort.Slice(areaGaps, func(i, j int) bool { return areaGaps[i].Before(areaGaps[j]) })
+
+	log.Warn().Msgf("Found %v time slots with missing or partial generation samples for area %v, re-fetching them on later runs", found, areaConfig.Area)
+	gapsFoundTotal.WithLabelValues(string(areaConfig.Area)).Add(float64(found))
+	gapsOpen.WithLabelValues(string(areaConfig.Area)).Set(float64(len(areaGaps)))
+}
+
+// findGenerationGaps returns the time slots of the measurements that lack a sample for any of the expected production types
+func (s *service) findGenerationGaps(measurements []apiv1.GenerationMeasurement, expectedProductionTypes []apiv1.PsrType) (gaps []time.Time) {
+	for _, m := range measurements {
+		productionTypes := map[string]bool{}
+		for _, sample := range m.Samples {
+			if sample != nil {
+				productionTypes[sample.OriginalEnergyType] = true
+			}
+		}
+		for _, p := range expectedProductionTypes {
+			if !productionTypes[string(p)] {
+				gaps = append(gaps, m.MeasuredAtTime)
+				break
+			}
+		}
+	}
+
+	return gaps
+}
+
+// getExpectedProductionTypes returns the configured production types, or otherwise all that have a time serie in the response
+func (s *service) getExpectedProductionTypes(response apiv1.GetAggregatedGenerationPerTypeResponse, areaConfig apiv1.AreaConfig) (productionTypes []apiv1.PsrType) {
+
+	if len(areaConfig.ExpectedProductionTypes) > 0 {
+		return areaConfig.ExpectedProductionTypes
+	}
+
+	seen := map[apiv1.PsrType]bool{}
+	for _, ts := range response.TimeSeries {
+		if !seen[ts.MktPsrType.PsrType] {
+			seen[ts.MktPsrType.PsrType] = true
+			productionTypes = append(productionTypes, ts.MktPsrType.PsrType)
+		}
+	}
+
+	return productionTypes
+}
+
+// sinkUpserts returns whether the sinks replace a measurement that's inserted again with the same id
+func (s *service) sinkUpserts() bool {
+	upserter, ok := s.sinkClient.(sink.Upserter)
+	return !ok || upserter.Upserts()
+}
+
+func (s *service) containsTimeSlot(measurements []apiv1.GenerationMeasurement, timeSlotStartTime time.Time) bool {
+	for _, m := range measurements {
+		if m.MeasuredAtTime.Equal(timeSlotStartTime) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,275 @@
+package exporter
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/entsoe"
+	"github.com/alecthomas/assert"
+)
+
+type fakeEntsoeClient struct {
+	entsoe.Client
+	generationResponse apiv1.GetAggregatedGenerationPerTypeResponse
+	capacityResponse   apiv1.GetInstalledGenerationCapacityAggregatedResponse
+	err                error
+	// maxInterval rejects queries for longer intervals as too large, if set
+	maxInterval      time.Duration
+	requestIntervals []apiv1.TimeInterval
+}
+
+func (f *fakeEntsoeClient) GetAggregatedGenerationPerType(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (apiv1.GetAggregatedGenerationPerTypeResponse, error) {
+	f.requestIntervals = append(f.requestIntervals, timeInterval)
+	if f.maxInterval > 0 && timeInterval.End.Sub(timeInterval.Start) > f.maxInterval {
+		return apiv1.GetAggregatedGenerationPerTypeResponse{}, apiv1.ErrQueryTooLarge
+	}
+	return f.generationResponse, f.err
+}
+
+func (f *fakeEntsoeClient) GetInstalledGenerationCapacityAggregated(ctx context.Context, area apiv1.Area, timeInterval apiv1.TimeInterval) (apiv1.GetInstalledGenerationCapacityAggregatedResponse, error) {
+	return f.capacityResponse, f.err
+}
+
+type fakeSinkClient struct {
+	measurements []interface{}
+}
+
+func (f *fakeSinkClient) Init() error {
+	return nil
+}
+
+func (f *fakeSinkClient) InsertMeasurements(stream apiv1.MeasurementStream, measurements interface{}) error {
+	f.measurements = append(f.measurements, measurements)
+	return nil
+}
+
+func (f *fakeSinkClient) Close() error {
+	return nil
+}
+
+// fakeAppendingSinkClient adds a duplicate when a measurement is inserted again with the same id, like bigquery without upsert
+type fakeAppendingSinkClient struct {
+	fakeSinkClient
+}
+
+func (f *fakeAppendingSinkClient) Upserts() bool {
+	return false
+}
+
+type fakeStateClient struct {
+	state *apiv1.State
+}
+
+func (f *fakeStateClient) ReadState(ctx context.Context) (*apiv1.State, error) {
+	return f.state, nil
+}
+
+func (f *fakeStateClient) StoreState(ctx context.Context, state apiv1.State) error {
+	f.state = &state
+	return nil
+}
+
+func TestFindGenerationGaps(t *testing.T) {
+	t.Run("ReturnsTimeSlotsMissingAnExpectedProductionType", func(t *testing.T) {
+
+		service := service{}
+		timeSlot := time.Date(2021, 3, 12, 10, 0, 0, 0, time.UTC)
+		measurements := []apiv1.GenerationMeasurement{
+			{MeasuredAtTime: timeSlot, Samples: []*apiv1.Sample{{OriginalEnergyType: "B14"}, {OriginalEnergyType: "B16"}}},
+			{MeasuredAtTime: timeSlot.Add(15 * time.Minute), Samples: []*apiv1.Sample{{OriginalEnergyType: "B14"}}},
+		}
+
+		// act
+		gaps := service.findGenerationGaps(measurements, []apiv1.PsrType{apiv1.PsrTypeNuclear, apiv1.PsrTypeSolar})
+
+		assert.Equal(t, []time.Time{timeSlot.Add(15 * time.Minute)}, gaps)
+	})
+}
+
+func TestGetExpectedProductionTypes(t *testing.T) {
+	t.Run("ReturnsConfiguredProductionTypes", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		productionTypes := service.getExpectedProductionTypes(apiv1.GetAggregatedGenerationPerTypeResponse{}, apiv1.AreaConfig{ExpectedProductionTypes: []apiv1.PsrType{apiv1.PsrTypeSolar}})
+
+		assert.Equal(t, []apiv1.PsrType{apiv1.PsrTypeSolar}, productionTypes)
+	})
+
+	t.Run("ReturnsEachProductionTypeInResponseOnce", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
+		var response apiv1.GetAggregatedGenerationPerTypeResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		productionTypes := service.getExpectedProductionTypes(response, apiv1.AreaConfig{})
+
+		assert.Equal(t, 10, len(productionTypes))
+	})
+}
+
+func TestAddGenerationGaps(t *testing.T) {
+	t.Run("RecordsGapsWithinLookbackWindowOnce", func(t *testing.T) {
+
+		service := service{}
+		timeSlot := time.Now().UTC().Truncate(time.Hour)
+		lastState := &apiv1.State{}
+		areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, GapLookbackHours: 24}
+
+		// act
+		service.addGenerationGaps(areaConfig, lastState, []time.Time{timeSlot, timeSlot.Add(-1 * time.Hour)})
+		service.addGenerationGaps(areaConfig, lastState, []time.Time{timeSlot, timeSlot.Add(-48 * time.Hour)})
+
+		assert.Equal(t, []time.Time{timeSlot.Add(-1 * time.Hour), timeSlot}, lastState.GenerationGaps[apiv1.AreaNetherlands])
+	})
+
+	t.Run("RecordsNothingIfLookbackIsDisabled", func(t *testing.T) {
+
+		service := service{}
+		lastState := &apiv1.State{}
+
+		// act
+		service.addGenerationGaps(apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState, []time.Time{time.Now().UTC()})
+
+		assert.Equal(t, 0, len(lastState.GenerationGaps))
+	})
+}
+
+func TestRunForGenerationGaps(t *testing.T) {
+
+	testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
+	var response apiv1.GetAggregatedGenerationPerTypeResponse
+	err := xml.Unmarshal([]byte(testResponse), &response)
+	assert.Nil(t, err)
+
+	// keep the time slots of the test response within the lookback window
+	lookbackHours := int(time.Since(response.TimePeriod.Start).Hours()) + 24
+	timeSlot := response.TimePeriod.Start.Add(time.Hour)
+
+	t.Run("RewritesCompleteTimeSlotsAndRemovesThemFromState", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		stateClient := &fakeStateClient{}
+		service := service{sinkClient: sinkClient, stateClient: stateClient, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{GenerationGaps: map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}}}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		assert.Equal(t, timeSlot, sinkClient.measurements[0].([]apiv1.GenerationMeasurement)[0].MeasuredAtTime)
+		assert.Equal(t, 0, len(lastState.GenerationGaps))
+		assert.NotNil(t, stateClient.state)
+	})
+
+	t.Run("RewritesTimeSlotsWithTheirIDIfSinksUpsert", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{
+			GenerationGaps:      map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}},
+			GenerationRevisions: map[apiv1.Area][]apiv1.Revision{apiv1.AreaNetherlands: {{MeasuredAtTime: timeSlot, Checksum: "partial"}}},
+		}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		measurement := sinkClient.measurements[0].([]apiv1.GenerationMeasurement)[0]
+		assert.Equal(t, 0, measurement.RevisionNumber)
+		assert.Equal(t, apiv1.NewMeasurementID(apiv1.MeasurementStreamGeneration, measurement.Source, measurement.Area, timeSlot), measurement.ID)
+	})
+
+	t.Run("WritesTimeSlotsAsNewRevisionIfASinkAddsDuplicates", func(t *testing.T) {
+
+		sinkClient := &fakeAppendingSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{
+			GenerationGaps:      map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}},
+			GenerationRevisions: map[apiv1.Area][]apiv1.Revision{apiv1.AreaNetherlands: {{MeasuredAtTime: timeSlot, Checksum: "partial"}}},
+		}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		measurement := sinkClient.measurements[0].([]apiv1.GenerationMeasurement)[0]
+		assert.Equal(t, 1, measurement.RevisionNumber)
+		assert.NotEqual(t, apiv1.NewMeasurementID(apiv1.MeasurementStreamGeneration, measurement.Source, measurement.Area, timeSlot), measurement.ID)
+		assert.Equal(t, 1, lastState.GenerationRevisions[apiv1.AreaNetherlands][0].RevisionNumber)
+	})
+
+	t.Run("RetrievesGapsAfterSplitIntervalWithNextRequest", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		entsoeClient := &fakeEntsoeClient{generationResponse: response, maxInterval: time.Hour}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: entsoeClient}
+		lastState := &apiv1.State{GenerationGaps: map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot, timeSlot.Add(2 * time.Hour)}}}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(sinkClient.measurements))
+		assert.Equal(t, timeSlot, sinkClient.measurements[0].([]apiv1.GenerationMeasurement)[0].MeasuredAtTime)
+		assert.Equal(t, timeSlot.Add(2*time.Hour), sinkClient.measurements[1].([]apiv1.GenerationMeasurement)[0].MeasuredAtTime)
+		assert.Equal(t, apiv1.TimeInterval{Start: timeSlot.Add(2 * time.Hour), End: timeSlot.Add(2*time.Hour + 15*time.Minute)}, entsoeClient.requestIntervals[len(entsoeClient.requestIntervals)-1])
+		assert.Equal(t, 0, len(lastState.GenerationGaps))
+	})
+
+	t.Run("KeepsTimeSlotsThatAreStillIncomplete", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{GenerationGaps: map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}}}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours, ExpectedProductionTypes: []apiv1.PsrType{apiv1.PsrTypeMarin}}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		assert.Equal(t, []time.Time{timeSlot}, lastState.GenerationGaps[apiv1.AreaNetherlands])
+	})
+
+	t.Run("KeepsTimeSlotsWithoutData", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{err: apiv1.ErrNoMatchingDataFound}}
+		lastState := &apiv1.State{GenerationGaps: map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}}}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: lookbackHours}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+		assert.Equal(t, []time.Time{timeSlot}, lastState.GenerationGaps[apiv1.AreaNetherlands])
+	})
+
+	t.Run("DropsGapsOlderThanLookbackWindow", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		stateClient := &fakeStateClient{}
+		service := service{sinkClient: sinkClient, stateClient: stateClient, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{GenerationGaps: map[apiv1.Area][]time.Time{apiv1.AreaNetherlands: {timeSlot}}}
+
+		// act
+		_, err := service.runForGenerationGaps(context.Background(), make(chan struct{}), &sync.WaitGroup{}, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, GapLookbackHours: 24}, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+		assert.Equal(t, 0, len(lastState.GenerationGaps))
+		assert.NotNil(t, stateClient.state)
+	})
+}
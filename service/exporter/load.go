@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+func (s *service) runForLoad(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	log.Info().Msgf("Retrieving load for area %v / country %v", areaConfig.Area, areaConfig.Country)
+
+	for {
+		now := time.Now().UTC().Round(time.Duration(areaConfig.ResolutionMinutes) * time.Minute)
+
+		// if it's the first time use the start of the area, otherwise start at last stored value
+		start := now.AddDate(-1*areaConfig.StartYearsAgo, -1*areaConfig.StartMonthsAgo, -1*areaConfig.StartDaysAgo)
+		s.stateMutex.RLock()
+		if lastState != nil && lastState.LastRetrievedLoadTime != nil {
+			if lastRetrievedLoadTime, ok := lastState.LastRetrievedLoadTime[areaConfig.Area]; ok {
+				start = lastRetrievedLoadTime.Add(time.Duration(areaConfig.ResolutionMinutes) * time.Minute)
+			}
+		}
+		s.stateMutex.RUnlock()
+		end := start.Add(time.Duration(4*24*areaConfig.ResolutionMinutes) * time.Minute)
+		if end.After(now) {
+			end = now
+		}
+		log.Debug().Msgf("start: %v", start)
+		log.Debug().Msgf("end: %v", end)
+
+		// don't continue, we're up to date
+		if !start.Before(end) {
+			log.Info().Msgf("Start - %v - and end - %v - are equal, exiting", start, end)
+			return lastState, nil
+		}
+
+		// retrieve actual load
+		var response apiv1.GetActualTotalLoadResponse
+		_, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, time.Duration(areaConfig.ResolutionMinutes)*time.Minute, func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetActualTotalLoad(ctx, areaConfig.Area, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			log.Info().Msg("No data has been found, exiting")
+			return lastState, nil
+		}
+
+		if len(response.TimeSeries) == 0 {
+			log.Info().Msg("No timeseries have been returned, exiting")
+			return lastState, nil
+		}
+
+		nrOfSlots := int(response.TimePeriod.End.Sub(response.TimePeriod.Start).Minutes() / float64(areaConfig.ResolutionMinutes))
+
+		if nrOfSlots == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		measurements := []apiv1.LoadMeasurement{}
+		for i := 0; i < nrOfSlots; i++ {
+			timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*areaConfig.ResolutionMinutes) * time.Minute)
+			measurement := s.createLoadMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig)
+			if len(measurement.Samples) == 0 {
+				// load for this time slot hasn't been published yet
+				break
+			}
+
+			measurements = append(measurements, measurement)
+		}
+
+		if len(measurements) == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurements
+			err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamLoad, measurements)
+			if err != nil {
+				return err
+			}
+
+			// update state
+			s.stateMutex.Lock()
+			if lastState.LastRetrievedLoadTime == nil {
+				lastState.LastRetrievedLoadTime = make(map[apiv1.Area]time.Time, 0)
+			}
+			lastState.LastRetrievedLoadTime[areaConfig.Area] = measurements[len(measurements)-1].MeasuredAtTime
+			s.stateMutex.Unlock()
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+	}
+}
+
+func (s *service) createLoadMeasurementForTimeSlot(response apiv1.GetActualTotalLoadResponse, timeSlotStartTime time.Time, areaConfig apiv1.AreaConfig) apiv1.LoadMeasurement {
+	measurement := apiv1.LoadMeasurement{
+		ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamLoad, string(areaConfig.Source), string(areaConfig.Area), timeSlotStartTime),
+		Source:         string(areaConfig.Source),
+		Area:           string(areaConfig.Area),
+		Country:        string(areaConfig.Country),
+		MeasuredAtTime: timeSlotStartTime,
+	}
+
+	for _, ts := range response.TimeSeries {
+		period, ok := ts.Periods.Find(timeSlotStartTime)
+		if !ok {
+			continue
+		}
+
+		if measurement.Resolution == "" {
+			measurement.Resolution = string(apiv1.NewResolution(areaConfig.ResolutionMinutes))
+		}
+
+		point, ok := apiv1.GetPointForTimeSlot(period, ts.CurveType, timeSlotStartTime, time.Duration(areaConfig.ResolutionMinutes)*time.Minute)
+
+		if ok {
+			measurement.Samples = append(measurement.Samples, &apiv1.Sample{
+				EnergyType:      apiv1.EnergyTypeUnknown,
+				MetricType:      apiv1.MetricTypeGauge,
+				SampleDirection: apiv1.SampleDirectionOut,
+				SampleUnit:      s.mapToSampleUnit(ts.QuanityMeasurementUnit),
+				Value:           point.Quantity,
+			})
+		} else {
+			log.Warn().Msgf("Timeserie %v for load with resolution %v has no point for time slot %v", ts.ID, period.Resolution, timeSlotStartTime)
+		}
+	}
+
+	return measurement
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestCreateLoadMeasurementForTimeSlot(t *testing.T) {
+	t.Run("CreatesSampleForFirstTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A65-response.xml")
+		var response apiv1.GetActualTotalLoadResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement := service.createLoadMeasurementForTimeSlot(response, response.TimePeriod.Start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
+
+		assert.Equal(t, string(apiv1.ResolutionPT15M), measurement.Resolution)
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, apiv1.SampleUnitMegaWatt, measurement.Samples[0].SampleUnit)
+		assert.Equal(t, 10517.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("CreatesSampleForEachTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A65-response.xml")
+		var response apiv1.GetActualTotalLoadResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		for i := 0; i < 96; i++ {
+			timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*15) * time.Minute)
+			measurement := service.createLoadMeasurementForTimeSlot(response, timeSlotStartTime, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
+
+			assert.Equal(t, 1, len(measurement.Samples), "Number of samples for time slot %v does not match expectation", timeSlotStartTime)
+			assert.Equal(t, timeSlotStartTime, measurement.MeasuredAtTime)
+		}
+	})
+
+	t.Run("CreatesNoSamplesAfterLastTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A65-response.xml")
+		var response apiv1.GetActualTotalLoadResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement := service.createLoadMeasurementForTimeSlot(response, response.TimePeriod.End, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
+
+		assert.Equal(t, 0, len(measurement.Samples))
+	})
+}
@@ -0,0 +1,34 @@
+package exporter
+
+import (
+	prometheusclient "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	gapsFoundTotal = prometheusclient.NewCounterVec(prometheusclient.CounterOpts{
+		Name: "electricity_generation_gaps_found_total",
+		Help: "Time slots found with missing or partial generation samples.",
+	}, []string{"area"})
+	gapsRepairedTotal = prometheusclient.NewCounterVec(prometheusclient.CounterOpts{
+		Name: "electricity_generation_gaps_repaired_total",
+		Help: "Time slots with missing or partial generation samples that have been re-fetched completely.",
+	}, []string{"area"})
+	gapsExpiredTotal = prometheusclient.NewCounterVec(prometheusclient.CounterOpts{
+		Name: "electricity_generation_gaps_expired_total",
+		Help: "Time slots with missing or partial generation samples that fell out of the lookback window before being repaired.",
+	}, []string{"area"})
+	gapsOpen = prometheusclient.NewGaugeVec(prometheusclient.GaugeOpts{
+		Name: "electricity_generation_gaps_open",
+		Help: "Time slots with missing or partial generation samples still waiting to be re-fetched.",
+	}, []string{"area"})
+)
+
+// Collectors returns the metrics reported by the exporter itself, so they can be exposed and pushed along with the measurements
+func Collectors() []prometheusclient.Collector {
+	return []prometheusclient.Collector{
+		gapsFoundTotal,
+		gapsRepairedTotal,
+		gapsExpiredTotal,
+		gapsOpen,
+	}
+}
@@ -0,0 +1,187 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// minimumPriceResolution is the shortest resolution day-ahead prices are published at; the cursor advances by it and
+	// the time slots before the start are skipped, whatever the resolution of the returned period is
+	minimumPriceResolution = 15 * time.Minute
+)
+
+// getAreaConfigsWithUniquePriceAreas returns copies of the area configs in which only the first area with a price area
+// retrieves its prices, since areas sharing a price area would otherwise fetch and store the same prices concurrently
+func (s *service) getAreaConfigsWithUniquePriceAreas(areaConfigs []*apiv1.AreaConfig) []apiv1.AreaConfig {
+
+	uniqueAreaConfigs := make([]apiv1.AreaConfig, len(areaConfigs))
+	priceAreas := map[apiv1.Area]bool{}
+	for i, ac := range areaConfigs {
+		uniqueAreaConfigs[i] = *ac
+		if ac.PriceArea == apiv1.AreaUnknown {
+			continue
+		}
+		if priceAreas[ac.PriceArea] {
+			log.Info().Msgf("Prices for bidding zone %v are already retrieved for another area, skipping them for area %v", ac.PriceArea, ac.Area)
+			uniqueAreaConfigs[i].PriceArea = apiv1.AreaUnknown
+			continue
+		}
+		priceAreas[ac.PriceArea] = true
+	}
+
+	return uniqueAreaConfigs
+}
+
+func (s *service) runForPrices(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if areaConfig.PriceArea == apiv1.AreaUnknown {
+		return lastState, nil
+	}
+
+	log.Info().Msgf("Retrieving day ahead prices for bidding zone %v / country %v", areaConfig.PriceArea, areaConfig.Country)
+
+	for {
+		now := time.Now().UTC()
+
+		// day-ahead prices are published around noon for the next day, so retrieve up to the end of tomorrow
+		horizon := now.Truncate(24*time.Hour).AddDate(0, 0, 2)
+
+		// if it's the first time use the start of the area, otherwise start at last stored value
+		start := now.Truncate(minimumPriceResolution).AddDate(-1*areaConfig.StartYearsAgo, -1*areaConfig.StartMonthsAgo, -1*areaConfig.StartDaysAgo)
+		s.stateMutex.RLock()
+		if lastState != nil && lastState.LastRetrievedPriceTime != nil {
+			if lastRetrievedPriceTime, ok := lastState.LastRetrievedPriceTime[areaConfig.PriceArea]; ok {
+				start = lastRetrievedPriceTime.Add(minimumPriceResolution)
+			}
+		}
+		s.stateMutex.RUnlock()
+		end := start.Add(4 * 24 * time.Hour)
+		if end.After(horizon) {
+			end = horizon
+		}
+		log.Debug().Msgf("start: %v", start)
+		log.Debug().Msgf("end: %v", end)
+
+		// don't continue, we're up to date
+		if !start.Before(end) {
+			log.Info().Msgf("Start - %v - and end - %v - are equal, exiting", start, end)
+			return lastState, nil
+		}
+
+		// retrieve prices
+		var response apiv1.GetDayAheadPricesResponse
+		retrievedInterval, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, minimumPriceResolution, func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetDayAheadPrices(ctx, areaConfig.PriceArea, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+		end = retrievedInterval.End
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			log.Info().Msg("No data has been found, exiting")
+			return lastState, nil
+		}
+
+		if len(response.TimeSeries) == 0 {
+			log.Info().Msg("No timeseries have been returned, exiting")
+			return lastState, nil
+		}
+
+		measurements := s.createPriceMeasurements(response, apiv1.TimeInterval{Start: start, End: end}, areaConfig)
+
+		if len(measurements) == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurements
+			err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamPrice, measurements)
+			if err != nil {
+				return err
+			}
+
+			// update state
+			s.stateMutex.Lock()
+			if lastState.LastRetrievedPriceTime == nil {
+				lastState.LastRetrievedPriceTime = make(map[apiv1.Area]time.Time, 0)
+			}
+			lastState.LastRetrievedPriceTime[areaConfig.PriceArea] = measurements[len(measurements)-1].MeasuredAtTime
+			s.stateMutex.Unlock()
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+	}
+}
+
+// createPriceMeasurements returns a measurement per time slot within the interval, stepping through the response at the
+// resolution of the period each time slot falls in, since day-ahead prices are published per hour or per 15 minutes
+func (s *service) createPriceMeasurements(response apiv1.GetDayAheadPricesResponse, timeInterval apiv1.TimeInterval, areaConfig apiv1.AreaConfig) (measurements []apiv1.PriceMeasurement) {
+
+	timeSlotStartTime := response.TimePeriod.Start
+	for timeSlotStartTime.Before(timeInterval.End) && timeSlotStartTime.Before(response.TimePeriod.End) {
+		measurement, ok := s.createPriceMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig)
+		if !ok {
+			// prices for this time slot haven't been published yet
+			break
+		}
+		if !timeSlotStartTime.Before(timeInterval.Start) {
+			measurements = append(measurements, measurement)
+		}
+
+		resolution, _ := apiv1.Resolution(measurement.Resolution).GetDuration()
+		timeSlotStartTime = timeSlotStartTime.Add(resolution)
+	}
+
+	return measurements
+}
+
+func (s *service) createPriceMeasurementForTimeSlot(response apiv1.GetDayAheadPricesResponse, timeSlotStartTime time.Time, areaConfig apiv1.AreaConfig) (measurement apiv1.PriceMeasurement, ok bool) {
+
+	for _, ts := range response.TimeSeries {
+		period, ok := ts.Periods.Find(timeSlotStartTime)
+		if !ok {
+			continue
+		}
+
+		resolution, ok := period.Resolution.GetDuration()
+		if !ok {
+			log.Warn().Msgf("Timeserie %v for prices has unsupported resolution %v", ts.ID, period.Resolution)
+			continue
+		}
+
+		point, ok := apiv1.GetPointForTimeSlot(period, ts.CurveType, timeSlotStartTime, resolution)
+		if !ok {
+			log.Warn().Msgf("Timeserie %v for prices with resolution %v has no point for time slot %v", ts.ID, period.Resolution, timeSlotStartTime)
+			continue
+		}
+
+		return apiv1.PriceMeasurement{
+			ID:                   apiv1.NewMeasurementID(apiv1.MeasurementStreamPrice, string(areaConfig.Source), string(areaConfig.PriceArea), timeSlotStartTime),
+			Source:               string(areaConfig.Source),
+			Area:                 string(areaConfig.PriceArea),
+			Country:              string(areaConfig.Country),
+			Resolution:           string(apiv1.NewResolution(int(resolution.Minutes()))),
+			Currency:             string(ts.Currency),
+			PricePerMegaWattHour: point.PriceAmount,
+			MeasuredAtTime:       timeSlotStartTime,
+		}, true
+	}
+
+	return measurement, false
+}
@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+func TestCreatePriceMeasurementForTimeSlot(t *testing.T) {
+	t.Run("CreatesMeasurementForFirstTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A44-response.xml")
+		var response apiv1.GetDayAheadPricesResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement, ok := service.createPriceMeasurementForTimeSlot(response, response.TimePeriod.Start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, Country: apiv1.CountryCodeNetherlands, PriceArea: apiv1.AreaNetherlands})
+
+		assert.True(t, ok)
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurement.Area)
+		assert.Equal(t, string(apiv1.CurrencyEuro), measurement.Currency)
+		assert.Equal(t, string(apiv1.ResolutionPT60M), measurement.Resolution)
+		assert.Equal(t, 48.2, measurement.PricePerMegaWattHour)
+		assert.Equal(t, response.TimePeriod.Start, measurement.MeasuredAtTime)
+	})
+
+	t.Run("CreatesMeasurementForLastTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A44-response.xml")
+		var response apiv1.GetDayAheadPricesResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement, ok := service.createPriceMeasurementForTimeSlot(response, response.TimePeriod.End.Add(-1*time.Hour), apiv1.AreaConfig{Area: apiv1.AreaNetherlands, PriceArea: apiv1.AreaNetherlands})
+
+		assert.True(t, ok)
+		assert.Equal(t, 49.6, measurement.PricePerMegaWattHour)
+	})
+
+	t.Run("ReturnsFalseAfterLastTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A44-response.xml")
+		var response apiv1.GetDayAheadPricesResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		_, ok := service.createPriceMeasurementForTimeSlot(response, response.TimePeriod.End, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, PriceArea: apiv1.AreaNetherlands})
+
+		assert.False(t, ok)
+	})
+}
+
+func TestCreatePriceMeasurements(t *testing.T) {
+
+	periodStart := time.Date(2021, 3, 12, 23, 0, 0, 0, time.UTC)
+	response := apiv1.GetDayAheadPricesResponse{
+		TimePeriod: apiv1.TimeInterval{Start: periodStart, End: periodStart.Add(time.Hour)},
+		TimeSeries: []apiv1.PriceTimeSerie{{
+			Currency:  apiv1.CurrencyEuro,
+			CurveType: apiv1.CurveTypeSequentialFixedSizeBlock,
+			Periods: apiv1.TimeSeriePeriods{{
+				TimeInterval: apiv1.TimeInterval{Start: periodStart, End: periodStart.Add(time.Hour)},
+				Resolution:   apiv1.ResolutionPT15M,
+				Points:       []apiv1.TimeSeriePoint{{Position: 1, PriceAmount: 40}, {Position: 2, PriceAmount: 41}, {Position: 3, PriceAmount: 42}, {Position: 4, PriceAmount: 43}},
+			}},
+		}},
+	}
+
+	t.Run("CreatesMeasurementPerPointAtResolutionOfPeriod", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		measurements := service.createPriceMeasurements(response, apiv1.TimeInterval{Start: periodStart, End: periodStart.Add(2 * time.Hour)}, apiv1.AreaConfig{PriceArea: apiv1.AreaNetherlands})
+
+		assert.Equal(t, 4, len(measurements))
+		assert.Equal(t, string(apiv1.ResolutionPT15M), measurements[0].Resolution)
+		assert.Equal(t, periodStart.Add(45*time.Minute), measurements[3].MeasuredAtTime)
+		assert.Equal(t, 43.0, measurements[3].PricePerMegaWattHour)
+	})
+
+	t.Run("SkipsTimeSlotsBeforeStart", func(t *testing.T) {
+
+		service := service{}
+
+		// act
+		measurements := service.createPriceMeasurements(response, apiv1.TimeInterval{Start: periodStart.Add(30 * time.Minute), End: periodStart.Add(2 * time.Hour)}, apiv1.AreaConfig{PriceArea: apiv1.AreaNetherlands})
+
+		assert.Equal(t, 2, len(measurements))
+		assert.Equal(t, periodStart.Add(30*time.Minute), measurements[0].MeasuredAtTime)
+	})
+}
+
+func TestGetAreaConfigsWithUniquePriceAreas(t *testing.T) {
+	t.Run("ClearsPriceAreaOfLaterAreasSharingIt", func(t *testing.T) {
+
+		service := service{}
+		areaConfigs := []*apiv1.AreaConfig{
+			{Area: "10YDK-1--------W", PriceArea: "10YDK-1--------W"},
+			{Area: "10YDK-2--------M", PriceArea: "10YDK-1--------W"},
+			{Area: apiv1.AreaNetherlands, PriceArea: apiv1.AreaNetherlands},
+		}
+
+		// act
+		uniqueAreaConfigs := service.getAreaConfigsWithUniquePriceAreas(areaConfigs)
+
+		assert.Equal(t, 3, len(uniqueAreaConfigs))
+		assert.Equal(t, apiv1.Area("10YDK-1--------W"), uniqueAreaConfigs[0].PriceArea)
+		assert.Equal(t, apiv1.AreaUnknown, uniqueAreaConfigs[1].PriceArea)
+		assert.Equal(t, apiv1.AreaNetherlands, uniqueAreaConfigs[2].PriceArea)
+		assert.Equal(t, apiv1.Area("10YDK-1--------W"), areaConfigs[1].PriceArea)
+	})
+}
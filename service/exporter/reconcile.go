@@ -0,0 +1,207 @@
+package exporter
+
+import (
+	"fmt"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/rs/zerolog/log"
+)
+
+// reconcileState compares the cursors in the state with the latest time slots stored in the sink and picks a cursor per
+// area and stream according to the cursor policy, so a lost or restored state file doesn't lead to gaps or duplicates
+func (s *service) reconcileState(lastState *apiv1.State) (*apiv1.State, error) {
+
+	if s.cursorPolicy == apiv1.CursorPolicyUnknown || s.cursorPolicy == apiv1.CursorPolicyNone {
+		return lastState, nil
+	}
+
+	if s.stateReader == nil {
+		log.Warn().Msgf("Cursor policy %v is set, but none of the sinks can derive state from stored measurements; resuming from state", s.cursorPolicy)
+		return lastState, nil
+	}
+
+	storedState, err := s.stateReader.ReadStoredState()
+	if err != nil {
+		return lastState, fmt.Errorf("Failed reading stored state from sink: %w", err)
+	}
+	if storedState == nil {
+		return lastState, nil
+	}
+
+	// streams the sink doesn't store have no map in the stored state and keep their cursors from the state
+	reconciledState := *lastState
+	discrepancies := 0
+
+	if storedState.LastRetrievedGenerationTime != nil {
+		reconciledState.LastRetrievedGenerationTime = s.reconcileAreaCursors(apiv1.MeasurementStreamGeneration, "", lastState.LastRetrievedGenerationTime, storedState.LastRetrievedGenerationTime, &discrepancies)
+	}
+
+	if storedState.LastRetrievedExchangeTime != nil {
+		reconciledState.LastRetrievedExchangeTime = map[apiv1.Area]map[apiv1.Area]time.Time{}
+		for _, area := range s.getAreas(lastState.LastRetrievedExchangeTime, storedState.LastRetrievedExchangeTime) {
+			cursors := s.reconcileAreaCursors(apiv1.MeasurementStreamExchange, string(area)+" with ", lastState.LastRetrievedExchangeTime[area], storedState.LastRetrievedExchangeTime[area], &discrepancies)
+			if len(cursors) > 0 {
+				reconciledState.LastRetrievedExchangeTime[area] = cursors
+			}
+		}
+	}
+
+	if storedState.LastRetrievedBalanceTime != nil {
+		reconciledState.LastRetrievedBalanceTime = s.reconcileAreaCursors(apiv1.MeasurementStreamBalance, "", lastState.LastRetrievedBalanceTime, storedState.LastRetrievedBalanceTime, &discrepancies)
+	}
+
+	if storedState.LastRetrievedLoadTime != nil {
+		reconciledState.LastRetrievedLoadTime = s.reconcileAreaCursors(apiv1.MeasurementStreamLoad, "", lastState.LastRetrievedLoadTime, storedState.LastRetrievedLoadTime, &discrepancies)
+	}
+
+	if storedState.LastRetrievedForecastTime != nil {
+		reconciledState.LastRetrievedForecastTime = map[apiv1.Area]map[apiv1.ForecastType]time.Time{}
+		for _, area := range s.getAreas(lastState.LastRetrievedForecastTime, storedState.LastRetrievedForecastTime) {
+			cursors := s.reconcileForecastCursors(area, lastState.LastRetrievedForecastTime[area], storedState.LastRetrievedForecastTime[area], &discrepancies)
+			if len(cursors) > 0 {
+				reconciledState.LastRetrievedForecastTime[area] = cursors
+			}
+		}
+	}
+
+	if storedState.LastRetrievedPriceTime != nil {
+		reconciledState.LastRetrievedPriceTime = s.reconcileAreaCursors(apiv1.MeasurementStreamPrice, "", lastState.LastRetrievedPriceTime, storedState.LastRetrievedPriceTime, &discrepancies)
+	}
+
+	// consumption has a single cursor, so a sink without consumption measurements can't be told apart from an empty one
+	if !storedState.LastRetrievedConsumptionTime.IsZero() {
+		reconciledState.LastRetrievedConsumptionTime, _ = s.reconcileCursor(apiv1.MeasurementStreamConsumption, "all areas", lastState.LastRetrievedConsumptionTime, !lastState.LastRetrievedConsumptionTime.IsZero(), storedState.LastRetrievedConsumptionTime, true, &discrepancies)
+	}
+
+	if storedState.LastRetrievedCapacityTime != nil {
+		reconciledState.LastRetrievedCapacityTime = s.reconcileAreaCursors(apiv1.MeasurementStreamCapacity, "", lastState.LastRetrievedCapacityTime, storedState.LastRetrievedCapacityTime, &discrepancies)
+	}
+
+	log.Info().Msgf("Reconciled cursors in state with sink using policy %v, found %v discrepancies", s.cursorPolicy, discrepancies)
+
+	return &reconciledState, nil
+}
+
+// reconcileAreaCursors reconciles the cursor for each area that has one in either the state or the sink
+func (s *service) reconcileAreaCursors(stream apiv1.MeasurementStream, keyPrefix string, stateTimes, storedTimes map[apiv1.Area]time.Time, discrepancies *int) map[apiv1.Area]time.Time {
+
+	cursors := map[apiv1.Area]time.Time{}
+	for _, area := range s.getAreas(stateTimes, storedTimes) {
+		stateTime, hasStateTime := stateTimes[area]
+		storedTime, hasStoredTime := storedTimes[area]
+		if cursor, ok := s.reconcileCursor(stream, keyPrefix+string(area), stateTime, hasStateTime, storedTime, hasStoredTime, discrepancies); ok {
+			cursors[area] = cursor
+		}
+	}
+
+	return cursors
+}
+
+// reconcileForecastCursors reconciles the cursor for each forecast type of an area that has one in either the state or the sink
+func (s *service) reconcileForecastCursors(area apiv1.Area, stateTimes, storedTimes map[apiv1.ForecastType]time.Time, discrepancies *int) map[apiv1.ForecastType]time.Time {
+
+	forecastTypes := []apiv1.ForecastType{}
+	for forecastType := range stateTimes {
+		forecastTypes = append(forecastTypes, forecastType)
+	}
+	for forecastType := range storedTimes {
+		if _, ok := stateTimes[forecastType]; !ok {
+			forecastTypes = append(forecastTypes, forecastType)
+		}
+	}
+
+	cursors := map[apiv1.ForecastType]time.Time{}
+	for _, forecastType := range forecastTypes {
+		stateTime, hasStateTime := stateTimes[forecastType]
+		storedTime, hasStoredTime := storedTimes[forecastType]
+		if cursor, ok := s.reconcileCursor(apiv1.MeasurementStreamForecast, fmt.Sprintf("%v %v", area, forecastType), stateTime, hasStateTime, storedTime, hasStoredTime, discrepancies); ok {
+			cursors[forecastType] = cursor
+		}
+	}
+
+	return cursors
+}
+
+// getAreas returns the areas of the state followed by the ones only known in the sink
+func (s *service) getAreas(stateTimes, storedTimes interface{}) (areas []apiv1.Area) {
+
+	seen := map[apiv1.Area]bool{}
+	add := func(area apiv1.Area) {
+		if !seen[area] {
+			seen[area] = true
+			areas = append(areas, area)
+		}
+	}
+
+	for _, times := range []interface{}{stateTimes, storedTimes} {
+		switch t := times.(type) {
+		case map[apiv1.Area]time.Time:
+			for area := range t {
+				add(area)
+			}
+		case map[apiv1.Area]map[apiv1.Area]time.Time:
+			for area := range t {
+				add(area)
+			}
+		case map[apiv1.Area]map[apiv1.ForecastType]time.Time:
+			for area := range t {
+				add(area)
+			}
+		}
+	}
+
+	return areas
+}
+
+// reconcileCursor picks the cursor to resume from and logs it if state and sink disagree; it returns false if retrieval
+// should start over from the configured start
+func (s *service) reconcileCursor(stream apiv1.MeasurementStream, key string, stateTime time.Time, hasStateTime bool, storedTime time.Time, hasStoredTime bool, discrepancies *int) (time.Time, bool) {
+
+	if hasStateTime == hasStoredTime && stateTime.Equal(storedTime) {
+		return stateTime, hasStateTime
+	}
+
+	var cursor time.Time
+	var hasCursor bool
+	switch s.cursorPolicy {
+	case apiv1.CursorPolicySink:
+		cursor, hasCursor = storedTime, hasStoredTime
+
+	case apiv1.CursorPolicyEarliest:
+		// a cursor missing on either side means nothing can be assumed to be stored
+		if hasStateTime && hasStoredTime {
+			cursor, hasCursor = stateTime, true
+			if storedTime.Before(stateTime) {
+				cursor = storedTime
+			}
+		}
+
+	case apiv1.CursorPolicyLatest:
+		cursor, hasCursor = stateTime, hasStateTime
+		if hasStoredTime && (!hasStateTime || storedTime.After(stateTime)) {
+			cursor, hasCursor = storedTime, true
+		}
+
+	default:
+		cursor, hasCursor = stateTime, hasStateTime
+	}
+
+	resumeFrom := "the configured start"
+	if hasCursor {
+		resumeFrom = s.formatCursor(cursor, hasCursor)
+	}
+
+	*discrepancies++
+	log.Warn().Msgf("Cursor for %v measurements of %v is %v in state, but %v in sink; resuming from %v according to policy %v", stream, key, s.formatCursor(stateTime, hasStateTime), s.formatCursor(storedTime, hasStoredTime), resumeFrom, s.cursorPolicy)
+
+	return cursor, hasCursor
+}
+
+func (s *service) formatCursor(cursor time.Time, hasCursor bool) string {
+	if !hasCursor {
+		return "none"
+	}
+
+	return cursor.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+type fakeStateReader struct {
+	state *apiv1.State
+	err   error
+}
+
+func (f *fakeStateReader) ReadStoredState() (*apiv1.State, error) {
+	return f.state, f.err
+}
+
+func TestReconcileState(t *testing.T) {
+
+	earlier := time.Date(2021, 3, 12, 10, 0, 0, 0, time.UTC)
+	later := time.Date(2021, 3, 12, 11, 0, 0, 0, time.UTC)
+
+	newStates := func() (*apiv1.State, *apiv1.State) {
+		lastState := &apiv1.State{
+			LastRetrievedGenerationTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: later, apiv1.AreaBelgium: earlier},
+			LastRetrievedPriceTime:      map[apiv1.Area]time.Time{apiv1.AreaNetherlands: later},
+		}
+		storedState := &apiv1.State{
+			LastRetrievedGenerationTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: earlier, apiv1.AreaGermanyLuxembourg: later},
+		}
+		return lastState, storedState
+	}
+
+	t.Run("ReturnsStateUnchangedForPolicyNone", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyNone}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, lastState, state)
+	})
+
+	t.Run("ReturnsStateUnchangedIfNoSinkCanDeriveState", func(t *testing.T) {
+
+		lastState, _ := newStates()
+		service := service{cursorPolicy: apiv1.CursorPolicyEarliest}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, lastState, state)
+	})
+
+	t.Run("ReturnsErrorIfStoredStateCannotBeRead", func(t *testing.T) {
+
+		lastState, _ := newStates()
+		service := service{stateReader: &fakeStateReader{err: errors.New("failed")}, cursorPolicy: apiv1.CursorPolicySink}
+
+		// act
+		_, err := service.reconcileState(lastState)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("KeepsStateCursorsForPolicyState", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyState}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, lastState.LastRetrievedGenerationTime, state.LastRetrievedGenerationTime)
+	})
+
+	t.Run("UsesSinkCursorsForPolicySink", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicySink}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, storedState.LastRetrievedGenerationTime, state.LastRetrievedGenerationTime)
+	})
+
+	t.Run("UsesEarliestCursorAndStartsOverIfEitherIsMissingForPolicyEarliest", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyEarliest}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[apiv1.Area]time.Time{apiv1.AreaNetherlands: earlier}, state.LastRetrievedGenerationTime)
+	})
+
+	t.Run("UsesLatestCursorOfEitherForPolicyLatest", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyLatest}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[apiv1.Area]time.Time{apiv1.AreaNetherlands: later, apiv1.AreaBelgium: earlier, apiv1.AreaGermanyLuxembourg: later}, state.LastRetrievedGenerationTime)
+	})
+
+	t.Run("KeepsStateCursorsForStreamsNotStoredInSink", func(t *testing.T) {
+
+		lastState, storedState := newStates()
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyEarliest}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, lastState.LastRetrievedPriceTime, state.LastRetrievedPriceTime)
+	})
+
+	t.Run("ReconcilesExchangeCursorsPerPeer", func(t *testing.T) {
+
+		lastState := &apiv1.State{
+			LastRetrievedExchangeTime: map[apiv1.Area]map[apiv1.Area]time.Time{apiv1.AreaNetherlands: {apiv1.AreaBelgium: later}},
+		}
+		storedState := &apiv1.State{
+			LastRetrievedExchangeTime: map[apiv1.Area]map[apiv1.Area]time.Time{apiv1.AreaNetherlands: {apiv1.AreaBelgium: earlier}},
+		}
+		service := service{stateReader: &fakeStateReader{state: storedState}, cursorPolicy: apiv1.CursorPolicyEarliest}
+
+		// act
+		state, err := service.reconcileState(lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, earlier, state.LastRetrievedExchangeTime[apiv1.AreaNetherlands][apiv1.AreaBelgium])
+	})
+}
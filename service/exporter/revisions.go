@@ -0,0 +1,228 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/state"
+	"github.com/rs/zerolog/log"
+)
+
+// runForGenerationRevisions re-fetches the re-read window on every run, since tsos keep correcting realised generation
+// for days after publishing it; time slots with changed values are written as a new revision
+func (s *service) runForGenerationRevisions(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if areaConfig.RereadWindowHours <= 0 {
+		return lastState, nil
+	}
+
+	resolution := time.Duration(areaConfig.ResolutionMinutes) * time.Minute
+	start := time.Now().UTC().Round(resolution).Add(time.Duration(-1*areaConfig.RereadWindowHours) * time.Hour)
+
+	// only re-read what has been retrieved before, the rest is retrieved as usual
+	s.stateMutex.RLock()
+	lastRetrievedGenerationTime, ok := lastState.LastRetrievedGenerationTime[areaConfig.Area]
+	s.stateMutex.RUnlock()
+	if !ok {
+		return lastState, nil
+	}
+	end := lastRetrievedGenerationTime.Add(resolution)
+
+	log.Info().Msgf("Re-reading generation for area %v from %v to %v", areaConfig.Area, start, end)
+
+	for start.Before(end) {
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+
+		intervalEnd := start.Add(4 * 24 * resolution)
+		if intervalEnd.After(end) {
+			intervalEnd = end
+		}
+
+		var response apiv1.GetAggregatedGenerationPerTypeResponse
+		retrievedInterval, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: intervalEnd}, resolution, func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetAggregatedGenerationPerType(ctx, areaConfig.Area, timeInterval)
+			return
+		})
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+			return lastState, err
+		}
+		intervalEnd = retrievedInterval.End
+
+		measurements := []apiv1.GenerationMeasurement{}
+		if err == nil {
+			nrOfSlots := int(response.TimePeriod.End.Sub(response.TimePeriod.Start).Minutes() / float64(areaConfig.ResolutionMinutes))
+			for i := 0; i < nrOfSlots; i++ {
+				timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i) * resolution)
+				if timeSlotStartTime.Before(start) || !timeSlotStartTime.Before(intervalEnd) {
+					continue
+				}
+				measurements = append(measurements, s.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig))
+			}
+		}
+		start = intervalEnd
+
+		s.stateMutex.RLock()
+		revisedMeasurements := s.getGenerationRevisions(areaConfig, lastState, measurements, time.Now().UTC(), false)
+		s.stateMutex.RUnlock()
+
+		// time slots without a recorded revision have been stored before re-reading got enabled or the state got lost, so
+		// unless the sinks replace them only their checksum is recorded, instead of storing them a second time
+		unrecordedMeasurements := []apiv1.GenerationMeasurement{}
+		if !s.sinkUpserts() {
+			correctedMeasurements := []apiv1.GenerationMeasurement{}
+			for _, m := range revisedMeasurements {
+				if m.RevisionNumber == 0 {
+					unrecordedMeasurements = append(unrecordedMeasurements, m)
+					continue
+				}
+				correctedMeasurements = append(correctedMeasurements, m)
+			}
+			revisedMeasurements = correctedMeasurements
+		}
+
+		if len(revisedMeasurements) == 0 && len(unrecordedMeasurements) == 0 {
+			continue
+		}
+
+		if len(revisedMeasurements) > 0 {
+			log.Info().Msgf("Generation for %v of %v re-read time slots in area %v has been corrected, storing new revisions", len(revisedMeasurements), len(measurements), areaConfig.Area)
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			if len(revisedMeasurements) > 0 {
+				err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamGeneration, revisedMeasurements)
+				if err != nil {
+					return err
+				}
+			}
+
+			s.stateMutex.Lock()
+			s.recordGenerationRevisions(areaConfig, lastState, append(unrecordedMeasurements, revisedMeasurements...))
+			s.stateMutex.Unlock()
+
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+	}
+
+	return lastState, nil
+}
+
+// validateStateBackend rejects gap lookback and re-read windows if the state is derived from the stored measurements, since
+// the generation gaps and revisions they depend on would get lost after every run
+func (s *service) validateStateBackend(config apiv1.Config) error {
+
+	deriver, ok := s.stateClient.(state.Deriver)
+	if !ok || !deriver.DerivesState() {
+		return nil
+	}
+
+	for _, a := range config.Areas {
+		if a.GapLookbackHours > 0 || a.RereadWindowHours > 0 {
+			return fmt.Errorf("Area %v sets gapLookbackHours or rereadWindowHours, but the state backend derives the state from stored measurements and can't keep generation gaps and revisions; use the configmap or file state backend instead", a.Area)
+		}
+	}
+
+	return nil
+}
+
+// getGenerationRevisions returns the measurements for new time slots and those with values that differ from the last
+// written revision, the latter numbered as the next revision with their own id, or with rewrite set as the last written
+// revision with its id; the state mutex has to be held by the caller
+func (s *service) getGenerationRevisions(areaConfig apiv1.AreaConfig, lastState *apiv1.State, measurements []apiv1.GenerationMeasurement, fetchedAtTime time.Time, rewrite bool) (revisedMeasurements []apiv1.GenerationMeasurement) {
+
+	revisions := map[int64]apiv1.Revision{}
+	for _, r := range lastState.GenerationRevisions[areaConfig.Area] {
+		revisions[r.MeasuredAtTime.UnixNano()] = r
+	}
+
+	for _, m := range measurements {
+		m.FetchedAtTime = fetchedAtTime
+		if r, ok := revisions[m.MeasuredAtTime.UnixNano()]; ok {
+			if r.Checksum == s.getGenerationChecksum(m) {
+				continue
+			}
+			m.RevisionNumber = r.RevisionNumber
+			if !rewrite {
+				m.RevisionNumber++
+			}
+			if m.RevisionNumber > 0 {
+				m.ID = apiv1.NewMeasurementID(apiv1.MeasurementStreamGeneration, m.Source, m.Area, m.MeasuredAtTime, strconv.Itoa(m.RevisionNumber))
+			}
+		}
+		revisedMeasurements = append(revisedMeasurements, m)
+	}
+
+	return revisedMeasurements
+}
+
+// recordGenerationRevisions keeps the checksum of written measurements within the re-read window or gap lookback, whichever
+// is longer, so corrections and repaired gaps can be detected on later runs; the state mutex has to be held by the caller
+func (s *service) recordGenerationRevisions(areaConfig apiv1.AreaConfig, lastState *apiv1.State, measurements []apiv1.GenerationMeasurement) {
+
+	windowHours := areaConfig.RereadWindowHours
+	if areaConfig.GapLookbackHours > windowHours {
+		windowHours = areaConfig.GapLookbackHours
+	}
+	if windowHours <= 0 {
+		return
+	}
+
+	windowStart := time.Now().UTC().Add(time.Duration(-1*windowHours) * time.Hour)
+
+	revisions := map[int64]apiv1.Revision{}
+	for _, r := range lastState.GenerationRevisions[areaConfig.Area] {
+		revisions[r.MeasuredAtTime.UnixNano()] = r
+	}
+	for _, m := range measurements {
+		revisions[m.MeasuredAtTime.UnixNano()] = apiv1.Revision{
+			MeasuredAtTime: m.MeasuredAtTime,
+			RevisionNumber: m.RevisionNumber,
+			Checksum:       s.getGenerationChecksum(m),
+		}
+	}
+
+	areaRevisions := []apiv1.Revision{}
+	for _, r := range revisions {
+		if r.MeasuredAtTime.Before(windowStart) {
+			continue
+		}
+		areaRevisions = append(areaRevisions, r)
+	}
+	sort.Slice(areaRevisions, func(i, j int) bool { return areaRevisions[i].MeasuredAtTime.Before(areaRevisions[j].MeasuredAtTime) })
+
+	if lastState.GenerationRevisions == nil {
+		lastState.GenerationRevisions = make(map[apiv1.Area][]apiv1.Revision, 0)
+	}
+	lastState.GenerationRevisions[areaConfig.Area] = areaRevisions
+}
+
+// getGenerationChecksum returns a short hash of the published values of a measurement; derived values like carbon
+// intensity are left out, so a change in configuration doesn't look like a correction
+func (s *service) getGenerationChecksum(measurement apiv1.GenerationMeasurement) string {
+	return s.getSamplesChecksum(measurement.Samples)
+}
+
+// getSamplesChecksum returns a short hash of the published values of samples
+func (s *service) getSamplesChecksum(samples []*apiv1.Sample) string {
+
+	hash := sha256.New()
+	for _, sample := range samples {
+		if sample != nil {
+			fmt.Fprintf(hash, "%v|%v|%v\n", sample.OriginalEnergyType, sample.SampleDirection, sample.Value)
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16]
+}
@@ -0,0 +1,235 @@
+package exporter
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
+	"github.com/alecthomas/assert"
+)
+
+type fakeDerivingStateClient struct {
+	fakeStateClient
+}
+
+func (f *fakeDerivingStateClient) DerivesState() bool {
+	return true
+}
+
+func TestValidateStateBackend(t *testing.T) {
+
+	t.Run("RejectsRereadWindowIfStateIsDerived", func(t *testing.T) {
+
+		service := service{stateClient: &fakeDerivingStateClient{}}
+
+		// act
+		err := service.validateStateBackend(apiv1.Config{Areas: []*apiv1.AreaConfig{{Area: apiv1.AreaNetherlands, RereadWindowHours: 72}}})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("RejectsGapLookbackIfStateIsDerived", func(t *testing.T) {
+
+		service := service{stateClient: &fakeDerivingStateClient{}}
+
+		// act
+		err := service.validateStateBackend(apiv1.Config{Areas: []*apiv1.AreaConfig{{Area: apiv1.AreaNetherlands, GapLookbackHours: 48}}})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("AcceptsRereadWindowAndGapLookbackIfStateIsStored", func(t *testing.T) {
+
+		service := service{stateClient: &fakeStateClient{}}
+
+		// act
+		err := service.validateStateBackend(apiv1.Config{Areas: []*apiv1.AreaConfig{{Area: apiv1.AreaNetherlands, RereadWindowHours: 72, GapLookbackHours: 48}}})
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestGetGenerationRevisions(t *testing.T) {
+
+	timeSlot := time.Now().UTC().Truncate(time.Hour)
+	areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, RereadWindowHours: 72}
+	newMeasurement := func(value float64) apiv1.GenerationMeasurement {
+		return apiv1.GenerationMeasurement{
+			ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamGeneration, "ENTSOE", string(apiv1.AreaNetherlands), timeSlot),
+			Source:         "ENTSOE",
+			Area:           string(apiv1.AreaNetherlands),
+			MeasuredAtTime: timeSlot,
+			Samples:        []*apiv1.Sample{{OriginalEnergyType: "B16", SampleDirection: apiv1.SampleDirectionIn, Value: value}},
+		}
+	}
+
+	t.Run("ReturnsMeasurementsForNewTimeSlotsAsFirstRevision", func(t *testing.T) {
+
+		service := service{}
+		fetchedAtTime := time.Now().UTC()
+
+		// act
+		measurements := service.getGenerationRevisions(areaConfig, &apiv1.State{}, []apiv1.GenerationMeasurement{newMeasurement(1)}, fetchedAtTime, false)
+
+		assert.Equal(t, 1, len(measurements))
+		assert.Equal(t, 0, measurements[0].RevisionNumber)
+		assert.Equal(t, newMeasurement(1).ID, measurements[0].ID)
+		assert.Equal(t, fetchedAtTime, measurements[0].FetchedAtTime)
+	})
+
+	t.Run("SkipsUnchangedTimeSlots", func(t *testing.T) {
+
+		service := service{}
+		lastState := &apiv1.State{}
+		service.recordGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(1)})
+
+		// act
+		measurements := service.getGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(1)}, time.Now().UTC(), false)
+
+		assert.Equal(t, 0, len(measurements))
+	})
+
+	t.Run("ReturnsChangedTimeSlotsAsNextRevisionWithOwnID", func(t *testing.T) {
+
+		service := service{}
+		lastState := &apiv1.State{}
+		service.recordGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(1)})
+
+		// act
+		measurements := service.getGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(2)}, time.Now().UTC(), false)
+
+		assert.Equal(t, 1, len(measurements))
+		assert.Equal(t, 1, measurements[0].RevisionNumber)
+		assert.NotEqual(t, newMeasurement(2).ID, measurements[0].ID)
+	})
+
+	t.Run("ReturnsChangedTimeSlotsAsLastRevisionWithItsIDWhenRewriting", func(t *testing.T) {
+
+		service := service{}
+		lastState := &apiv1.State{}
+		service.recordGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(1)})
+
+		// act
+		measurements := service.getGenerationRevisions(areaConfig, lastState, []apiv1.GenerationMeasurement{newMeasurement(2)}, time.Now().UTC(), true)
+
+		assert.Equal(t, 1, len(measurements))
+		assert.Equal(t, 0, measurements[0].RevisionNumber)
+		assert.Equal(t, newMeasurement(2).ID, measurements[0].ID)
+	})
+}
+
+func TestRecordGenerationRevisions(t *testing.T) {
+	t.Run("KeepsRevisionsWithinReReadWindowOnly", func(t *testing.T) {
+
+		service := service{}
+		timeSlot := time.Now().UTC().Truncate(time.Hour)
+		lastState := &apiv1.State{}
+
+		// act
+		service.recordGenerationRevisions(apiv1.AreaConfig{Area: apiv1.AreaNetherlands, RereadWindowHours: 24}, lastState, []apiv1.GenerationMeasurement{
+			{MeasuredAtTime: timeSlot.Add(-48 * time.Hour)},
+			{MeasuredAtTime: timeSlot, RevisionNumber: 3},
+		})
+
+		assert.Equal(t, 1, len(lastState.GenerationRevisions[apiv1.AreaNetherlands]))
+		assert.Equal(t, 3, lastState.GenerationRevisions[apiv1.AreaNetherlands][0].RevisionNumber)
+	})
+
+	t.Run("KeepsRevisionsWithinGapLookbackIfLonger", func(t *testing.T) {
+
+		service := service{}
+		timeSlot := time.Now().UTC().Truncate(time.Hour)
+		lastState := &apiv1.State{}
+
+		// act
+		service.recordGenerationRevisions(apiv1.AreaConfig{Area: apiv1.AreaNetherlands, GapLookbackHours: 72}, lastState, []apiv1.GenerationMeasurement{
+			{MeasuredAtTime: timeSlot.Add(-48 * time.Hour)},
+		})
+
+		assert.Equal(t, 1, len(lastState.GenerationRevisions[apiv1.AreaNetherlands]))
+	})
+
+	t.Run("RecordsNothingIfReReadWindowAndGapLookbackAreDisabled", func(t *testing.T) {
+
+		service := service{}
+		lastState := &apiv1.State{}
+
+		// act
+		service.recordGenerationRevisions(apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, lastState, []apiv1.GenerationMeasurement{{MeasuredAtTime: time.Now().UTC()}})
+
+		assert.Equal(t, 0, len(lastState.GenerationRevisions))
+	})
+}
+
+func TestRunForGenerationRevisions(t *testing.T) {
+
+	testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
+	var response apiv1.GetAggregatedGenerationPerTypeResponse
+	err := xml.Unmarshal([]byte(testResponse), &response)
+	assert.Nil(t, err)
+
+	// re-read the whole day of the test response
+	areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, RereadWindowHours: int(time.Since(response.TimePeriod.Start).Hours()) + 1}
+	lastRetrievedGenerationTime := response.TimePeriod.End.Add(-15 * time.Minute)
+
+	t.Run("StoresOnlyCorrectedTimeSlots", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		entsoeClient := &fakeEntsoeClient{generationResponse: response}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: entsoeClient}
+		lastState := &apiv1.State{LastRetrievedGenerationTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: lastRetrievedGenerationTime}}
+		_, err := service.runForGenerationRevisions(context.Background(), make(chan struct{}), &sync.WaitGroup{}, areaConfig, lastState)
+		assert.Nil(t, err)
+		nrOfMeasurements := 0
+		for _, m := range sinkClient.measurements {
+			nrOfMeasurements += len(m.([]apiv1.GenerationMeasurement))
+		}
+		assert.Equal(t, 96, nrOfMeasurements)
+
+		var correctedResponse apiv1.GetAggregatedGenerationPerTypeResponse
+		_ = xml.Unmarshal([]byte(testResponse), &correctedResponse)
+		correctedResponse.TimeSeries[0].Periods[0].Points[0].Quantity++
+		entsoeClient.generationResponse = correctedResponse
+		sinkClient.measurements = nil
+
+		// act
+		_, err = service.runForGenerationRevisions(context.Background(), make(chan struct{}), &sync.WaitGroup{}, areaConfig, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(sinkClient.measurements))
+		measurements := sinkClient.measurements[0].([]apiv1.GenerationMeasurement)
+		assert.Equal(t, 1, len(measurements))
+		assert.Equal(t, response.TimePeriod.Start, measurements[0].MeasuredAtTime)
+		assert.Equal(t, 1, measurements[0].RevisionNumber)
+	})
+
+	t.Run("OnlyRecordsTimeSlotsWithoutRevisionIfASinkAddsDuplicates", func(t *testing.T) {
+
+		sinkClient := &fakeAppendingSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+		lastState := &apiv1.State{LastRetrievedGenerationTime: map[apiv1.Area]time.Time{apiv1.AreaNetherlands: lastRetrievedGenerationTime}}
+
+		// act
+		_, err := service.runForGenerationRevisions(context.Background(), make(chan struct{}), &sync.WaitGroup{}, areaConfig, lastState)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+		assert.Equal(t, 96, len(lastState.GenerationRevisions[apiv1.AreaNetherlands]))
+	})
+
+	t.Run("DoesNothingWithoutRetrievedGeneration", func(t *testing.T) {
+
+		sinkClient := &fakeSinkClient{}
+		service := service{sinkClient: sinkClient, stateClient: &fakeStateClient{}, entsoeClient: &fakeEntsoeClient{generationResponse: response}}
+
+		// act
+		_, err := service.runForGenerationRevisions(context.Background(), make(chan struct{}), &sync.WaitGroup{}, areaConfig, &apiv1.State{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(sinkClient.measurements))
+	})
+}
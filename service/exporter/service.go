@@ -3,16 +3,16 @@ package exporter
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"sync"
 	"time"
 
 	apiv1 "github.com/JorritSalverda/jarvis-electricity-mix-exporter/api/v1"
-	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/bigquery"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/config"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/entsoe"
+	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/sink"
 	"github.com/JorritSalverda/jarvis-electricity-mix-exporter/client/state"
-	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
@@ -20,22 +20,28 @@ type Service interface {
 	Run(ctx context.Context, gracefulShutdown chan os.Signal, waitGroup *sync.WaitGroup) error
 }
 
-func NewService(generationBigqueryClient bigquery.Client, exchangeBigqueryClient bigquery.Client, configClient config.Client, stateClient state.Client, entsoeClient entsoe.Client) (Service, error) {
+// NewService returns new exporter.Service; stateReader can be nil if none of the sinks can derive state from stored measurements
+func NewService(sinkClient sink.Client, configClient config.Client, stateClient state.Client, entsoeClient entsoe.Client, concurrency int, stateReader sink.StateReader, cursorPolicy apiv1.CursorPolicy) (Service, error) {
 	return &service{
-		generationBigqueryClient: generationBigqueryClient,
-		exchangeBigqueryClient:   exchangeBigqueryClient,
-		configClient:             configClient,
-		stateClient:              stateClient,
-		entsoeClient:             entsoeClient,
+		sinkClient:   sinkClient,
+		configClient: configClient,
+		stateClient:  stateClient,
+		entsoeClient: entsoeClient,
+		concurrency:  concurrency,
+		stateReader:  stateReader,
+		cursorPolicy: cursorPolicy,
 	}, nil
 }
 
 type service struct {
-	generationBigqueryClient bigquery.Client
-	exchangeBigqueryClient   bigquery.Client
-	configClient             config.Client
-	stateClient              state.Client
-	entsoeClient             entsoe.Client
+	sinkClient   sink.Client
+	configClient config.Client
+	stateClient  state.Client
+	entsoeClient entsoe.Client
+	concurrency  int
+	stateReader  sink.StateReader
+	cursorPolicy apiv1.CursorPolicy
+	stateMutex   sync.RWMutex
 }
 
 func (s *service) Run(ctx context.Context, gracefulShutdown chan os.Signal, waitGroup *sync.WaitGroup) error {
@@ -45,30 +51,119 @@ func (s *service) Run(ctx context.Context, gracefulShutdown chan os.Signal, wait
 		return err
 	}
 
+	err = s.validateStateBackend(config)
+	if err != nil {
+		return err
+	}
+
 	// check if there's a previous measurement stored in state file
 	lastState, err := s.stateClient.ReadState(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, areaConfig := range config.Areas {
-		lastState, err = s.runForArea(ctx, gracefulShutdown, waitGroup, *areaConfig, lastState)
-		if err != nil {
-			return err
-		}
+	if lastState == nil {
+		lastState = &apiv1.State{}
+	}
+
+	// the state can be lost or restored from an old backup, so check it against what has actually been stored
+	lastState, err = s.reconcileState(lastState)
+	if err != nil {
+		return err
+	}
 
+	// relay the shutdown signal to all workers, so each of them can finish its running task
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
 		select {
 		case signalReceived := <-gracefulShutdown:
 			log.Warn().Msgf("Received signal %v. Waiting for running tasks to finish...", signalReceived)
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	// areas are processed concurrently, all sharing the rate limit of the entsoe client
+	areaConfigs := s.getAreaConfigsWithUniquePriceAreas(config.Areas)
+	err = s.runConcurrently(len(areaConfigs), func(i int) error {
+		return s.runForAreaConfig(ctx, stop, waitGroup, areaConfigs[i], lastState)
+	})
+	if err != nil {
+		if s.isRateLimited(err) {
+			return nil
+		}
+		return err
+	}
+
+	if s.isStopping(stop) {
+		return nil
+	}
+
+	lastState, err = s.runForConsumptionMix(ctx, stop, waitGroup, config, lastState)
+	if err != nil {
+		if s.isRateLimited(err) {
+			return nil
+		}
+		return err
+	}
+
+	if s.isStopping(stop) {
+		return nil
+	}
+
+	_, err = s.runForCapacities(ctx, stop, waitGroup, config, lastState)
+	if err != nil {
+		if s.isRateLimited(err) {
 			return nil
-		case <-time.After(5 * time.Second):
 		}
+		return err
 	}
 
 	return nil
 }
 
-func (s *service) runForArea(ctx context.Context, gracefulShutdown chan os.Signal, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+// runForAreaConfig retrieves all configured measurements for a single area, one after another
+func (s *service) runForAreaConfig(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (err error) {
+
+	// repair gaps from earlier runs before retrieving new time slots, which can leave new gaps
+	_, err = s.runForGenerationGaps(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForGenerationRevisions(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForArea(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForLoad(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForForecasts(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForPrices(ctx, stop, waitGroup, areaConfig, lastState)
+	if err != nil || s.isStopping(stop) {
+		return
+	}
+
+	_, err = s.runForExchanges(ctx, stop, waitGroup, areaConfig, lastState)
+
+	return
+}
+
+func (s *service) runForArea(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
 
 	log.Info().Interface("areaConfig", areaConfig).Msgf("Retrieving measurements for area %v / country %v", areaConfig.Area, areaConfig.Country)
 
@@ -77,16 +172,17 @@ func (s *service) runForArea(ctx context.Context, gracefulShutdown chan os.Signa
 
 		// if it's the first time begin a year ago, otherwise start at last stored value
 		start := now.AddDate(-1*areaConfig.StartYearsAgo, -1*areaConfig.StartMonthsAgo, -1*areaConfig.StartDaysAgo)
+		s.stateMutex.RLock()
 		if lastState != nil && lastState.LastRetrievedGenerationTime != nil {
 			if lastRetrievedGenerationTime, ok := lastState.LastRetrievedGenerationTime[areaConfig.Area]; ok {
 				start = lastRetrievedGenerationTime.Add(time.Duration(areaConfig.ResolutionMinutes) * time.Minute)
 			}
 		}
+		s.stateMutex.RUnlock()
 		end := start.Add(time.Duration(4*24*areaConfig.ResolutionMinutes) * time.Minute)
 		if end.After(now) {
 			end = now
 		}
-		log.Debug().Interface("lastState", lastState).Msg("lastState")
 		log.Debug().Interface("areaConfig", areaConfig).Msg("areaConfig")
 		log.Debug().Msgf("start: %v", start)
 		log.Debug().Msgf("end: %v", end)
@@ -98,14 +194,15 @@ func (s *service) runForArea(ctx context.Context, gracefulShutdown chan os.Signa
 		}
 
 		// retrieve actual measurements
-		response, err := s.entsoeClient.GetAggregatedGenerationPerType(areaConfig.Area, apiv1.TimeInterval{
-			Start: start,
-			End:   end,
+		var response apiv1.GetAggregatedGenerationPerTypeResponse
+		_, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, time.Duration(areaConfig.ResolutionMinutes)*time.Minute, func(timeInterval apiv1.TimeInterval) (err error) {
+			response, err = s.entsoeClient.GetAggregatedGenerationPerType(ctx, areaConfig.Area, timeInterval)
+			return
 		})
-		if err != nil && !errors.Is(err, entsoe.ErrNoMatchingDataFound) {
+		if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
 			return lastState, err
 		}
-		if err != nil && errors.Is(err, entsoe.ErrNoMatchingDataFound) {
+		if err != nil && errors.Is(err, apiv1.ErrNoMatchingDataFound) {
 			log.Info().Msg("No data has been found, exiting")
 			return lastState, nil
 		}
@@ -122,46 +219,275 @@ func (s *service) runForArea(ctx context.Context, gracefulShutdown chan os.Signa
 			return lastState, nil
 		}
 
-		waitGroup.Add(1)
-		log.Debug().Interface("lastState", lastState).Msg("State before inserting measurements")
+		measurements := []apiv1.GenerationMeasurement{}
 		for i := 0; i < nrOfSlots; i++ {
 			timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*areaConfig.ResolutionMinutes) * time.Minute)
-			measurement := s.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig)
-
-			// store measurement
-			err = s.generationBigqueryClient.InsertMeasurement(measurement)
-			if err != nil {
-				return lastState, err
+			measurements = append(measurements, s.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, areaConfig))
+		}
+		gaps := s.findGenerationGaps(measurements, s.getExpectedProductionTypes(response, areaConfig))
+
+		// time slots retrieved before, for example after resetting the cursor, are only stored again if their values changed
+		s.stateMutex.RLock()
+		revisedMeasurements := s.getGenerationRevisions(areaConfig, lastState, measurements, time.Now().UTC(), false)
+		s.stateMutex.RUnlock()
+
+		err = s.storeGuarded(waitGroup, func() error {
+			// store measurements
+			if len(revisedMeasurements) > 0 {
+				err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamGeneration, revisedMeasurements)
+				if err != nil {
+					return err
+				}
 			}
 
 			// update state
-			if lastState == nil {
-				lastState = &apiv1.State{}
-			}
+			s.stateMutex.Lock()
 			if lastState.LastRetrievedGenerationTime == nil {
 				lastState.LastRetrievedGenerationTime = make(map[apiv1.Area]time.Time, 0)
 			}
-			lastState.LastRetrievedGenerationTime[areaConfig.Area] = measurement.MeasuredAtTime
+			lastState.LastRetrievedGenerationTime[areaConfig.Area] = measurements[len(measurements)-1].MeasuredAtTime
+			s.addGenerationGaps(areaConfig, lastState, gaps)
+			s.recordGenerationRevisions(areaConfig, lastState, revisedMeasurements)
+			s.stateMutex.Unlock()
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
 		}
-		log.Debug().Interface("lastState", lastState).Msg("State after inserting measurements")
 
-		// store state
-		err = s.stateClient.StoreState(ctx, *lastState)
+		if s.isStopping(stop) {
+			return lastState, nil
+		}
+	}
+}
+
+func (s *service) runForExchanges(ctx context.Context, stop <-chan struct{}, waitGroup *sync.WaitGroup, areaConfig apiv1.AreaConfig, lastState *apiv1.State) (*apiv1.State, error) {
+
+	if len(areaConfig.Exchanges) == 0 {
+		return lastState, nil
+	}
+
+	log.Info().Msgf("Retrieving exchanges for area %v / country %v with %v peers", areaConfig.Area, areaConfig.Country, len(areaConfig.Exchanges))
+
+	balanceResolutionMinutes := areaConfig.GetBalanceResolutionMinutes()
+
+	for {
+		now := time.Now().UTC().Round(time.Duration(balanceResolutionMinutes) * time.Minute)
+
+		// exchanges for all peers are retrieved for the same interval, so the balance can be computed over all of them;
+		// if it's the first time use the start of the area, otherwise start at last stored balance
+		start := now.AddDate(-1*areaConfig.StartYearsAgo, -1*areaConfig.StartMonthsAgo, -1*areaConfig.StartDaysAgo)
+		s.stateMutex.RLock()
+		if lastState != nil && lastState.LastRetrievedBalanceTime != nil {
+			if lastRetrievedBalanceTime, ok := lastState.LastRetrievedBalanceTime[areaConfig.Area]; ok {
+				start = lastRetrievedBalanceTime.Add(time.Duration(balanceResolutionMinutes) * time.Minute)
+			}
+		}
+		s.stateMutex.RUnlock()
+		end := start.Add(time.Duration(4*24*balanceResolutionMinutes) * time.Minute)
+		if end.After(now) {
+			end = now
+		}
+		log.Debug().Msgf("start: %v", start)
+		log.Debug().Msgf("end: %v", end)
+
+		// don't continue, we're up to date
+		if !start.Before(end) {
+			log.Info().Msgf("Start - %v - and end - %v - are equal, exiting", start, end)
+			return lastState, nil
+		}
+
+		// flows for all peers are retrieved one after another, this already runs in one of the concurrent area workers
+		peerResponses := make([][]apiv1.GetPhysicalCrossBorderFlowResponse, len(areaConfig.Exchanges))
+		retrievedInterval, err := s.requestSplittingTooLarge(apiv1.TimeInterval{Start: start, End: end}, time.Duration(balanceResolutionMinutes)*time.Minute, func(timeInterval apiv1.TimeInterval) (err error) {
+			for i, exchangeConfig := range areaConfig.Exchanges {
+				peerResponses[i], err = s.getPhysicalCrossBorderFlows(ctx, areaConfig, *exchangeConfig, timeInterval)
+				if err != nil {
+					return
+				}
+			}
+			return
+		})
 		if err != nil {
 			return lastState, err
 		}
-		waitGroup.Done()
+		end = retrievedInterval.End
+		responses := map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{}
+		for i, exchangeConfig := range areaConfig.Exchanges {
+			responses[exchangeConfig.Area] = peerResponses[i]
+		}
 
-		log.Info().Msg("Sleeping for 15 seconds before retrieving more data, to avoid rate limiting")
-		select {
-		case signalReceived := <-gracefulShutdown:
-			log.Warn().Msgf("Received signal %v. Waiting for running tasks to finish...", signalReceived)
+		// exchanges per peer that haven't been stored in a previous run
+		peerMeasurements := map[apiv1.Area][]apiv1.ExchangeMeasurement{}
+		nrOfInsertedExchangeMeasurements := 0
+		for _, exchangeConfig := range areaConfig.Exchanges {
+			timePeriod, ok := s.getTimePeriodForFlows(responses[exchangeConfig.Area])
+			if !ok {
+				log.Info().Msgf("No timeseries have been returned for exchange between area %v and area %v", areaConfig.Area, exchangeConfig.Area)
+				continue
+			}
+
+			lastRetrievedExchangeTime, hasLastRetrievedExchangeTime := s.getLastRetrievedExchangeTime(lastState, areaConfig.Area, exchangeConfig.Area)
+
+			measurements := []apiv1.ExchangeMeasurement{}
+			nrOfSlots := int(timePeriod.End.Sub(timePeriod.Start).Minutes() / float64(exchangeConfig.ResolutionMinutes))
+			for i := 0; i < nrOfSlots; i++ {
+				timeSlotStartTime := timePeriod.Start.Add(time.Duration(i*exchangeConfig.ResolutionMinutes) * time.Minute)
+				if hasLastRetrievedExchangeTime && !timeSlotStartTime.After(lastRetrievedExchangeTime) {
+					// already stored in a previous run
+					continue
+				}
+
+				measurements = append(measurements, s.createExchangeMeasurementForTimeSlot(responses[exchangeConfig.Area], timeSlotStartTime, areaConfig, *exchangeConfig))
+			}
+
+			if len(measurements) == 0 {
+				continue
+			}
+
+			peerMeasurements[exchangeConfig.Area] = measurements
+			nrOfInsertedExchangeMeasurements += len(measurements)
+		}
+
+		balanceMeasurements := s.createBalanceMeasurements(responses, apiv1.TimeInterval{Start: start, End: end}, areaConfig, balanceResolutionMinutes)
+		nrOfInsertedBalanceMeasurements := len(balanceMeasurements)
+
+		if nrOfInsertedExchangeMeasurements == 0 && nrOfInsertedBalanceMeasurements == 0 {
+			log.Info().Msg("No new measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		err = s.storeGuarded(waitGroup, func() error {
+			for _, exchangeConfig := range areaConfig.Exchanges {
+				measurements, ok := peerMeasurements[exchangeConfig.Area]
+				if !ok {
+					continue
+				}
+
+				// store measurements
+				err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamExchange, measurements)
+				if err != nil {
+					return err
+				}
+
+				// update state
+				s.stateMutex.Lock()
+				if lastState.LastRetrievedExchangeTime == nil {
+					lastState.LastRetrievedExchangeTime = make(map[apiv1.Area]map[apiv1.Area]time.Time, 0)
+				}
+				if lastState.LastRetrievedExchangeTime[areaConfig.Area] == nil {
+					lastState.LastRetrievedExchangeTime[areaConfig.Area] = make(map[apiv1.Area]time.Time, 0)
+				}
+				lastState.LastRetrievedExchangeTime[areaConfig.Area][exchangeConfig.Area] = measurements[len(measurements)-1].MeasuredAtTime
+				s.stateMutex.Unlock()
+			}
+
+			if nrOfInsertedBalanceMeasurements > 0 {
+				// store measurements
+				err := s.sinkClient.InsertMeasurements(apiv1.MeasurementStreamBalance, balanceMeasurements)
+				if err != nil {
+					return err
+				}
+
+				// update state
+				s.stateMutex.Lock()
+				if lastState.LastRetrievedBalanceTime == nil {
+					lastState.LastRetrievedBalanceTime = make(map[apiv1.Area]time.Time, 0)
+				}
+				lastState.LastRetrievedBalanceTime[areaConfig.Area] = balanceMeasurements[len(balanceMeasurements)-1].MeasuredAtTime
+				s.stateMutex.Unlock()
+			}
+
+			// store state
+			return s.storeState(ctx, lastState)
+		})
+		if err != nil {
+			return lastState, err
+		}
+
+		if nrOfInsertedBalanceMeasurements == 0 {
+			log.Info().Msg("No new balance measurements were inserted, exiting")
+			return lastState, nil
+		}
+
+		if s.isStopping(stop) {
 			return lastState, nil
-		case <-time.After(15 * time.Second):
 		}
 	}
 }
 
+// createBalanceMeasurements returns the balance for each time slot in the interval, up to the first time slot for which not
+// every peer has published flows yet; that one is computed in a later run, so a late peer doesn't leave the balance incomplete
+func (s *service) createBalanceMeasurements(responses map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse, timeInterval apiv1.TimeInterval, areaConfig apiv1.AreaConfig, resolutionMinutes int) []apiv1.BalanceMeasurement {
+
+	balanceMeasurements := []apiv1.BalanceMeasurement{}
+	nrOfSlots := int(timeInterval.End.Sub(timeInterval.Start).Minutes() / float64(resolutionMinutes))
+	for i := 0; i < nrOfSlots; i++ {
+		timeSlotStartTime := timeInterval.Start.Add(time.Duration(i*resolutionMinutes) * time.Minute)
+
+		exchangeMeasurements := []apiv1.ExchangeMeasurement{}
+		for _, exchangeConfig := range areaConfig.Exchanges {
+			// flows of peers with a coarser resolution are repeated for each time slot of the balance
+			balanceExchangeConfig := *exchangeConfig
+			balanceExchangeConfig.ResolutionMinutes = resolutionMinutes
+
+			exchangeMeasurement := s.createExchangeMeasurementForTimeSlot(responses[exchangeConfig.Area], timeSlotStartTime, areaConfig, balanceExchangeConfig)
+			if len(exchangeMeasurement.Samples) == 0 {
+				log.Info().Msgf("Area %v has no flows for time slot %v yet, postponing balance of area %v", exchangeConfig.Area, timeSlotStartTime, areaConfig.Area)
+				return balanceMeasurements
+			}
+			exchangeMeasurements = append(exchangeMeasurements, exchangeMeasurement)
+		}
+
+		balanceMeasurements = append(balanceMeasurements, s.createBalanceMeasurementForTimeSlot(exchangeMeasurements, timeSlotStartTime, areaConfig, resolutionMinutes))
+	}
+
+	return balanceMeasurements
+}
+
+// getPhysicalCrossBorderFlows retrieves the flows into and out of the area for a single peer
+func (s *service) getPhysicalCrossBorderFlows(ctx context.Context, areaConfig apiv1.AreaConfig, exchangeConfig apiv1.ExchangeConfig, timeInterval apiv1.TimeInterval) (responses []apiv1.GetPhysicalCrossBorderFlowResponse, err error) {
+
+	// retrieve flows into the area
+	inResponse, err := s.entsoeClient.GetPhysicalCrossBorderFlow(ctx, areaConfig.Area, exchangeConfig.Area, timeInterval)
+	if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+		return responses, err
+	}
+
+	// retrieve flows out of the area
+	outResponse, err := s.entsoeClient.GetPhysicalCrossBorderFlow(ctx, exchangeConfig.Area, areaConfig.Area, timeInterval)
+	if err != nil && !errors.Is(err, apiv1.ErrNoMatchingDataFound) {
+		return responses, err
+	}
+
+	return []apiv1.GetPhysicalCrossBorderFlowResponse{inResponse, outResponse}, nil
+}
+
+func (s *service) getTimePeriodForFlows(responses []apiv1.GetPhysicalCrossBorderFlowResponse) (timePeriod apiv1.TimeInterval, ok bool) {
+	for _, r := range responses {
+		if len(r.TimeSeries) > 0 {
+			return r.TimePeriod, true
+		}
+	}
+
+	return timePeriod, false
+}
+
+func (s *service) getLastRetrievedExchangeTime(lastState *apiv1.State, area, areaPeer apiv1.Area) (lastRetrievedExchangeTime time.Time, ok bool) {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+
+	if lastState == nil || lastState.LastRetrievedExchangeTime == nil || lastState.LastRetrievedExchangeTime[area] == nil {
+		return lastRetrievedExchangeTime, false
+	}
+
+	lastRetrievedExchangeTime, ok = lastState.LastRetrievedExchangeTime[area][areaPeer]
+
+	return
+}
+
 func (s *service) mapToEnergyType(psrType apiv1.PsrType) apiv1.EnergyType {
 
 	switch psrType {
@@ -222,6 +548,17 @@ func (s *service) mapToSampleDirection(timeSerie apiv1.AggregatedGenerationTimeS
 	return apiv1.SampleDirectionUnknown
 }
 
+func (s *service) mapFlowToSampleDirection(timeSerie apiv1.PhysicalFlowTimeSerie, area apiv1.Area) apiv1.SampleDirection {
+	if timeSerie.InDomain == area {
+		return apiv1.SampleDirectionIn
+	}
+	if timeSerie.OutDomain == area {
+		return apiv1.SampleDirectionOut
+	}
+
+	return apiv1.SampleDirectionUnknown
+}
+
 func (s *service) mapToSampleUnit(measurementUnit apiv1.MeasurementUnit) apiv1.SampleUnit {
 	if measurementUnit == apiv1.MeasurementUnitMegaWatt {
 		return apiv1.SampleUnitMegaWatt
@@ -232,7 +569,7 @@ func (s *service) mapToSampleUnit(measurementUnit apiv1.MeasurementUnit) apiv1.S
 
 func (s *service) createGenerationMeasurementForTimeSlot(response apiv1.GetAggregatedGenerationPerTypeResponse, timeSlotStartTime time.Time, areaConfig apiv1.AreaConfig) apiv1.GenerationMeasurement {
 	measurement := apiv1.GenerationMeasurement{
-		ID:             uuid.New().String(),
+		ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamGeneration, string(areaConfig.Source), string(areaConfig.Area), timeSlotStartTime),
 		Source:         string(areaConfig.Source),
 		Area:           string(areaConfig.Area),
 		Country:        string(areaConfig.Country),
@@ -241,41 +578,122 @@ func (s *service) createGenerationMeasurementForTimeSlot(response apiv1.GetAggre
 
 	// insert all periods that started after last inserted one
 	for _, ts := range response.TimeSeries {
-		if ts.Period.TimeInterval.Start.After(timeSlotStartTime) {
-			// log.Info().Msgf("Timeserie %v for psr type %v starts after time slot %v, continuing to next timeserie", ts.ID, ts.MktPsrType.PsrType, timeSlotStartTime)
-			continue
-		}
-		if ts.Period.TimeInterval.End.Equal(timeSlotStartTime) {
-			// log.Info().Msgf("Timeserie %v for psr type %v ends at time slot %v, continuing to next timeserie", ts.ID, ts.MktPsrType.PsrType, timeSlotStartTime)
-			continue
-		}
-		if ts.Period.TimeInterval.End.Before(timeSlotStartTime) {
-			// log.Info().Msgf("Timeserie %v for psr type %v ends before time slot %v, continuing to next timeserie", ts.ID, ts.MktPsrType.PsrType, timeSlotStartTime)
+		period, ok := ts.Periods.Find(timeSlotStartTime)
+		if !ok {
+			// log.Info().Msgf("Timeserie %v for psr type %v has no period containing time slot %v, continuing to next timeserie", ts.ID, ts.MktPsrType.PsrType, timeSlotStartTime)
 			continue
 		}
 
 		if measurement.Resolution == "" {
-			measurement.Resolution = string(ts.Period.Resolution)
+			measurement.Resolution = string(apiv1.NewResolution(areaConfig.ResolutionMinutes))
 		}
 
-		pointIndexForSlot := int(timeSlotStartTime.Sub(ts.Period.TimeInterval.Start).Minutes() / float64(areaConfig.ResolutionMinutes))
+		// the period has its own resolution, which gets resampled to the one of the area
+		point, ok := apiv1.GetPointForTimeSlot(period, ts.CurveType, timeSlotStartTime, time.Duration(areaConfig.ResolutionMinutes)*time.Minute)
 
 		energyType := s.mapToEnergyType(ts.MktPsrType.PsrType)
-		if pointIndexForSlot < len(ts.Period.Points) {
+		emissionFactor := areaConfig.GetEmissionFactor(energyType, ts.MktPsrType.PsrType)
+		if ok {
 			measurement.Samples = append(measurement.Samples, &apiv1.Sample{
-				EnergyType:         energyType,
-				OriginalEnergyType: string(ts.MktPsrType.PsrType),
-				IsRenewable:        energyType.IsRenewable(),
-				MetricType:         apiv1.MetricTypeGauge,
-				SampleDirection:    s.mapToSampleDirection(ts),
-				SampleUnit:         s.mapToSampleUnit(ts.QuanityMeasurementUnit),
-				Value:              ts.Period.Points[pointIndexForSlot].Quantity,
+				EnergyType:            energyType,
+				OriginalEnergyType:    string(ts.MktPsrType.PsrType),
+				IsRenewable:           energyType.IsRenewable(),
+				CarbonIntensity:       emissionFactor.Lifecycle,
+				DirectCarbonIntensity: emissionFactor.Direct,
+				MetricType:            apiv1.MetricTypeGauge,
+				SampleDirection:       s.mapToSampleDirection(ts),
+				SampleUnit:            s.mapToSampleUnit(ts.QuanityMeasurementUnit),
+				Value:                 point.Quantity,
 			})
 		} else {
-			// this timeserie seems to have less points, what to do now?
-			log.Warn().Msgf("Timeserie %v for psr type %v only has %v points, while index %v should be retrieved", ts.ID, ts.MktPsrType.PsrType, len(ts.Period.Points), pointIndexForSlot)
+			// this timeserie has no point for the time slot (yet), it's picked up as a gap
+			log.Warn().Msgf("Timeserie %v for psr type %v with resolution %v has no point for time slot %v", ts.ID, ts.MktPsrType.PsrType, period.Resolution, timeSlotStartTime)
 		}
 	}
 
+	measurement.CarbonIntensity, measurement.DirectCarbonIntensity = apiv1.GetCarbonIntensity(measurement.Samples, apiv1.SampleDirectionIn)
+
+	return measurement
+}
+
+func (s *service) createExchangeMeasurementForTimeSlot(responses []apiv1.GetPhysicalCrossBorderFlowResponse, timeSlotStartTime time.Time, areaConfig apiv1.AreaConfig, exchangeConfig apiv1.ExchangeConfig) apiv1.ExchangeMeasurement {
+	measurement := apiv1.ExchangeMeasurement{
+		ID:                  apiv1.NewMeasurementID(apiv1.MeasurementStreamExchange, string(exchangeConfig.Source), string(areaConfig.Area), timeSlotStartTime, string(exchangeConfig.Area)),
+		Source:              string(exchangeConfig.Source),
+		Area:                string(areaConfig.Area),
+		Country:             string(areaConfig.Country),
+		ExchangeWithArea:    string(exchangeConfig.Area),
+		ExchangeWithCountry: string(exchangeConfig.Country),
+		MeasuredAtTime:      timeSlotStartTime,
+	}
+
+	for _, response := range responses {
+		for _, ts := range response.TimeSeries {
+			period, ok := ts.Periods.Find(timeSlotStartTime)
+			if !ok {
+				continue
+			}
+
+			if measurement.Resolution == "" {
+				measurement.Resolution = string(apiv1.NewResolution(exchangeConfig.ResolutionMinutes))
+			}
+
+			point, ok := apiv1.GetPointForTimeSlot(period, ts.CurveType, timeSlotStartTime, time.Duration(exchangeConfig.ResolutionMinutes)*time.Minute)
+
+			if ok {
+				measurement.Samples = append(measurement.Samples, &apiv1.Sample{
+					EnergyType:      apiv1.EnergyTypeUnknown,
+					MetricType:      apiv1.MetricTypeGauge,
+					SampleDirection: s.mapFlowToSampleDirection(ts, areaConfig.Area),
+					SampleUnit:      s.mapToSampleUnit(ts.QuanityMeasurementUnit),
+					Value:           point.Quantity,
+				})
+			} else {
+				log.Warn().Msgf("Timeserie %v for flow from %v to %v with resolution %v has no point for time slot %v", ts.ID, ts.OutDomain, ts.InDomain, period.Resolution, timeSlotStartTime)
+			}
+		}
+	}
+
+	return measurement
+}
+
+func (s *service) createBalanceMeasurementForTimeSlot(exchangeMeasurements []apiv1.ExchangeMeasurement, timeSlotStartTime time.Time, areaConfig apiv1.AreaConfig, resolutionMinutes int) apiv1.BalanceMeasurement {
+	measurement := apiv1.BalanceMeasurement{
+		ID:             apiv1.NewMeasurementID(apiv1.MeasurementStreamBalance, string(areaConfig.Source), string(areaConfig.Area), timeSlotStartTime),
+		Source:         string(areaConfig.Source),
+		Area:           string(areaConfig.Area),
+		Country:        string(areaConfig.Country),
+		Resolution:     fmt.Sprintf("PT%vM", resolutionMinutes),
+		MeasuredAtTime: timeSlotStartTime,
+	}
+
+	importSample := &apiv1.Sample{
+		EnergyType:      apiv1.EnergyTypeUnknown,
+		MetricType:      apiv1.MetricTypeGauge,
+		SampleDirection: apiv1.SampleDirectionIn,
+		SampleUnit:      apiv1.SampleUnitMegaWatt,
+	}
+	exportSample := &apiv1.Sample{
+		EnergyType:      apiv1.EnergyTypeUnknown,
+		MetricType:      apiv1.MetricTypeGauge,
+		SampleDirection: apiv1.SampleDirectionOut,
+		SampleUnit:      apiv1.SampleUnitMegaWatt,
+	}
+
+	for _, em := range exchangeMeasurements {
+		measurement.ExchangeWithAreas = append(measurement.ExchangeWithAreas, em.ExchangeWithArea)
+		for _, sample := range em.Samples {
+			switch sample.SampleDirection {
+			case apiv1.SampleDirectionIn:
+				importSample.Value += sample.Value
+			case apiv1.SampleDirectionOut:
+				exportSample.Value += sample.Value
+			}
+		}
+	}
+
+	measurement.Samples = []*apiv1.Sample{importSample, exportSample}
+	measurement.NetImport = importSample.Value - exportSample.Value
+
 	return measurement
 }
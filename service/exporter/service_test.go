@@ -10,31 +10,67 @@ import (
 	"github.com/alecthomas/assert"
 )
 
-func TestcreateGenerationMeasurementForTimeSlot(t *testing.T) {
+func TestCreateGenerationMeasurementForTimeSlot(t *testing.T) {
 	t.Run("CreatesSamplesForEachTimeSeriesThatHasAPointForFirstTimeSlot", func(t *testing.T) {
 
 		service := service{}
-		testResponse, _ := ioutil.ReadFile("../../client/entsoe/A75-response.xml")
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
 		var response apiv1.GetAggregatedGenerationPerTypeResponse
 		err := xml.Unmarshal([]byte(testResponse), &response)
 		assert.Nil(t, err)
 
 		// act
-		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.Start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.Start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
 
 		assert.Equal(t, 19, len(measurement.Samples))
 	})
 
+	t.Run("ComputesCarbonIntensityWeightedOverGeneration", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+		timeSerie := func(psrType apiv1.PsrType, inBiddingZone, outBiddingZone apiv1.Area, quantity float64) apiv1.AggregatedGenerationTimeSerie {
+			ts := apiv1.AggregatedGenerationTimeSerie{
+				InBiddingZone:  inBiddingZone,
+				OutBiddingZone: outBiddingZone,
+				Periods: apiv1.TimeSeriePeriods{
+					{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(15 * time.Minute)}, Resolution: apiv1.ResolutionPT15M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: quantity}}},
+				},
+			}
+			ts.MktPsrType.PsrType = psrType
+			return ts
+		}
+		response := apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{
+			timeSerie(apiv1.PsrTypeFossilGas, apiv1.AreaNetherlands, apiv1.AreaUnknown, 300),
+			timeSerie(apiv1.PsrTypeWindOnshore, apiv1.AreaNetherlands, apiv1.AreaUnknown, 100),
+			// consumption of pumped storage doesn't count as generation
+			timeSerie(apiv1.PsrTypeHydroPumpedStorage, apiv1.AreaUnknown, apiv1.AreaNetherlands, 50),
+		}}
+		areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15, EmissionFactors: map[string]apiv1.EmissionFactor{
+			string(apiv1.PsrTypeFossilGas): {Lifecycle: 450, Direct: 350},
+		}}
+
+		// act
+		measurement := service.createGenerationMeasurementForTimeSlot(response, start, areaConfig)
+
+		assert.Equal(t, 3, len(measurement.Samples))
+		assert.Equal(t, 450.0, measurement.Samples[0].CarbonIntensity)
+		assert.Equal(t, 11.0, measurement.Samples[1].CarbonIntensity)
+		// (300 * 450 + 100 * 11) / 400 and (300 * 350 + 100 * 0) / 400
+		assert.InDelta(t, 340.25, measurement.CarbonIntensity, 0.001)
+		assert.InDelta(t, 262.5, measurement.DirectCarbonIntensity, 0.001)
+	})
+
 	t.Run("CreatesSamplesForEachTimeSeriesThatHasAPointForLastTimeSlot", func(t *testing.T) {
 
 		service := service{}
-		testResponse, _ := ioutil.ReadFile("../../client/entsoe/A75-response.xml")
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
 		var response apiv1.GetAggregatedGenerationPerTypeResponse
 		err := xml.Unmarshal([]byte(testResponse), &response)
 		assert.Nil(t, err)
 
 		// act
-		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.End.Add(time.Duration(-1*15)*time.Minute), apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.End.Add(time.Duration(-1*15)*time.Minute), apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
 
 		assert.Equal(t, 19, len(measurement.Samples))
 	})
@@ -46,7 +82,7 @@ func TestcreateGenerationMeasurementForTimeSlot(t *testing.T) {
 		}
 
 		service := service{}
-		testResponse, _ := ioutil.ReadFile("../../client/entsoe/A75-response.xml")
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
 		var response apiv1.GetAggregatedGenerationPerTypeResponse
 		err := xml.Unmarshal([]byte(testResponse), &response)
 		assert.Nil(t, err)
@@ -56,9 +92,14 @@ func TestcreateGenerationMeasurementForTimeSlot(t *testing.T) {
 		assert.Equal(t, 96, nrOfSlots)
 		for i := 0; i < nrOfSlots; i++ {
 			timeSlotStartTime := response.TimePeriod.Start.Add(time.Duration(i*15) * time.Minute)
-			measurement := service.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+			measurement := service.createGenerationMeasurementForTimeSlot(response, timeSlotStartTime, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
 
-			assert.Equal(t, 19, len(measurement.Samples), "Number of samples for time slot %v does not match expectation", timeSlotStartTime)
+			expectedNrOfSamples := 19
+			if i == 92 {
+				// timeserie 15 (hydro run of river consumption) only has a point for 23:00
+				expectedNrOfSamples = 20
+			}
+			assert.Equal(t, expectedNrOfSamples, len(measurement.Samples), "Number of samples for time slot %v does not match expectation", timeSlotStartTime)
 			assert.Equal(t, timeSlotStartTime, measurement.MeasuredAtTime)
 		}
 	})
@@ -66,14 +107,233 @@ func TestcreateGenerationMeasurementForTimeSlot(t *testing.T) {
 	t.Run("CreatesSamplesForEachTimeSeriesThatHasAPointForLastTimeSlot", func(t *testing.T) {
 
 		service := service{}
-		testResponse, _ := ioutil.ReadFile("../../client/entsoe/A75-response.xml")
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A75-response.xml")
 		var response apiv1.GetAggregatedGenerationPerTypeResponse
 		err := xml.Unmarshal([]byte(testResponse), &response)
 		assert.Nil(t, err)
 
 		// act
-		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.End.Add(time.Duration(-1*15)*time.Minute), apiv1.AreaConfig{Area: apiv1.AreaNetherlands})
+		measurement := service.createGenerationMeasurementForTimeSlot(response, response.TimePeriod.End.Add(time.Duration(-1*15)*time.Minute), apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
 
 		assert.Equal(t, 19, len(measurement.Samples))
 	})
+
+	t.Run("TakesPointFromPeriodContainingTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		timeSlot := time.Date(2021, 3, 11, 8, 0, 0, 0, time.UTC)
+		timeSerie := apiv1.AggregatedGenerationTimeSerie{
+			InBiddingZone: apiv1.AreaNetherlands,
+			Periods: apiv1.TimeSeriePeriods{
+				{TimeInterval: apiv1.TimeInterval{Start: timeSlot.Add(-1 * time.Hour), End: timeSlot.Add(-30 * time.Minute)}, Resolution: apiv1.ResolutionPT15M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 10}, {Position: 2, Quantity: 20}}},
+				{TimeInterval: apiv1.TimeInterval{Start: timeSlot, End: timeSlot.Add(15 * time.Minute)}, Resolution: apiv1.ResolutionPT15M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 30}}},
+			},
+		}
+		timeSerie.MktPsrType.PsrType = apiv1.PsrTypeSolar
+		response := apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{timeSerie}}
+
+		// act
+		measurement := service.createGenerationMeasurementForTimeSlot(response, timeSlot, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15})
+
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, 30.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("TakesPointByPositionForVariableSizedBlocks", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+		timeSerie := apiv1.AggregatedGenerationTimeSerie{
+			InBiddingZone: apiv1.AreaNetherlands,
+			CurveType:     apiv1.CurveTypeVariableSizedBlock,
+			Periods: apiv1.TimeSeriePeriods{
+				{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, Resolution: apiv1.ResolutionPT15M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 10}, {Position: 4, Quantity: 40}}},
+			},
+		}
+		timeSerie.MktPsrType.PsrType = apiv1.PsrTypeNuclear
+		response := apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{timeSerie}}
+		areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 15}
+
+		// act
+		thirdMeasurement := service.createGenerationMeasurementForTimeSlot(response, start.Add(30*time.Minute), areaConfig)
+		fourthMeasurement := service.createGenerationMeasurementForTimeSlot(response, start.Add(45*time.Minute), areaConfig)
+
+		assert.Equal(t, 10.0, thirdMeasurement.Samples[0].Value)
+		assert.Equal(t, 40.0, fourthMeasurement.Samples[0].Value)
+	})
+
+	t.Run("RepeatsHourlyPointForQuarterHourTimeSlots", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+		timeSerie := apiv1.AggregatedGenerationTimeSerie{
+			InBiddingZone: apiv1.AreaBelgium,
+			Periods: apiv1.TimeSeriePeriods{
+				{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(2 * time.Hour)}, Resolution: apiv1.ResolutionPT60M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 100}, {Position: 2, Quantity: 200}}},
+			},
+		}
+		timeSerie.MktPsrType.PsrType = apiv1.PsrTypeNuclear
+		response := apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{timeSerie}}
+
+		// act
+		measurement := service.createGenerationMeasurementForTimeSlot(response, start.Add(75*time.Minute), apiv1.AreaConfig{Area: apiv1.AreaBelgium, ResolutionMinutes: 15})
+
+		assert.Equal(t, string(apiv1.ResolutionPT15M), measurement.Resolution)
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, 200.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("AveragesQuarterHourPointsForHourlyTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 11, 7, 0, 0, 0, time.UTC)
+		timeSerie := apiv1.AggregatedGenerationTimeSerie{
+			InBiddingZone: apiv1.AreaNetherlands,
+			Periods: apiv1.TimeSeriePeriods{
+				{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, Resolution: apiv1.ResolutionPT15M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 10}, {Position: 2, Quantity: 20}, {Position: 3, Quantity: 30}, {Position: 4, Quantity: 40}}},
+			},
+		}
+		timeSerie.MktPsrType.PsrType = apiv1.PsrTypeSolar
+		response := apiv1.GetAggregatedGenerationPerTypeResponse{TimeSeries: []apiv1.AggregatedGenerationTimeSerie{timeSerie}}
+
+		// act
+		measurement := service.createGenerationMeasurementForTimeSlot(response, start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, ResolutionMinutes: 60})
+
+		assert.Equal(t, string(apiv1.ResolutionPT60M), measurement.Resolution)
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, 25.0, measurement.Samples[0].Value)
+	})
+}
+
+func TestCreateExchangeMeasurementForTimeSlot(t *testing.T) {
+	t.Run("CreatesInSampleForFlowIntoArea", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A11-response.xml")
+		var response apiv1.GetPhysicalCrossBorderFlowResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement := service.createExchangeMeasurementForTimeSlot([]apiv1.GetPhysicalCrossBorderFlowResponse{response}, response.TimePeriod.Start, apiv1.AreaConfig{Area: apiv1.AreaNetherlands, Country: apiv1.CountryCodeNetherlands}, apiv1.ExchangeConfig{Area: apiv1.AreaDenmark, Country: apiv1.CountryCodeDenmark, ResolutionMinutes: 60})
+
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurement.Area)
+		assert.Equal(t, string(apiv1.AreaDenmark), measurement.ExchangeWithArea)
+		assert.Equal(t, string(apiv1.ResolutionPT60M), measurement.Resolution)
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, apiv1.SampleDirectionIn, measurement.Samples[0].SampleDirection)
+		assert.Equal(t, 701.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("CreatesOutSampleForFlowOutOfArea", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A11-response.xml")
+		var response apiv1.GetPhysicalCrossBorderFlowResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement := service.createExchangeMeasurementForTimeSlot([]apiv1.GetPhysicalCrossBorderFlowResponse{response}, response.TimePeriod.Start.Add(time.Hour), apiv1.AreaConfig{Area: apiv1.AreaDenmark, Country: apiv1.CountryCodeDenmark}, apiv1.ExchangeConfig{Area: apiv1.AreaNetherlands, Country: apiv1.CountryCodeNetherlands, ResolutionMinutes: 60})
+
+		assert.Equal(t, 1, len(measurement.Samples))
+		assert.Equal(t, apiv1.SampleDirectionOut, measurement.Samples[0].SampleDirection)
+		assert.Equal(t, 700.0, measurement.Samples[0].Value)
+	})
+
+	t.Run("CreatesNoSamplesAfterLastTimeSlot", func(t *testing.T) {
+
+		service := service{}
+		testResponse, _ := ioutil.ReadFile("../../api/v1/A11-response.xml")
+		var response apiv1.GetPhysicalCrossBorderFlowResponse
+		err := xml.Unmarshal([]byte(testResponse), &response)
+		assert.Nil(t, err)
+
+		// act
+		measurement := service.createExchangeMeasurementForTimeSlot([]apiv1.GetPhysicalCrossBorderFlowResponse{response}, response.TimePeriod.End, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, apiv1.ExchangeConfig{Area: apiv1.AreaDenmark, ResolutionMinutes: 60})
+
+		assert.Equal(t, 0, len(measurement.Samples))
+	})
+}
+
+func TestCreateBalanceMeasurementForTimeSlot(t *testing.T) {
+	t.Run("SumsImportsAndExportsOverAllPeers", func(t *testing.T) {
+
+		service := service{}
+		exchangeMeasurements := []apiv1.ExchangeMeasurement{
+			{
+				ExchangeWithArea: string(apiv1.AreaBelgium),
+				Samples: []*apiv1.Sample{
+					{SampleDirection: apiv1.SampleDirectionIn, Value: 500},
+					{SampleDirection: apiv1.SampleDirectionOut, Value: 100},
+				},
+			},
+			{
+				ExchangeWithArea: string(apiv1.AreaGermany),
+				Samples: []*apiv1.Sample{
+					{SampleDirection: apiv1.SampleDirectionIn, Value: 200},
+					{SampleDirection: apiv1.SampleDirectionOut, Value: 1000},
+				},
+			},
+		}
+		timeSlotStartTime := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)
+
+		// act
+		measurement := service.createBalanceMeasurementForTimeSlot(exchangeMeasurements, timeSlotStartTime, apiv1.AreaConfig{Area: apiv1.AreaNetherlands}, 60)
+
+		assert.Equal(t, string(apiv1.AreaNetherlands), measurement.Area)
+		assert.Equal(t, string(apiv1.ResolutionPT60M), measurement.Resolution)
+		assert.Equal(t, []string{string(apiv1.AreaBelgium), string(apiv1.AreaGermany)}, measurement.ExchangeWithAreas)
+		assert.Equal(t, 2, len(measurement.Samples))
+		assert.Equal(t, apiv1.SampleDirectionIn, measurement.Samples[0].SampleDirection)
+		assert.Equal(t, 700.0, measurement.Samples[0].Value)
+		assert.Equal(t, apiv1.SampleDirectionOut, measurement.Samples[1].SampleDirection)
+		assert.Equal(t, 1100.0, measurement.Samples[1].Value)
+		assert.Equal(t, -400.0, measurement.NetImport)
+		assert.Equal(t, timeSlotStartTime, measurement.MeasuredAtTime)
+	})
+}
+
+func TestCreateBalanceMeasurements(t *testing.T) {
+	t.Run("StopsAtFirstTimeSlotWithoutFlowsForEveryPeer", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)
+		flow := func(from, to apiv1.Area, quantities ...float64) []apiv1.GetPhysicalCrossBorderFlowResponse {
+			period := apiv1.TimeSeriePeriod{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Duration(len(quantities)) * time.Hour)}, Resolution: apiv1.ResolutionPT60M}
+			for i, q := range quantities {
+				period.Points = append(period.Points, apiv1.TimeSeriePoint{Position: i + 1, Quantity: q})
+			}
+			return []apiv1.GetPhysicalCrossBorderFlowResponse{{TimeSeries: []apiv1.PhysicalFlowTimeSerie{{InDomain: to, OutDomain: from, QuanityMeasurementUnit: apiv1.MeasurementUnitMegaWatt, Periods: apiv1.TimeSeriePeriods{period}}}}}
+		}
+		responses := map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{
+			apiv1.AreaBelgium: flow(apiv1.AreaBelgium, apiv1.AreaNetherlands, 500, 600, 700),
+			apiv1.AreaGermany: flow(apiv1.AreaGermany, apiv1.AreaNetherlands, 200),
+		}
+		areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, Exchanges: []*apiv1.ExchangeConfig{{Area: apiv1.AreaBelgium, ResolutionMinutes: 60}, {Area: apiv1.AreaGermany, ResolutionMinutes: 60}}}
+
+		// act
+		measurements := service.createBalanceMeasurements(responses, apiv1.TimeInterval{Start: start, End: start.Add(3 * time.Hour)}, areaConfig, 60)
+
+		assert.Equal(t, 1, len(measurements))
+		assert.Equal(t, start, measurements[0].MeasuredAtTime)
+		assert.Equal(t, 700.0, measurements[0].NetImport)
+	})
+
+	t.Run("RepeatsHourlyFlowsForQuarterHourBalance", func(t *testing.T) {
+
+		service := service{}
+		start := time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)
+		period := apiv1.TimeSeriePeriod{TimeInterval: apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, Resolution: apiv1.ResolutionPT60M, Points: []apiv1.TimeSeriePoint{{Position: 1, Quantity: 400}}}
+		responses := map[apiv1.Area][]apiv1.GetPhysicalCrossBorderFlowResponse{
+			apiv1.AreaBelgium: {{TimeSeries: []apiv1.PhysicalFlowTimeSerie{{InDomain: apiv1.AreaNetherlands, OutDomain: apiv1.AreaBelgium, QuanityMeasurementUnit: apiv1.MeasurementUnitMegaWatt, Periods: apiv1.TimeSeriePeriods{period}}}}},
+		}
+		areaConfig := apiv1.AreaConfig{Area: apiv1.AreaNetherlands, Exchanges: []*apiv1.ExchangeConfig{{Area: apiv1.AreaBelgium, ResolutionMinutes: 60}}}
+
+		// act
+		measurements := service.createBalanceMeasurements(responses, apiv1.TimeInterval{Start: start, End: start.Add(time.Hour)}, areaConfig, 15)
+
+		assert.Equal(t, 4, len(measurements))
+		assert.Equal(t, 400.0, measurements[3].NetImport)
+	})
 }